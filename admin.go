@@ -0,0 +1,109 @@
+package main
+
+// Admin endpoints for backing up and checking configuration. Disabled
+// unless config admin.token is set; callers authenticate with
+// "Authorization: Bearer <token>".
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// redactedSecret replaces secrets in exported config.
+const redactedSecret = "REDACTED"
+
+// adminAuthorized checks the bearer token, writing the error response
+// when the request is refused.
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Admin.Token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	if !hasAdminToken(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// hasAdminToken reports whether r carries the configured admin token.
+func hasAdminToken(r *http.Request) bool {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Admin.Token == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(cfg.Admin.Token)) == 1
+}
+
+// redactConfig returns a copy of c with passwords and tokens blanked.
+func redactConfig(c *Config) *Config {
+	out := *c
+	if out.Proxy.Password != "" {
+		out.Proxy.Password = redactedSecret
+	}
+	out.Proxies = make([]NamedProxy, len(c.Proxies))
+	copy(out.Proxies, c.Proxies)
+	for i := range out.Proxies {
+		if out.Proxies[i].Password != "" {
+			out.Proxies[i].Password = redactedSecret
+		}
+	}
+	if out.Admin.Token != "" {
+		out.Admin.Token = redactedSecret
+	}
+	return &out
+}
+
+// handleAdminConfig exports the effective configuration with secrets
+// redacted.
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="config.json"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(redactConfig(LoadAppConfig()))
+}
+
+// handleAdminValidateConfig checks an uploaded config (dry run; nothing is
+// applied) and lists every problem found.
+func handleAdminValidateConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(w, r) {
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Config too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	resp := struct {
+		Valid  bool     `json:"valid"`
+		Errors []string `json:"errors,omitempty"`
+	}{Valid: true}
+	cfg, err := ParseConfig(data)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		resp.Valid = false
+		resp.Errors = strings.Split(err.Error(), "\n")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
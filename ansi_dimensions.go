@@ -0,0 +1,132 @@
+package main
+
+// Column-width detection for ANSI art. SAUCE records are authoritative when
+// present; otherwise the content itself (explicit sizing sequences, cursor
+// positioning, and line lengths) is used to guess the intended width.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+const (
+	sauceRecordLen    = 128
+	sauceDataTypeText = 1
+)
+
+// SAUCEColumns returns the character width recorded in a trailing SAUCE
+// record, if the data carries one for a character/ANSI file.
+func SAUCEColumns(data []byte) (int, bool) {
+	if len(data) < sauceRecordLen {
+		return 0, false
+	}
+	rec := data[len(data)-sauceRecordLen:]
+	if !bytes.HasPrefix(rec, []byte("SAUCE00")) {
+		return 0, false
+	}
+	// DataType at offset 94; TInfo1 (width for character files) at 96
+	if rec[94] != sauceDataTypeText {
+		return 0, false
+	}
+	cols := int(binary.LittleEndian.Uint16(rec[96:98]))
+	if cols <= 0 {
+		return 0, false
+	}
+	return cols, true
+}
+
+// DetectANSIColumns guesses the intended column count of ANSI content.
+// Handles the common cases: a SAUCE width, explicit 132-column sizing
+// (DECCOLM or a CSI 8 t resize), short 40-column C64-style content, and
+// consistent wrapping at 80, with everything else rounded up to 80 or 132.
+func DetectANSIColumns(data []byte) int {
+	if cols, ok := SAUCEColumns(data); ok {
+		return cols
+	}
+
+	maxCol := 0 // widest column reached by text or cursor positioning
+	col := 0
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b == 0x1A: // SUB marks the start of SAUCE/comment trailer
+			i = len(data)
+		case b == '\r':
+			col = 0
+		case b == '\n':
+			// Bare LF keeps the column, matching ANSI.SYS behavior
+		case b == 0x1B && i+1 < len(data) && data[i+1] == '[':
+			j := i + 2
+			for j < len(data) && !(data[j] >= 0x40 && data[j] <= 0x7E) {
+				j++
+			}
+			if j >= len(data) {
+				i = len(data)
+				break
+			}
+			params := string(data[i+2 : j])
+			switch data[j] {
+			case 'h':
+				if params == "?3" { // DECCOLM: 132-column mode
+					return 132
+				}
+			case 't':
+				// CSI 8 ; rows ; cols t - explicit window resize
+				if p := strings.Split(params, ";"); len(p) == 3 && p[0] == "8" {
+					if n, err := strconv.Atoi(p[2]); err == nil && n > 0 {
+						return n
+					}
+				}
+			case 'H', 'f':
+				p := strings.Split(params, ";")
+				col = 0
+				if len(p) >= 2 {
+					if n, err := strconv.Atoi(p[1]); err == nil && n > 0 {
+						col = n - 1
+					}
+				}
+			case 'C':
+				n := 1
+				if v, err := strconv.Atoi(params); err == nil && v > 0 {
+					n = v
+				}
+				col += n
+			case 'D':
+				n := 1
+				if v, err := strconv.Atoi(params); err == nil && v > 0 {
+					n = v
+				}
+				col -= n
+				if col < 0 {
+					col = 0
+				}
+			}
+			if col > maxCol {
+				maxCol = col
+			}
+			i = j
+		case b >= 0x20:
+			col++
+			if col > maxCol {
+				maxCol = col
+			}
+		}
+	}
+
+	switch {
+	case maxCol == 0:
+		return 80
+	case maxCol <= 40:
+		return 40
+	case maxCol <= 80:
+		return 80
+	case maxCol <= 132:
+		return 132
+	default:
+		// Wider than any real mode without explicit sizing: the content
+		// relies on the terminal wrapping lines at 80 columns.
+		return 80
+	}
+}
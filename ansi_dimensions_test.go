@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sauceRecord(cols int) []byte {
+	rec := make([]byte, sauceRecordLen)
+	copy(rec, "SAUCE00")
+	rec[94] = sauceDataTypeText
+	binary.LittleEndian.PutUint16(rec[96:98], uint16(cols))
+	return rec
+}
+
+func TestDetectANSIColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"empty", nil, 80},
+		{"SAUCE width wins", append([]byte("short\r\n\x1a"), sauceRecord(160)...), 160},
+		{"DECCOLM", []byte("\x1b[?3hwide"), 132},
+		{"CSI 8 t resize", []byte("\x1b[8;50;132t"), 132},
+		{"40-column content", []byte(strings.Repeat("x", 40) + "\r\n" + strings.Repeat("y", 12) + "\r\n"), 40},
+		{"80-column lines", []byte(strings.Repeat("x", 79) + "\r\n"), 80},
+		{"cursor positioning past 80", []byte("\x1b[1;120Hx"), 132},
+		{"wrapping at 80", bytes.Repeat([]byte("x"), 400), 80},
+		{"text after SUB ignored", []byte("ab\x1a" + strings.Repeat("x", 100)), 40},
+	}
+	for _, tt := range tests {
+		if got := DetectANSIColumns(tt.data); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCaptureColumnsStoredOnStop(t *testing.T) {
+	cfg := &Config{}
+	cfg.Capture.Enabled = true
+	cfg.Capture.Dir = t.TempDir()
+	useConfig(t, cfg)
+
+	c := &Client{charset: "PETSCII", board: BBSInfo{Name: "C64 board", Host: "c64.example", Port: 6400}}
+	if err := c.StartCapture(captureModeConverted); err != nil {
+		t.Fatal(err)
+	}
+	c.writeCapture(captureModeConverted, []byte(strings.Repeat("x", 40)+"\r\n"+strings.Repeat("y", 38)+"\r\n"))
+	name := c.StopCapture()
+	meta, err := readCaptureMeta(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Cols != 40 {
+		t.Errorf("meta cols = %d, want 40", meta.Cols)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Capture.Dir, filepath.FromSlash(name))); err != nil {
+		t.Errorf("capture file: %v", err)
+	}
+}
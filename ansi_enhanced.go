@@ -3,33 +3,121 @@ package main
 import (
 	"bytes"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// ANSIOptions selects which normalizations ProcessANSIData applies. Each
+// fix helps most boards but breaks a few, so they can be toggled per
+// session (see the "setAnsiOptions" WebSocket message).
+type ANSIOptions struct {
+	Enabled       bool `json:"enabled"`       // master switch for the telnet path (ANSI_NORMALIZE)
+	FormFeedClear bool `json:"formFeedClear"` // FF (0x0C) clears the screen and homes
+	HomeOnClear   bool `json:"homeOnClear"`   // ESC[2J also homes the cursor (ANSI.SYS)
+	EraseDefault  bool `json:"eraseDefault"`  // ESC[J/ESC[K/ESC[m get an explicit 0 parameter
+	NormalizeC1   bool `json:"normalizeC1"`   // 8-bit CSI/OSC/DCS/ST become ESC-prefixed
+	ICEColors     bool `json:"iceColors"`     // blink selects a bright background instead
+}
+
+// DefaultANSIOptions returns the historical behavior: every fix on except
+// iCE colors, with the master switch taken from ANSI_NORMALIZE.
+func DefaultANSIOptions() ANSIOptions {
+	return ANSIOptions{
+		Enabled:       os.Getenv("ANSI_NORMALIZE") != "false",
+		FormFeedClear: true,
+		HomeOnClear:   true,
+		EraseDefault:  true,
+		NormalizeC1:   true,
+	}
+}
+
 // ANSIEnhancedProcessor provides more comprehensive ANSI processing
 type ANSIEnhancedProcessor struct {
 	inSequence    bool
 	sequenceBuffer []byte
+	maxSequence   int // hard cap on sequenceBuffer; overflow is flushed literally
+	maxExpansion  int // output bound as a multiple of input; 0 = unbounded
 	debugMode     bool
+
+	optsMu sync.Mutex // opts is changed from the WebSocket goroutine
+	opts   ANSIOptions
+	utf8   bool // input is UTF-8: 0x80-0x9F are continuation bytes, not C1
+	cur    ANSIOptions // snapshot of opts for the current ProcessANSIData call
+
+	// iCE colors state: blink attribute and the base background (40-47, 0 = default)
+	iceBlink bool
+	iceBg    int
 }
 
-// NewANSIEnhancedProcessor creates a new enhanced processor
-func NewANSIEnhancedProcessor(debug bool) *ANSIEnhancedProcessor {
+// NewANSIEnhancedProcessor creates a new enhanced processor applying the
+// normalizations selected by opts (see DefaultANSIOptions).
+func NewANSIEnhancedProcessor(debug bool, opts ANSIOptions) *ANSIEnhancedProcessor {
 	return &ANSIEnhancedProcessor{
 		sequenceBuffer: make([]byte, 0, 256),
+		maxSequence:    ansiMaxSequenceBytes(),
+		maxExpansion:   ansiMaxExpansion(),
 		debugMode:      debug,
+		opts:           opts,
 	}
 }
 
-// ProcessANSIData processes data with enhanced ANSI handling
+// Options returns the processor's current normalization options.
+func (p *ANSIEnhancedProcessor) Options() ANSIOptions {
+	p.optsMu.Lock()
+	defer p.optsMu.Unlock()
+	return p.opts
+}
+
+// SetOptions replaces the normalization options; takes effect on the next
+// ProcessANSIData call.
+func (p *ANSIEnhancedProcessor) SetOptions(opts ANSIOptions) {
+	p.optsMu.Lock()
+	p.opts = opts
+	p.optsMu.Unlock()
+}
+
+// SetUTF8 records whether the session charset is UTF-8. While it is, C1
+// normalization is skipped whatever the options say: bytes 0x80-0x9F are
+// UTF-8 continuation bytes (the middle of "═" or "Ü"), and rewriting them
+// as ESC-prefixed controls would corrupt the text.
+func (p *ANSIEnhancedProcessor) SetUTF8(on bool) {
+	p.optsMu.Lock()
+	p.utf8 = on
+	p.optsMu.Unlock()
+}
+
+// ProcessANSIData processes data with enhanced ANSI handling.
+//
+// Output can be longer than input: a form feed becomes ESC[2J ESC[H (7x),
+// an 8-bit C1 introducer becomes ESC plus a byte (2x), ED gains a trailing
+// ESC[H under HomeOnClear, and a sequence carried over from the previous
+// call (up to maxSequence bytes) is emitted with this one. Once output
+// reaches maxExpansion times the input plus that carry-over, further
+// expansions are skipped and the original bytes pass through instead, so
+// a crafted stream cannot grow without bound.
 func (p *ANSIEnhancedProcessor) ProcessANSIData(data []byte) []byte {
-    result := make([]byte, 0, len(data)*2) // Extra space for expansions
+    p.optsMu.Lock()
+    p.cur = p.opts
+    if p.utf8 {
+        p.cur.NormalizeC1 = false
+    }
+    p.optsMu.Unlock()
+    result := make([]byte, 0, p.expansionHint(data))
+    limit := -1
+    if p.maxExpansion > 0 {
+        limit = len(data)*p.maxExpansion + p.maxSequence
+    }
+    // fits reports whether n more bytes stay within the bound
+    fits := func(n int) bool { return limit < 0 || len(result)+n <= limit }
     
     for i := 0; i < len(data); i++ {
         b := data[i]
         
         // Normalize 8-bit C1 control codes to 7-bit ESC-prefixed sequences
         // Common mappings: CSI (0x9B) -> ESC '[', OSC (0x9D) -> ESC ']', DCS (0x90) -> ESC 'P', ST (0x9C) -> ESC '\\'
-        if b >= 0x80 && b <= 0x9F {
+        if p.cur.NormalizeC1 && b >= 0x80 && b <= 0x9F {
             switch b {
             case 0x9B: // CSI
                 p.inSequence = true
@@ -65,6 +153,14 @@ func (p *ANSIEnhancedProcessor) ProcessANSIData(data []byte) []byte {
         // Handle special control characters
         switch b {
         case 0x0C: // Form Feed - clear screen and home cursor
+            if !p.cur.FormFeedClear {
+                result = append(result, b)
+                continue
+            }
+            if !fits(7) {
+                result = append(result, b)
+                continue
+            }
             if p.debugMode {
                 log.Printf("ANSI: Form feed detected, converting to ESC[2J ESC[H")
 			}
@@ -101,10 +197,26 @@ func (p *ANSIEnhancedProcessor) ProcessANSIData(data []byte) []byte {
 		if p.inSequence {
 			p.sequenceBuffer = append(p.sequenceBuffer, b)
 			
+			// A sequence that never terminates (e.g. an endless OSC) is
+			// flushed as literal bytes once it reaches the cap
+			if len(p.sequenceBuffer) >= p.maxSequence {
+				if p.debugMode {
+					log.Printf("ANSI: Sequence exceeded %d bytes, flushing literally", p.maxSequence)
+				}
+				result = append(result, p.sequenceBuffer...)
+				p.inSequence = false
+				p.sequenceBuffer = p.sequenceBuffer[:0]
+				continue
+			}
+
 			// Check if sequence is complete
 			if p.isSequenceComplete() {
-				// Process the complete sequence
+				// Process the complete sequence; past the expansion bound
+				// it goes out as received
 				processed := p.processCompleteSequence()
+				if len(processed) > len(p.sequenceBuffer) && !fits(len(processed)) {
+					processed = p.sequenceBuffer
+				}
 				result = append(result, processed...)
 				p.inSequence = false
 				p.sequenceBuffer = p.sequenceBuffer[:0]
@@ -115,14 +227,22 @@ func (p *ANSIEnhancedProcessor) ProcessANSIData(data []byte) []byte {
 		}
 	}
 	
-	// If we have an incomplete sequence at the end, append it as-is
-	if len(p.sequenceBuffer) > 0 {
-		result = append(result, p.sequenceBuffer...)
-	}
+	// An incomplete sequence at the end stays buffered for the next call;
+	// emitting it here too would duplicate its bytes once it completes
 	
 	return result
 }
 
+// expansionHint sizes the output buffer: each form feed grows by 6 bytes
+// when FormFeedClear is on, plus slack for C1 and ED expansions.
+func (p *ANSIEnhancedProcessor) expansionHint(data []byte) int {
+	n := len(data) + len(data)/8 + 16
+	if p.cur.FormFeedClear {
+		n += 6 * bytes.Count(data, []byte{0x0C})
+	}
+	return n
+}
+
 // isSequenceComplete checks if the current sequence buffer contains a complete ANSI sequence
 func (p *ANSIEnhancedProcessor) isSequenceComplete() bool {
 	if len(p.sequenceBuffer) < 2 {
@@ -170,11 +290,7 @@ func (p *ANSIEnhancedProcessor) isSequenceComplete() bool {
 		}
 	}
 	
-	// Prevent buffer overflow - if sequence is too long, consider it complete
-	if len(p.sequenceBuffer) > 100 {
-		return true
-	}
-	
+	// Overlong sequences are bounded by maxSequence in ProcessANSIData
 	return false
 }
 
@@ -183,7 +299,7 @@ func (p *ANSIEnhancedProcessor) processCompleteSequence() []byte {
 	// Check for specific sequences that need fixing
 	
 	// ESC[J without parameter should be ESC[0J (clear from cursor to end)
-	if bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', 'J'}) {
+	if p.cur.EraseDefault && bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', 'J'}) {
 		if p.debugMode {
 			log.Printf("ANSI: Fixed ESC[J to ESC[0J")
 		}
@@ -191,15 +307,27 @@ func (p *ANSIEnhancedProcessor) processCompleteSequence() []byte {
 	}
 	
 	// ESC[K without parameter should be ESC[0K (clear from cursor to end of line)
-	if bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', 'K'}) {
+	if p.cur.EraseDefault && bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', 'K'}) {
 		if p.debugMode {
 			log.Printf("ANSI: Fixed ESC[K to ESC[0K")
 		}
 		return []byte{0x1B, '[', '0', 'K'}
 	}
 	
+	// RIS (ESC c) resets the terminal, including any attributes we track
+	if bytes.Equal(p.sequenceBuffer, []byte{0x1B, 'c'}) {
+		p.iceBlink = false
+		p.iceBg = 0
+		return append([]byte(nil), p.sequenceBuffer...)
+	}
+
+	// iCE colors: rewrite SGR so blink shows as a bright background
+	if p.cur.ICEColors && len(p.sequenceBuffer) >= 3 && p.sequenceBuffer[1] == '[' && p.sequenceBuffer[len(p.sequenceBuffer)-1] == 'm' {
+		return p.iceSGR()
+	}
+
 	// ESC[m without parameter should be ESC[0m (reset)
-	if bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', 'm'}) {
+	if p.cur.EraseDefault && bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', 'm'}) {
 		if p.debugMode {
 			log.Printf("ANSI: Fixed ESC[m to ESC[0m")
 		}
@@ -215,7 +343,7 @@ func (p *ANSIEnhancedProcessor) processCompleteSequence() []byte {
 	}
 	
     // Check for clear screen variations
-    if len(p.sequenceBuffer) >= 4 && p.sequenceBuffer[0] == 0x1B && p.sequenceBuffer[1] == '[' {
+    if p.cur.HomeOnClear && len(p.sequenceBuffer) >= 4 && p.sequenceBuffer[0] == 0x1B && p.sequenceBuffer[1] == '[' {
         // ESC[2J - clear entire screen
         if bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', '2', 'J'}) || bytes.Equal(p.sequenceBuffer, []byte{0x1B, '[', '0', ';', '2', 'J'}) {
             if p.debugMode {
@@ -256,6 +384,81 @@ func (p *ANSIEnhancedProcessor) processCompleteSequence() []byte {
 	return p.sequenceBuffer
 }
 
+// iceSGR rewrites the buffered SGR sequence for iCE colors: blink (5/25)
+// is dropped and, while set, the background is sent as its bright (100-107)
+// variant. Sequences with private or extended parameters pass through.
+func (p *ANSIEnhancedProcessor) iceSGR() []byte {
+	params := string(p.sequenceBuffer[2 : len(p.sequenceBuffer)-1])
+	if strings.ContainsAny(params, "?<=>:") {
+		return p.sequenceBuffer
+	}
+	fields := strings.Split(params, ";")
+	var out []string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		n, err := strconv.Atoi(f)
+		if f == "" {
+			n, err = 0, nil
+		}
+		if err != nil {
+			return p.sequenceBuffer
+		}
+		switch {
+		case n == 38 || n == 48:
+			// Extended color: keep its 5;n or 2;r;g;b arguments verbatim
+			end := i + 1
+			if end < len(fields) {
+				switch fields[end] {
+				case "5":
+					end += 2
+				case "2":
+					end += 4
+				}
+			}
+			if end > len(fields) {
+				end = len(fields)
+			}
+			if n == 48 {
+				p.iceBg = 0
+			}
+			out = append(out, fields[i:end]...)
+			i = end - 1
+		case n == 0:
+			p.iceBlink, p.iceBg = false, 0
+			out = append(out, "0")
+		case n == 5 || n == 6:
+			p.iceBlink = true
+			if p.iceBg != 0 {
+				out = append(out, strconv.Itoa(p.iceBg+60))
+			} else {
+				out = append(out, "100") // bright black over default
+			}
+		case n == 25:
+			p.iceBlink = false
+			if p.iceBg != 0 {
+				out = append(out, strconv.Itoa(p.iceBg))
+			} else {
+				out = append(out, "49")
+			}
+		case n >= 40 && n <= 47:
+			p.iceBg = n
+			if p.iceBlink {
+				n += 60
+			}
+			out = append(out, strconv.Itoa(n))
+		case n == 49:
+			p.iceBg = 0
+			out = append(out, "49")
+		default:
+			out = append(out, strconv.Itoa(n))
+		}
+	}
+	if len(out) == 0 {
+		return p.sequenceBuffer
+	}
+	return []byte("\x1b[" + strings.Join(out, ";") + "m")
+}
+
 // InjectClearScreen injects a proper clear screen sequence
 func (p *ANSIEnhancedProcessor) InjectClearScreen() []byte {
 	if p.debugMode {
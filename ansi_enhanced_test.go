@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestANSISequenceCapFlushesUnterminatedOSC(t *testing.T) {
+	p := NewANSIEnhancedProcessor(false, DefaultANSIOptions())
+	if p.maxSequence != 4096 {
+		t.Fatalf("default cap = %d, want 4096", p.maxSequence)
+	}
+	osc := append([]byte("\x1b]0;"), bytes.Repeat([]byte("A"), 10*1024)...)
+	var out []byte
+	for i := 0; i < len(osc); i += 512 {
+		out = append(out, p.ProcessANSIData(osc[i:min(i+512, len(osc))])...)
+		if len(p.sequenceBuffer) > p.maxSequence || cap(p.sequenceBuffer) > 2*p.maxSequence {
+			t.Fatalf("sequence buffer grew to len %d cap %d", len(p.sequenceBuffer), cap(p.sequenceBuffer))
+		}
+	}
+	// Flushed at the cap, after which the rest is plain text
+	if !bytes.Equal(out, osc) {
+		t.Errorf("flushed %d of %d bytes", len(out), len(osc))
+	}
+	if p.inSequence {
+		t.Error("still in a sequence after the flush")
+	}
+}
+
+func TestANSISequenceCapConfigurable(t *testing.T) {
+	cfg := &Config{}
+	cfg.ANSI.MaxSequenceBytes = 64
+	useConfig(t, cfg)
+	p := NewANSIEnhancedProcessor(false, DefaultANSIOptions())
+	out := p.ProcessANSIData(append([]byte("\x1b]"), bytes.Repeat([]byte("x"), 61)...))
+	if len(out) != 0 {
+		t.Fatalf("flushed %d bytes below the cap", len(out))
+	}
+	out = p.ProcessANSIData(bytes.Repeat([]byte("x"), 37))
+	if len(out) != 100 || p.inSequence || len(p.sequenceBuffer) != 0 {
+		t.Errorf("out %d bytes, inSequence %v, buffered %d", len(out), p.inSequence, len(p.sequenceBuffer))
+	}
+}
+
+func TestANSINormalizationsToggle(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*ANSIOptions, bool)
+		in      string
+		on, off string
+	}{
+		{"form feed clears", func(o *ANSIOptions, v bool) { o.FormFeedClear = v }, "a\x0cb", "a\x1b[2J\x1b[Hb", "a\x0cb"},
+		{"clear homes", func(o *ANSIOptions, v bool) { o.HomeOnClear = v }, "\x1b[2J", "\x1b[2J\x1b[H", "\x1b[2J"},
+		{"erase display default", func(o *ANSIOptions, v bool) { o.EraseDefault = v }, "\x1b[J", "\x1b[0J", "\x1b[J"},
+		{"erase line default", func(o *ANSIOptions, v bool) { o.EraseDefault = v }, "\x1b[K", "\x1b[0K", "\x1b[K"},
+		{"SGR reset default", func(o *ANSIOptions, v bool) { o.EraseDefault = v }, "\x1b[m", "\x1b[0m", "\x1b[m"},
+		{"C1 CSI", func(o *ANSIOptions, v bool) { o.NormalizeC1 = v }, "\x9b1m", "\x1b[1m", "\x9b1m"},
+		{"C1 ST outside a sequence", func(o *ANSIOptions, v bool) { o.NormalizeC1 = v }, "\x9c", "\x1b\\", "\x9c"},
+		{"iCE colors", func(o *ANSIOptions, v bool) { o.ICEColors = v }, "\x1b[41;5m", "\x1b[41;101m", "\x1b[41;5m"},
+	}
+	for _, tt := range tests {
+		for _, on := range []bool{true, false} {
+			// Start from everything off so only this normalization applies
+			var opts ANSIOptions
+			tt.set(&opts, on)
+			want := tt.off
+			if on {
+				want = tt.on
+			}
+			got := string(NewANSIEnhancedProcessor(false, opts).ProcessANSIData([]byte(tt.in)))
+			if got != want {
+				t.Errorf("%s (on=%v): got %q, want %q", tt.name, on, got, want)
+			}
+		}
+	}
+}
+
+func TestANSISetOptionsAppliesNextCall(t *testing.T) {
+	p := NewANSIEnhancedProcessor(false, DefaultANSIOptions())
+	if got := string(p.ProcessANSIData([]byte{0x0c})); got != "\x1b[2J\x1b[H" {
+		t.Fatalf("default form feed: %q", got)
+	}
+	opts := p.Options()
+	opts.FormFeedClear = false
+	p.SetOptions(opts)
+	if got := string(p.ProcessANSIData([]byte{0x0c})); got != "\x0c" {
+		t.Errorf("after SetOptions: %q", got)
+	}
+}
+
+func TestANSIExpansionWorstCase(t *testing.T) {
+	useConfig(t, &Config{})
+	const reps = 1000
+	tests := []struct {
+		name  string
+		unit  string
+		want  string
+		ratio float64
+	}{
+		{"form feed", "\x0c", "\x1b[2J\x1b[H", 7},
+		{"8-bit CSI clear", "\x9b2J", "\x1b[2J\x1b[H", 7.0 / 3},
+		{"clear screen", "\x1b[2J", "\x1b[2J\x1b[H", 7.0 / 4},
+		{"default erase", "\x1b[K", "\x1b[0K", 4.0 / 3},
+		{"plain text", "x", "x", 1},
+	}
+	for _, tt := range tests {
+		p := NewANSIEnhancedProcessor(false, selfTestAllFixes)
+		in := []byte(strings.Repeat(tt.unit, reps))
+		out := p.ProcessANSIData(in)
+		if string(out) != strings.Repeat(tt.want, reps) {
+			t.Errorf("%s: output not fully expanded (%d bytes)", tt.name, len(out))
+			continue
+		}
+		if got := float64(len(out)) / float64(len(in)); got != tt.ratio {
+			t.Errorf("%s: expansion %.2f, want %.2f", tt.name, got, tt.ratio)
+		}
+	}
+}
+
+func TestANSIExpansionHintFitsFormFeeds(t *testing.T) {
+	useConfig(t, &Config{})
+	p := NewANSIEnhancedProcessor(false, selfTestAllFixes)
+	in := append(bytes.Repeat([]byte{0x0c}, 500), "text"...)
+	out := p.ProcessANSIData(in)
+	// The buffer was sized up front, not regrown by append
+	if hint := len(in) + len(in)/8 + 16 + 6*500; cap(out) != hint {
+		t.Errorf("cap %d, want the hint %d (len %d)", cap(out), hint, len(out))
+	}
+}
+
+func TestANSIExpansionBound(t *testing.T) {
+	const feeds = 100
+	expanded := func(k int) string {
+		return strings.Repeat("\x1b[2J\x1b[H", k) + strings.Repeat("\x0c", feeds-k)
+	}
+	tests := []struct {
+		maxExpansion int
+		want         string
+	}{
+		{2, expanded((2*feeds + 64) / 7)}, // expansions stop at the bound
+		{8, expanded(feeds)},
+		{-1, expanded(feeds)}, // unbounded
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		cfg.ANSI.MaxSequenceBytes = 64
+		cfg.ANSI.MaxExpansion = tt.maxExpansion
+		useConfig(t, cfg)
+		p := NewANSIEnhancedProcessor(false, selfTestAllFixes)
+		if got := string(p.ProcessANSIData(bytes.Repeat([]byte{0x0c}, feeds))); got != tt.want {
+			t.Errorf("maxExpansion %d: got %d bytes %q, want %d bytes", tt.maxExpansion, len(got), got, len(tt.want))
+		}
+	}
+}
@@ -6,8 +6,47 @@ package main
 // next ESC (which is presumed to start a new sequence). If a sequence spans
 // chunks, it is buffered until the terminator arrives.
 
+import "encoding/base64"
+
 type AnsiMusicEmitter func(payload string)
 
+// Music emission formats (config ansi.musicFormat). The raw MML is always
+// sent in "message" so the built-in player keeps working; "notes" adds the
+// ParseMML events and "midi" a base64 Standard MIDI File.
+const (
+    musicFormatRaw   = "raw"
+    musicFormatNotes = "notes"
+    musicFormatMIDI  = "midi"
+)
+
+// musicFormat returns the configured emission format (default raw).
+func musicFormat() string {
+    cfg := LoadAppConfig()
+    if cfg != nil && cfg.ANSI.MusicFormat != "" {
+        return cfg.ANSI.MusicFormat
+    }
+    return musicFormatRaw
+}
+
+// musicMessage builds the "music" message for a payload in the given format.
+func musicMessage(payload, format string) Message {
+    msg := Message{Type: "music", Message: payload, Mode: format}
+    if format == musicFormatRaw {
+        return msg
+    }
+    // Malformed music still yields whatever notes could be parsed;
+    // ParseMML logs the details under ANSI_DEBUG
+    notes, _ := ParseMML(payload)
+    switch format {
+    case musicFormatNotes:
+        msg.Notes = notes
+    case musicFormatMIDI:
+        msg.Data = base64.StdEncoding.EncodeToString(notesToMIDI(notes))
+        msg.Encoding = "base64"
+    }
+    return msg
+}
+
 type AnsiMusicProcessor struct {
     emit   AnsiMusicEmitter
     inSeq  bool
@@ -0,0 +1,107 @@
+package main
+
+// ANSI-detection prompt auto-responder. Many boards open with "Do you want
+// ANSI graphics? [Y/n]" and wait; for boards that opt in, the first match
+// early in the session is answered automatically.
+
+import (
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// ansiPromptWindow is how long after connecting a prompt is answered
+	ansiPromptWindow = 45 * time.Second
+	// ansiPromptTail bounds the text kept to match prompts split across reads
+	ansiPromptTail = 256
+)
+
+// defaultANSIPromptPatterns match the common ANSI-detection prompts.
+var defaultANSIPromptPatterns = []string{
+	`(?i)ansi[^\r\n]{0,40}\?[^\r\n]{0,12}[\[(]\s*y`,
+	`(?i)(want|use|enable|support)[^\r\n]{0,20}(ansi|colou?r)[^\r\n]{0,30}[\[(]\s*y`,
+	`(?i)ansi[^\r\n]{0,20}\(y/n\)`,
+}
+
+var (
+	ansiPromptOnce     sync.Once
+	ansiPromptPatterns []*regexp.Regexp
+)
+
+// ansiPromptRegexps compiles the configured patterns once, falling back to
+// the defaults; invalid patterns are logged and skipped.
+func ansiPromptRegexps() []*regexp.Regexp {
+	ansiPromptOnce.Do(func() {
+		src := defaultANSIPromptPatterns
+		cfg := LoadAppConfig()
+		if cfg != nil && len(cfg.Terminal.ANSIPromptPatterns) > 0 {
+			src = cfg.Terminal.ANSIPromptPatterns
+		}
+		for _, p := range src {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Printf("ANSI prompt: ignoring invalid pattern %q: %v", p, err)
+				continue
+			}
+			ansiPromptPatterns = append(ansiPromptPatterns, re)
+		}
+	})
+	return ansiPromptPatterns
+}
+
+// ansiPromptResponse returns the keystrokes sent to an ANSI prompt
+// (default "Y").
+func ansiPromptResponse() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Terminal.ANSIPromptResponse != "" {
+		return cfg.Terminal.ANSIPromptResponse
+	}
+	return "Y"
+}
+
+// watchANSIPrompt scans board text for an ANSI-detection prompt and answers
+// it once per connection, only within ansiPromptWindow of connecting.
+func (c *Client) watchANSIPrompt(data []byte) {
+	c.mu.Lock()
+	if !c.board.AutoANSI || c.ansiPromptDone || len(data) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	if time.Since(c.connectedAt) > ansiPromptWindow {
+		c.ansiPromptDone = true
+		c.ansiPromptText = nil
+		c.mu.Unlock()
+		return
+	}
+	c.ansiPromptText = append(c.ansiPromptText, data...)
+	if len(c.ansiPromptText) > ansiPromptTail {
+		c.ansiPromptText = c.ansiPromptText[len(c.ansiPromptText)-ansiPromptTail:]
+	}
+	text := c.ansiPromptText
+	matched := false
+	for _, re := range ansiPromptRegexps() {
+		if re.Match(text) {
+			matched = true
+			break
+		}
+	}
+	if matched {
+		c.ansiPromptDone = true
+		c.ansiPromptText = nil
+	}
+	c.mu.Unlock()
+
+	if matched {
+		resp := ansiPromptResponse()
+		log.Printf("ANSI prompt detected; answering %q", resp)
+		c.sendToRemote(resp)
+	}
+}
+
+// resetANSIPrompt arms the responder for a new connection; caller holds c.mu.
+func (c *Client) resetANSIPrompt() {
+	c.ansiPromptDone = false
+	c.ansiPromptText = nil
+}
@@ -0,0 +1,42 @@
+package main
+
+// ENQ answerback. DEC-style terminals reply to ENQ (0x05) with a fixed
+// identification string; a few boards and door games use it to recognize
+// the terminal. Off unless the board (or config) sets a string.
+
+import (
+	"bytes"
+	"log"
+)
+
+const asciiENQ = 0x05
+
+// answerbackFor returns the answerback for a board: its own, else config
+// terminal.answerback, else "" (no reply).
+func answerbackFor(board BBSInfo) string {
+	if board.Answerback != "" {
+		return board.Answerback
+	}
+	if cfg := LoadAppConfig(); cfg != nil {
+		return boardEscapes.Replace(cfg.Terminal.Answerback)
+	}
+	return ""
+}
+
+// answerENQ replies with the answerback once per ENQ found in board output.
+func (c *Client) answerENQ(data []byte) {
+	n := bytes.Count(data, []byte{asciiENQ})
+	if n == 0 {
+		return
+	}
+	c.mu.Lock()
+	answer := answerbackFor(c.board)
+	c.mu.Unlock()
+	if answer == "" {
+		return
+	}
+	log.Printf("Terminal: answering ENQ with answerback (%d)", n)
+	for i := 0; i < n; i++ {
+		c.sendToRemote(answer)
+	}
+}
@@ -5,26 +5,85 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"os/exec"
 )
 
-type ConfigResponse struct{}
+// protocolVersion identifies the WebSocket message protocol; it changes
+// only when existing messages change meaning, not when new ones are added.
+const protocolVersion = 1
+
+// ConfigResponse tells the frontend what this server supports and how to
+// set itself up. It holds nothing secret: no proxy credentials or paths.
+type ConfigResponse struct {
+	ProtocolVersion int            `json:"protocolVersion"`
+	Features        FeatureFlags   `json:"features"`
+	Charsets        []CharsetInfo  `json:"charsets"`
+	Protocols       []string       `json:"protocols"`
+	TerminalSizes   []TerminalSize `json:"terminalSizes"`
+	// AllowManualConnect is always false: connections are limited to the
+	// directory
+	AllowManualConnect bool   `json:"allowManualConnect"`
+	ProxyEnabled       bool   `json:"proxyEnabled"`
+	ExternalBaseURL    string `json:"externalBaseURL,omitempty"`
+}
+
+// FeatureFlags reports optional features as currently configured.
+type FeatureFlags struct {
+	Music            bool `json:"music"`            // "music" messages
+	Download         bool `json:"download"`         // ZMODEM receive (rz on PATH)
+	Upload           bool `json:"upload"`           // ZMODEM send (sz on PATH)
+	ChunkedDownloads bool `json:"chunkedDownloads"` // fileDownloadStart/Chunk/End
+	ManualDownload   bool `json:"manualDownload"`   // "startDownload"
+	Capture          bool `json:"capture"`          // capture.enabled
+	Resume           bool `json:"resume"`           // ?resume= reconnects
+	ScreenText       bool `json:"screenText"`       // terminal.virtualScreen
+	BellMessages     bool `json:"bellMessages"`     // terminal.bellMessages
+	Events           bool `json:"events"`           // "subscribeEvents"
+}
+
+// currentFeatures evaluates the feature flags against the live config.
+func currentFeatures() FeatureFlags {
+	_, rzErr := exec.LookPath("rz")
+	_, szErr := exec.LookPath("sz")
+	return FeatureFlags{
+		Music:            true,
+		Download:         rzErr == nil,
+		Upload:           szErr == nil,
+		ChunkedDownloads: true,
+		ManualDownload:   rzErr == nil,
+		Capture:          capturesEnabled(),
+		Resume:           resumeWindow() > 0,
+		ScreenText:       screenModelEnabled(),
+		BellMessages:     bellMessagesEnabled(),
+		Events:           true,
+	}
+}
 
 type BBSListResponse struct {
 	Success bool      `json:"success"`
 	BBSList []BBSInfo `json:"bbsList"`
 }
 
-// handleGetConfig responds with a minimal, public-safe configuration payload.
-// The app is stateless; this endpoint exists for forward compatibility.
+// handleGetConfig responds with a public-safe configuration payload: the
+// protocol version, feature flags, supported charsets and protocols, the
+// offered terminal sizes and a few public server settings.
 func handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	config := ConfigResponse{}
-
-	// Stateless-only: return minimal config
+	config := ConfigResponse{
+		ProtocolVersion: protocolVersion,
+		Features:        currentFeatures(),
+		Charsets:        supportedCharsets,
+		Protocols:       []string{"telnet", "ssh"},
+		TerminalSizes:   terminalSizes,
+	}
+	if cfg := LoadAppConfig(); cfg != nil {
+		config.ProxyEnabled = cfg.Proxy.Enabled
+		config.ExternalBaseURL = cfg.Server.ExternalBaseURL
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(config)
@@ -49,6 +108,20 @@ func handleGetDefaultBBSList(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleGetCharsets returns the charsets the server implements
+func handleGetCharsets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"charsets": supportedCharsets,
+	})
+}
+
 // handleGetBBSBySlug returns BBS information based on slug
 func handleGetBBSBySlug(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -78,16 +151,7 @@ func handleGetBBSBySlug(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert to BBSInfo format for client
-	bbsInfo := BBSInfo{
-		ID:          bbs.ID,
-		Name:        bbs.Name,
-		Host:        bbs.Host,
-		Port:        bbs.Port,
-		Protocol:    bbs.Protocol,
-		Description: bbs.Description,
-		Encoding:    bbs.Encoding,
-		Location:    bbs.Location,
-	}
+	bbsInfo := bbs.Info()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(bbsInfo)
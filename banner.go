@@ -0,0 +1,110 @@
+package main
+
+// Per-board ANSI banners for directory cards. A bbs.csv "Banner" cell is
+// either short inline ANSI text (escapes allowed) or the name of a CP437
+// .ans/.asc file in the banners directory. /api/bbs-banner?id= returns it
+// normalized and converted to UTF-8, ready for a terminal widget.
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bannerDir returns the banner art directory (default "banners").
+func bannerDir() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Banners.Dir != "" {
+		return cfg.Banners.Dir
+	}
+	return "banners"
+}
+
+// bannerMaxBytes returns the largest banner served (default 16KB).
+func bannerMaxBytes() int {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Banners.MaxBytes > 0 {
+		return cfg.Banners.MaxBytes
+	}
+	return 16 << 10
+}
+
+// isBannerFile reports whether a Banner cell names an art file rather than
+// holding inline text.
+func isBannerFile(banner string) bool {
+	if strings.ContainsAny(banner, "\r\n\x1b") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(banner)) {
+	case ".ans", ".asc":
+		return true
+	}
+	return false
+}
+
+// loadBanner returns a board's banner as UTF-8 with ANSI normalized.
+func loadBanner(e BBSEntry) (string, error) {
+	if e.Banner == "" {
+		return "", os.ErrNotExist
+	}
+	limit := bannerMaxBytes()
+	if !isBannerFile(e.Banner) {
+		if len(e.Banner) > limit {
+			return "", errors.New("banner too large")
+		}
+		return string(NewANSIEnhancedProcessor(false, DefaultANSIOptions()).ProcessANSIData([]byte(e.Banner))), nil
+	}
+	// Only plain names inside the banners directory
+	if e.Banner != filepath.Base(e.Banner) {
+		return "", errors.New("invalid banner file name")
+	}
+	path := filepath.Join(bannerDir(), e.Banner)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() > int64(limit) {
+		return "", errors.New("banner too large")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Art files end at SUB; the SAUCE record after it is metadata
+	if i := strings.IndexByte(string(raw), 0x1A); i >= 0 {
+		raw = raw[:i]
+	}
+	processed := NewANSIEnhancedProcessor(false, DefaultANSIOptions()).ProcessANSIData(raw)
+	return ConvertCP437ToUTF8Enhanced(processed), nil
+}
+
+// handleGetBBSBanner serves /api/bbs-banner?id=<board id>.
+func handleGetBBSBanner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	entries, err := GetBBSDirectoryEntries()
+	if err != nil {
+		http.Error(w, "Directory unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	for _, e := range entries {
+		if e.ID != id {
+			continue
+		}
+		banner, err := loadBanner(e)
+		if err != nil {
+			http.Error(w, "No banner for this board", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "id": id, "banner": banner})
+		return
+	}
+	http.Error(w, "Unknown BBS id", http.StatusNotFound)
+}
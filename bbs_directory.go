@@ -5,7 +5,9 @@ package main
 import (
     "encoding/csv"
     "fmt"
+    "log"
     "os"
+    "sort"
     "strconv"
     "strings"
     "sync"
@@ -30,11 +32,165 @@ type BBSEntry struct {
 	Active      bool   `json:"active"`
 	IsFavorite  bool   `json:"is_favorite,omitempty"`
 	Slug        string `json:"slug"`
+	// AnnounceCaps sends WILL TTYPE/NAWS/BINARY right after connect for
+	// boards that probe capabilities in a tight window (CSV "Announce")
+	AnnounceCaps bool `json:"announce_caps,omitempty"`
+	// InitCommand is typed to the board shortly after connect, e.g. "\r" to
+	// get past "press any key" prompts (CSV "InitCommand", escapes allowed)
+	InitCommand string `json:"init_command,omitempty"`
+	// ExpandCR turns bare CR into CR LF for boards that rely on the
+	// terminal advancing the line (CSV "ExpandCR"). Only used in telnet
+	// BINARY mode; NVT line endings always follow RFC 854
+	// (telnetLineEndings)
+	ExpandCR bool `json:"expand_cr,omitempty"`
+	// RequiresCPR answers cursor position requests for boards that stall
+	// without a reply (CSV "RequiresCPR")
+	RequiresCPR bool `json:"requires_cpr,omitempty"`
+	// AutoANSI answers the board's "ANSI graphics? [Y/n]" prompt early in
+	// the session (CSV "AutoANSI")
+	AutoANSI bool `json:"auto_ansi,omitempty"`
+	// Profile names a connection profile supplying defaults for the
+	// settings above (CSV "Profile")
+	Profile string `json:"profile,omitempty"`
+	// TermType overrides the SSH PTY terminal type, e.g. "ansi" or "vt100"
+	// (CSV "TermType")
+	TermType string `json:"term_type,omitempty"`
+	// Answerback is sent when the board sends ENQ (CSV "Answerback",
+	// escapes allowed)
+	Answerback string `json:"answerback,omitempty"`
+	// Identity is the terminal reported in DA replies, e.g. "vt220"
+	// (CSV "Identity")
+	Identity string `json:"identity,omitempty"`
+	// Handshake is sent raw right after connect for boards that expect
+	// the terminal to announce itself (CSV "Handshake", escapes allowed)
+	Handshake string `json:"handshake,omitempty"`
+	// AddedAt is when the board was listed (CSV "Added", RFC 3339 or
+	// YYYY-MM-DD); the importer stamps new boards
+	AddedAt time.Time `json:"added_at,omitzero"`
+	// Banner is short inline ANSI art or an .ans file in the banners
+	// directory (CSV "Banner"); served by /api/bbs-banner
+	Banner    string `json:"-"`
+	HasBanner bool   `json:"has_banner,omitempty"`
+	// ZmodemEscape runs rz with -e: "yes", "no", or "auto" when telnet
+	// BINARY is refused (CSV "ZmodemEscape")
+	ZmodemEscape string `json:"zmodem_escape,omitempty"`
+	// Fallback is a telnet endpoint tried when the SSH one fails, as
+	// "telnet://host:port" (CSV "Fallback")
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Info converts a directory entry to the BBSInfo form used by sessions and
+// the client-facing API.
+func (e BBSEntry) Info() BBSInfo {
+	return BBSInfo{
+		ID:           e.ID,
+		Name:         e.Name,
+		Host:         e.Host,
+		Port:         e.Port,
+		Protocol:     strings.ToLower(e.Protocol),
+		Description:  e.Description,
+		Encoding:     e.Encoding,
+		Location:     e.Location,
+		AnnounceCaps: e.AnnounceCaps,
+		InitCommand:  e.InitCommand,
+		ExpandCR:     e.ExpandCR,
+		RequiresCPR:  e.RequiresCPR,
+		AutoANSI:     e.AutoANSI,
+		Profile:      e.Profile,
+		TermType:     e.TermType,
+		Answerback:   e.Answerback,
+		Identity:     e.Identity,
+		ZmodemEscape: e.ZmodemEscape,
+		Handshake:    e.Handshake,
+		Fallback:     e.Fallback,
+	}
+}
+
+// defaultPort returns the well-known port for a board protocol.
+func defaultPort(protocol string) int {
+	switch strings.ToLower(protocol) {
+	case "ssh":
+		return 22
+	case "rlogin":
+		return 513
+	default:
+		return 23
+	}
+}
+
+// parseBoardAddress splits "[scheme://][user@]host[:port]" into host, port
+// and protocol. The protocol comes from the scheme, else protocol, else
+// telnet; a missing or invalid port defaults by protocol.
+func parseBoardAddress(address, protocol string) (string, int, string) {
+	if i := strings.Index(address, "://"); i != -1 {
+		if protocol == "" {
+			protocol = address[:i]
+		}
+		address = address[i+3:]
+	}
+	if i := strings.LastIndex(address, "@"); i != -1 {
+		address = address[i+1:]
+	}
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	if protocol == "" {
+		protocol = "telnet"
+	}
+	host, port := address, defaultPort(protocol)
+	if i := strings.LastIndex(address, ":"); i != -1 {
+		host = address[:i]
+		if p, err := strconv.Atoi(address[i+1:]); err == nil && p > 0 {
+			port = p
+		}
+	}
+	return host, port, protocol
+}
+
+// boardEscapes decodes the escapes allowed in per-board byte strings.
+var boardEscapes = strings.NewReplacer(`\r`, "\r", `\n`, "\n", `\e`, "\x1b", `\t`, "\t", `\\`, `\`)
+
+// csvString returns an optional CSV column value with escapes decoded.
+func csvString(record []string, idx map[string]int, column string) string {
+	i, ok := idx[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return boardEscapes.Replace(strings.TrimSpace(record[i]))
+}
+
+// csvTime parses an optional date column (RFC 3339 or YYYY-MM-DD); missing
+// or unparseable cells read as the zero time.
+func csvTime(record []string, idx map[string]int, column string) time.Time {
+	i, ok := idx[column]
+	if !ok || i >= len(record) {
+		return time.Time{}
+	}
+	v := strings.TrimSpace(record[i])
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// csvFlag reports whether an optional boolean CSV column is set for record.
+// Missing columns and empty cells read as false.
+func csvFlag(record []string, idx map[string]int, column string) bool {
+	i, ok := idx[column]
+	if !ok || i >= len(record) {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(record[i])) {
+	case "1", "true", "yes", "y":
+		return true
+	}
+	return false
 }
 
 // LoadBBSFromCSV loads BBS entries from a CSV file with header
-// [Name, Software, Telnet Server Address]. Address may be host or host:port.
-// Missing ports default to 23 (telnet). Invalid rows are skipped.
+// [Name, Software, Telnet Server Address]. Address may be host, host:port or
+// scheme://host:port; an optional Protocol column also sets the protocol.
+// Missing ports default by protocol (see defaultPort). Invalid rows are skipped.
 func LoadBBSFromCSV(filename string) ([]BBSEntry, error) {
     file, err := os.Open(filename)
     if err != nil {
@@ -95,18 +251,8 @@ func LoadBBSFromCSV(filename string) ([]BBSEntry, error) {
             continue
         }
 
-        // Parse address (host:port)
-        host := address
-        port := 23 // default telnet port
-
-        if idx := strings.LastIndex(address, ":"); idx != -1 {
-            host = address[:idx]
-            if portStr := address[idx+1:]; portStr != "" {
-                if p, err := strconv.Atoi(portStr); err == nil {
-                    port = p
-                }
-            }
-        }
+        // Parse address ([scheme://]host[:port]); the port defaults by protocol
+        host, port, protocol := parseBoardAddress(address, csvString(record, idx, "Protocol"))
 
         // Generate ID from name (lowercase, replace spaces with underscores)
         id := strings.ToLower(name)
@@ -131,15 +277,36 @@ func LoadBBSFromCSV(filename string) ([]BBSEntry, error) {
             Name:        name,
             Host:        host,
             Port:        port,
-            Protocol:    "telnet",
+            Protocol:    protocol,
             Description: fmt.Sprintf("%s BBS", name),
             Encoding:    "CP437",
             Software:    software,
             Location:    location,
             Active:      true,
             Slug:        GenerateSlug(name),
+            AnnounceCaps: csvFlag(record, idx, "Announce"),
+            InitCommand:  csvString(record, idx, "InitCommand"),
+            ExpandCR:     csvFlag(record, idx, "ExpandCR"),
+            RequiresCPR:  csvFlag(record, idx, "RequiresCPR"),
+            AutoANSI:     csvFlag(record, idx, "AutoANSI"),
+            Profile:      csvString(record, idx, "Profile"),
+            TermType:     csvString(record, idx, "TermType"),
+            Answerback:   csvString(record, idx, "Answerback"),
+            Identity:     csvString(record, idx, "Identity"),
+            ZmodemEscape: csvString(record, idx, "ZmodemEscape"),
+            Handshake:    csvString(record, idx, "Handshake"),
+            AddedAt:      csvTime(record, idx, "Added"),
+            Banner:       csvString(record, idx, "Banner"),
+            Fallback:     csvString(record, idx, "Fallback"),
+        }
+        if entry.Fallback != "" {
+            if _, _, err := parseFallback(entry.Fallback); err != nil || entry.Protocol != "ssh" {
+                log.Printf("bbs.csv: ignoring Fallback for %s: only SSH boards with telnet://host:port fall back", entry.Name)
+                entry.Fallback = ""
+            }
         }
 
+        entry.HasBanner = entry.Banner != ""
         entries = append(entries, entry)
     }
 
@@ -192,3 +359,44 @@ func GetBBSDirectoryEntries() ([]BBSEntry, error) {
     copy(out, entries)
     return out, nil
 }
+
+// sortBBSEntries orders entries in place by field ("name", "software",
+// "location" or "port"; empty means name) and order ("asc" or "desc"; empty
+// means asc). Text keys compare case-insensitively; equal keys keep their
+// CSV order.
+func sortBBSEntries(entries []BBSEntry, field, order string) error {
+    var less func(a, b *BBSEntry) int
+    text := func(key func(*BBSEntry) string) func(a, b *BBSEntry) int {
+        return func(a, b *BBSEntry) int {
+            return strings.Compare(strings.ToLower(key(a)), strings.ToLower(key(b)))
+        }
+    }
+    switch strings.ToLower(field) {
+    case "", "name":
+        less = text(func(e *BBSEntry) string { return e.Name })
+    case "software":
+        less = text(func(e *BBSEntry) string { return e.Software })
+    case "location":
+        less = text(func(e *BBSEntry) string { return e.Location })
+    case "port":
+        less = func(a, b *BBSEntry) int { return a.Port - b.Port }
+    default:
+        return fmt.Errorf("unknown sort field %q", field)
+    }
+    desc := false
+    switch strings.ToLower(order) {
+    case "", "asc":
+    case "desc":
+        desc = true
+    default:
+        return fmt.Errorf("unknown sort order %q", order)
+    }
+    sort.SliceStable(entries, func(i, j int) bool {
+        c := less(&entries[i], &entries[j])
+        if desc {
+            return c > 0
+        }
+        return c < 0
+    })
+    return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseBoardAddressDefaultPorts(t *testing.T) {
+	tests := []struct {
+		address, protocol string
+		host              string
+		port              int
+		wantProtocol      string
+	}{
+		{"bbs.example.com", "", "bbs.example.com", 23, "telnet"},
+		{"bbs.example.com", "telnet", "bbs.example.com", 23, "telnet"},
+		{"bbs.example.com", "SSH", "bbs.example.com", 22, "ssh"},
+		{"bbs.example.com", "rlogin", "bbs.example.com", 513, "rlogin"},
+		{"telnet://bbs.example.com", "", "bbs.example.com", 23, "telnet"},
+		{"ssh://bbs.example.com", "", "bbs.example.com", 22, "ssh"},
+		{"rlogin://guest@bbs.example.com", "", "bbs.example.com", 513, "rlogin"},
+		{"ssh://bbs.example.com:2222", "", "bbs.example.com", 2222, "ssh"},
+		{"bbs.example.com:bogus", "ssh", "bbs.example.com", 22, "ssh"},
+		{"telnet://bbs.example.com", "ssh", "bbs.example.com", 22, "ssh"}, // explicit protocol wins
+	}
+	for _, tt := range tests {
+		host, port, protocol := parseBoardAddress(tt.address, tt.protocol)
+		if host != tt.host || port != tt.port || protocol != tt.wantProtocol {
+			t.Errorf("parseBoardAddress(%q, %q) = %q, %d, %q; want %q, %d, %q",
+				tt.address, tt.protocol, host, port, protocol, tt.host, tt.port, tt.wantProtocol)
+		}
+	}
+}
+
+// boardPorts maps entry names to "protocol:port" for compact comparisons.
+func boardPorts(entries []BBSEntry) map[string]string {
+	out := make(map[string]string, len(entries))
+	for _, e := range entries {
+		out[e.Name] = e.Protocol + ":" + strconv.Itoa(e.Port)
+	}
+	return out
+}
+
+func TestLoadBBSFromCSVDefaultPorts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bbs.csv")
+	csv := "Name,Software,Telnet Server Address,Protocol\n" +
+		"Plain,Mystic,plain.example.com,\n" +
+		"Scheme SSH,Mystic,ssh://sshboard.example.com,\n" +
+		"Column SSH,Mystic,column.example.com,ssh\n" +
+		"Rlogin,Synchronet,rlogin://rl.example.com,\n" +
+		"Explicit,Synchronet,ssh://x.example.com:2022,\n"
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := LoadBBSFromCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Plain":      "telnet:23",
+		"Scheme SSH": "ssh:22",
+		"Column SSH": "ssh:22",
+		"Rlogin":     "rlogin:513",
+		"Explicit":   "ssh:2022",
+	}
+	got := boardPorts(entries)
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s: got %q, want %q", name, got[name], w)
+		}
+	}
+}
+
+const bbsGuideSample = `  Plain Board
+Software: Mystic
+Telnet: plain.example.com
+------------------------------
+  Secure Board
+Software: Synchronet
+Telnet: ssh://secure.example.com
+------------------------------
+  Remote Board
+Software: Synchronet
+Telnet: rlogin://guest@remote.example.com
+------------------------------
+  Custom Board
+Software: Enigma
+Telnet: custom.example.com:6023
+------------------------------
+`
+
+func TestParseBBSGuideDefaultPorts(t *testing.T) {
+	got := boardPorts(parseBBSGuide(bbsGuideSample))
+	want := map[string]string{
+		"Plain Board":  "telnet:23",
+		"Secure Board": "ssh:22",
+		"Remote Board": "rlogin:513",
+		"Custom Board": "telnet:6023",
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s: got %q, want %q (all: %v)", name, got[name], w, got)
+		}
+	}
+}
+
+// TestImportBBSGuideKeepsProtocol round-trips guide entries through the
+// import endpoint and bbs.csv, so non-telnet boards keep their protocol and
+// default port.
+func TestImportBBSGuideKeepsProtocol(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saved := ApprovedBBSList
+	t.Cleanup(func() { ApprovedBBSList = saved })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/import-bbs-guide", strings.NewReader(bbsGuideSample))
+	rec := httptest.NewRecorder()
+	handleImportBBSGuide(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	entries, err := LoadBBSFromCSV("bbs.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := boardPorts(entries)
+	want := map[string]string{
+		"Plain Board":  "telnet:23",
+		"Secure Board": "ssh:22",
+		"Remote Board": "rlogin:513",
+		"Custom Board": "telnet:6023",
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s: got %q, want %q", name, got[name], w)
+		}
+	}
+}
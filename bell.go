@@ -0,0 +1,48 @@
+package main
+
+// Terminal bell events. With terminal.bellMessages on, board BELs also
+// produce a "bell" message so the browser can give a consistent audible or
+// visual bell and count them, whatever xterm.js does with the BEL itself.
+// A BEL that terminates an OSC string (ESC ] ... BEL) is not a bell.
+
+// bellState follows OSC strings across reads (telnet read goroutine only).
+type bellState struct {
+	esc   bool // previous byte was ESC
+	inOSC bool // inside ESC ] ... terminated by BEL or ST
+}
+
+// bellMessagesEnabled reports whether BELs produce "bell" messages.
+func bellMessagesEnabled() bool {
+	cfg := LoadAppConfig()
+	return cfg != nil && cfg.Terminal.BellMessages
+}
+
+// countBells returns how many BELs in data ring the bell.
+func countBells(data []byte, st *bellState) int {
+	n := 0
+	for _, b := range data {
+		switch {
+		case st.inOSC:
+			if b == 0x07 || (st.esc && b == '\\') {
+				st.inOSC = false
+			}
+		case st.esc && b == ']':
+			st.inOSC = true
+		case b == 0x07:
+			n++
+		}
+		st.esc = b == 0x1B
+	}
+	return n
+}
+
+// notifyBells sends one "bell" message for the BELs in a chunk of board
+// output, with the count.
+func (c *Client) notifyBells(data []byte) {
+	if !bellMessagesEnabled() {
+		return
+	}
+	if n := countBells(data, &c.bell); n > 0 {
+		c.sendJSON(Message{Type: "bell", Count: n})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Representative board output: ANSI art (CP437 blocks with dense SGR),
+// plain menu text, a pathological stream of escape sequences that are
+// never completed within a read, and telnet data with escaped IACs
+// (negotiation is left out: repeating it trips the loop guard).
+var (
+	benchANSIArt = bytes.Repeat([]byte("\x1b[0;1;33;44m\xdb\xdb\xb2\xb1\xb0\x1b[31m\xc9\xcd\xcd\xbb\x1b[12C\x1b[5;40H\xdc\xdf"), 256)
+	benchPlain   = bytes.Repeat([]byte("Welcome to the board! Press [M] for messages, [F] for files.\r\n"), 128)
+	benchPartial = bytes.Repeat([]byte("\x1b[1;3"), 2048)
+	benchTelnet  = bytes.Repeat([]byte("menu text \xff\xff\xdb\xdb escaped IAC\r\n"), 512)
+)
+
+func benchmarkANSI(b *testing.B, data []byte) {
+	p := NewANSIEnhancedProcessor(false, selfTestAllFixes)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.ProcessANSIData(data)
+	}
+}
+
+func BenchmarkProcessANSIDataArt(b *testing.B)     { benchmarkANSI(b, benchANSIArt) }
+func BenchmarkProcessANSIDataPlain(b *testing.B)   { benchmarkANSI(b, benchPlain) }
+func BenchmarkProcessANSIDataPartial(b *testing.B) { benchmarkANSI(b, benchPartial) }
+
+func BenchmarkProcessTelnetData(b *testing.B) {
+	c := &Client{}
+	b.SetBytes(int64(len(benchTelnet)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.processTelnetData(benchTelnet)
+	}
+}
+
+func BenchmarkConvertCP437ToUTF8(b *testing.B) {
+	b.SetBytes(int64(len(benchANSIArt)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ConvertCP437ToUTF8Enhanced(benchANSIArt)
+	}
+}
+
+func BenchmarkConvertUTF8ToCP437(b *testing.B) {
+	s := ConvertCP437ToUTF8Enhanced(benchANSIArt)
+	b.SetBytes(int64(len(s)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ConvertUTF8ToCP437Enhanced(s)
+	}
+}
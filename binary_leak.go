@@ -0,0 +1,76 @@
+package main
+
+// Undetected transfer safety net. When ZMODEM signature detection misses a
+// transfer, its binary stream would be rendered as a screen of junk. Text
+// and ANSI use only a handful of control bytes, so a sustained run of
+// output dense in other control bytes is taken as leaked binary data: it is
+// dropped and the browser gets one "binaryDataWarning" per run. Off unless
+// configured: CP437 art draws glyphs (faces, suits, arrows) with those same
+// control bytes.
+
+import "log"
+
+// binaryLeakMinChunk is the smallest read judged on its own; smaller reads
+// neither start nor end a run.
+const binaryLeakMinChunk = 64
+
+// binaryLeakThreshold returns how many bytes of binary-looking output in a
+// row trigger the warning (config transfer.binaryLeakBytes); 0 when the
+// check is off, the default.
+func binaryLeakThreshold() int {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Transfer.BinaryLeakBytes < 0 {
+		return 0
+	}
+	return cfg.Transfer.BinaryLeakBytes
+}
+
+// binaryLeakState tracks the current run (telnet read goroutine only).
+type binaryLeakState struct {
+	run    int  // binary-looking bytes in a row
+	warned bool // warning sent for this run
+}
+
+// binaryJunk counts control bytes that text and ANSI output do not use
+// (everything below 0x20 except BEL, BS, TAB, LF, FF, CR and ESC, plus DEL).
+func binaryJunk(data []byte) int {
+	n := 0
+	for _, b := range data {
+		switch {
+		case b == 0x07, b == 0x08, b == 0x09, b == 0x0A, b == 0x0C, b == 0x0D, b == 0x1B:
+		case b < 0x20, b == 0x7F:
+			n++
+		}
+	}
+	return n
+}
+
+// checkBinaryLeak reports whether data should be dropped as leaked binary.
+func (c *Client) checkBinaryLeak(data []byte, charset string) bool {
+	limit := binaryLeakThreshold()
+	if limit <= 0 || isPETSCIICharset(charset) {
+		return false
+	}
+	s := &c.binaryLeak
+	junk := binaryJunk(data)
+	if len(data) < binaryLeakMinChunk {
+		return s.run >= limit && junk > 0
+	}
+	// Random binary has about 10% such bytes, ZMODEM-escaped data a bit
+	// less; text has essentially none
+	if junk*16 < len(data) {
+		*s = binaryLeakState{}
+		return false
+	}
+	s.run += len(data)
+	if s.run < limit {
+		return false
+	}
+	if !s.warned {
+		s.warned = true
+		log.Printf("Suppressing %d+ bytes of binary-looking output (undetected transfer?)", s.run)
+		c.sendMessage("binaryDataWarning", "The board is sending binary data, perhaps a file transfer that was not detected. It is hidden to keep the screen readable.")
+		c.emitEvent(eventTransfer, "binary output suppressed")
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// cp437GlyphArt is CP437 art drawn with control-range glyphs: faces, card
+// suits, arrows and triangles, as BBS menus and logos often are.
+func cp437GlyphArt(n int) []byte {
+	glyphs := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x0E, 0x0F, 0x10, 0x11, 0x18, 0x19, 0x1A, 0x1B, 0x1E, 0x1F}
+	out := make([]byte, 0, n)
+	for i := 0; len(out) < n; i++ {
+		if g := glyphs[i%len(glyphs)]; g != 0x1B {
+			out = append(out, g, ' ')
+		}
+	}
+	return out[:n]
+}
+
+func randomBinary(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func TestBinaryLeakOffByDefault(t *testing.T) {
+	useConfig(t, &Config{})
+	c := &Client{sink: func(Message) {}}
+	for i := 0; i < 4; i++ {
+		if c.checkBinaryLeak(randomBinary(4096), "CP437") {
+			t.Fatal("binary dropped with the check off")
+		}
+		if c.checkBinaryLeak(cp437GlyphArt(4096), "CP437") {
+			t.Fatal("CP437 art dropped with the check off")
+		}
+	}
+}
+
+func TestBinaryLeakWhenEnabled(t *testing.T) {
+	cfg := &Config{}
+	cfg.Transfer.BinaryLeakBytes = 4096
+	useConfig(t, cfg)
+	var warnings int
+	c := &Client{sink: func(m Message) {
+		if m.Type == "binaryDataWarning" {
+			warnings++
+		}
+	}}
+	var dropped []bool
+	for i := 0; i < 3; i++ {
+		dropped = append(dropped, c.checkBinaryLeak(randomBinary(2048), "CP437"))
+	}
+	if want := []bool{false, true, true}; !slices.Equal(dropped, want) {
+		t.Errorf("binary chunks dropped %v, want %v", dropped, want)
+	}
+	if warnings != 1 {
+		t.Errorf("%d warnings, want 1 per run", warnings)
+	}
+	// Text ends the run
+	if c.checkBinaryLeak(bytes.Repeat([]byte("Welcome back!\r\n"), 10), "CP437") {
+		t.Error("text dropped")
+	}
+	if c.checkBinaryLeak(randomBinary(2048), "CP437") {
+		t.Error("a new run dropped before reaching the threshold")
+	}
+	// PETSCII uses control bytes for colors and cursor moves
+	p := &Client{sink: func(Message) {}}
+	for i := 0; i < 4; i++ {
+		if p.checkBinaryLeak(randomBinary(2048), "PETSCIIU") {
+			t.Fatal("PETSCII output dropped")
+		}
+	}
+}
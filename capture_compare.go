@@ -0,0 +1,130 @@
+package main
+
+// Capture comparison. Byte mode reports where two captures first diverge,
+// for protocol-level debugging; lines mode replays both through the
+// virtual terminal and reports which displayed lines differ, which is
+// steadier for ANSI art where one shifted byte changes everything after it.
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxCompareDiffs bounds the differing lines listed in one response.
+const maxCompareDiffs = 1000
+
+// compareBytes returns the offset of the first byte that differs between a
+// and b, or -1 if they are identical.
+func compareBytes(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return n
+	}
+	return -1
+}
+
+// LineDiff is one line that differs between two captures. Line is 1-based;
+// a side past the end of its capture is omitted.
+type LineDiff struct {
+	Line int     `json:"line"`
+	A    *string `json:"a,omitempty"`
+	B    *string `json:"b,omitempty"`
+}
+
+// compareLines lists lines that differ position by position, at most limit
+// of them, and the total number that differ.
+func compareLines(a, b []string, limit int) ([]LineDiff, int) {
+	diffs := []LineDiff{}
+	count := 0
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var la, lb *string
+		if i < len(a) {
+			la = &a[i]
+		}
+		if i < len(b) {
+			lb = &b[i]
+		}
+		if la != nil && lb != nil && *la == *lb {
+			continue
+		}
+		count++
+		if len(diffs) < limit {
+			diffs = append(diffs, LineDiff{Line: i + 1, A: la, B: lb})
+		}
+	}
+	return diffs, count
+}
+
+// handleCompareCaptures serves /api/captures/compare?a=<capture>&b=<capture>
+// with &mode=bytes (default) or &mode=lines.
+func handleCompareCaptures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !capturesEnabled() {
+		http.Error(w, "Captures disabled", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	nameA, nameB := q.Get("a"), q.Get("b")
+	viewer := captureViewerFor(r)
+	resp := map[string]any{"success": true, "a": nameA, "b": nameB}
+	switch q.Get("mode") {
+	case "", "bytes":
+		var data [2][]byte
+		for i, name := range []string{nameA, nameB} {
+			if _, err := viewer.viewCaptureMeta(name); err != nil {
+				http.Error(w, "Capture not found: "+name, http.StatusNotFound)
+				return
+			}
+			raw, err := os.ReadFile(filepath.Join(captureDir(), filepath.FromSlash(name)))
+			if err != nil {
+				http.Error(w, "Capture not found: "+name, http.StatusNotFound)
+				return
+			}
+			data[i] = raw
+		}
+		first := compareBytes(data[0], data[1])
+		resp["mode"] = "bytes"
+		resp["identical"] = first < 0
+		resp["sizeA"], resp["sizeB"] = len(data[0]), len(data[1])
+		if first >= 0 {
+			resp["firstDifference"] = first
+		}
+	case "lines":
+		cols, rows := captureScreenSize(r)
+		var lines [2][]string
+		for i, name := range []string{nameA, nameB} {
+			l, err := captureLines(viewer, name, cols, rows)
+			if errors.Is(err, errCaptureNotReplayable) {
+				http.Error(w, name+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Capture not found: "+name, http.StatusNotFound)
+				return
+			}
+			lines[i] = l
+		}
+		diffs, count := compareLines(lines[0], lines[1], maxCompareDiffs)
+		resp["mode"] = "lines"
+		resp["identical"] = count == 0
+		resp["linesA"], resp["linesB"] = len(lines[0]), len(lines[1])
+		resp["differing"] = count
+		resp["diffs"] = diffs
+	default:
+		http.Error(w, "mode must be bytes or lines", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,113 @@
+package main
+
+// Line view of a capture. Replays a capture through the virtual terminal
+// and returns what was shown as logical lines: cursor movement, CR
+// overprinting and clears are applied, so two sessions can be compared by
+// what the board displayed rather than by the bytes it sent.
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// errCaptureNotReplayable marks captures the line view cannot decode.
+var errCaptureNotReplayable = errors.New("raw PETSCII captures cannot be replayed")
+
+// captureText returns a capture as the UTF-8 ANSI stream the browser saw.
+// Raw captures are stripped of telnet negotiation first.
+func captureText(v captureViewer, name string) ([]byte, error) {
+	meta, err := v.viewCaptureMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(captureDir(), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	if meta.Mode == captureModeRaw {
+		if isPETSCIICharset(meta.Charset) {
+			return nil, errCaptureNotReplayable
+		}
+		data = (&Client{}).processTelnetData(data)
+	}
+	if meta.Charset == "CP437" {
+		data = []byte(ConvertCP437ToUTF8Enhanced(data))
+	}
+	return data, nil
+}
+
+// captureLines replays a capture on a cols x rows screen and returns every
+// line that left the screen followed by the final screen, with trailing
+// blanks trimmed and trailing empty lines dropped.
+func captureLines(v captureViewer, name string, cols, rows int) ([]string, error) {
+	data, err := captureText(v, name)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	screen := NewVTScreen(cols, rows)
+	screen.SetScrollback(func(line []VTCell) {
+		lines = append(lines, vtLineText(line))
+	})
+	screen.Write(data)
+	var shown []string
+	for _, line := range screen.Cells() {
+		shown = append(shown, vtLineText(line))
+	}
+	for len(shown) > 0 && shown[len(shown)-1] == "" {
+		shown = shown[:len(shown)-1]
+	}
+	return append(lines, shown...), nil
+}
+
+// captureScreenSize reads ?cols= and ?rows=, defaulting to 80x25.
+func captureScreenSize(r *http.Request) (cols, rows int) {
+	cols, _ = strconv.Atoi(r.URL.Query().Get("cols"))
+	rows, _ = strconv.Atoi(r.URL.Query().Get("rows"))
+	if cols <= 0 || cols > 500 {
+		cols = 80
+	}
+	if rows <= 0 || rows > 500 {
+		rows = 25
+	}
+	return cols, rows
+}
+
+// handleCaptureLines serves /api/captures/lines?name=<capture>.
+func handleCaptureLines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !capturesEnabled() {
+		http.Error(w, "Captures disabled", http.StatusNotFound)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	viewer := captureViewerFor(r)
+	cols, rows := captureScreenSize(r)
+	if r.URL.Query().Get("cols") == "" {
+		// Default to the width detected when the capture stopped
+		if meta, err := viewer.viewCaptureMeta(name); err == nil && meta.Cols > 0 && meta.Cols <= 500 {
+			cols = meta.Cols
+		}
+	}
+	lines, err := captureLines(viewer, name, cols, rows)
+	if errors.Is(err, errCaptureNotReplayable) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+	if lines == nil {
+		lines = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "name": name, "lines": lines})
+}
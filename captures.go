@@ -0,0 +1,708 @@
+package main
+
+// Server-side session captures. When enabled in config, a session can record
+// the board's output to a file in the captures directory. The directory is
+// bounded by a total-size and file-count quota that either refuses new
+// captures or evicts the oldest ones. A capture belongs to the browser
+// (client token) that started it; the HTTP endpoints only show a browser
+// its own captures, and the admin token sees all of them.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errCaptureQuota is returned by StartCapture when the quota is full and
+// the policy is "refuse".
+var errCaptureQuota = errors.New("capture storage quota exceeded")
+
+// captureMu serializes quota checks and evictions across sessions.
+var captureMu sync.Mutex
+
+// Capture modes. Raw records the bytes exactly as they arrived (telnet
+// negotiation included), for protocol debugging; converted records the
+// stream after telnet processing and ANSI normalization, before UTF-8
+// conversion, for archiving art.
+const (
+	captureModeConverted = "converted"
+	captureModeRaw       = "raw"
+)
+
+// captureMetaSuffix names the metadata file written next to each capture.
+const captureMetaSuffix = ".meta.json"
+
+// sessionCapture is an open capture file for one session.
+type sessionCapture struct {
+	name string
+	mode string
+	meta CaptureMeta
+
+	mu      sync.Mutex // file writes (read goroutine) vs closing
+	file    *os.File
+	written int64
+	closed  bool
+}
+
+// CaptureMeta is stored beside a capture as <name>.meta.json.
+type CaptureMeta struct {
+	Mode     string    `json:"mode"`
+	Board    string    `json:"board,omitempty"`
+	Host     string    `json:"host"`
+	Port     int       `json:"port"`
+	Protocol string    `json:"protocol,omitempty"`
+	Charset  string    `json:"charset"`
+	Started  time.Time `json:"started"`
+	Stopped  time.Time `json:"stopped,omitempty"`
+	Bytes    int64     `json:"bytes"`
+	// Owner is the hashed client token of the browser that started the
+	// capture (see clientKey); empty captures are admin-only
+	Owner string `json:"owner,omitempty"`
+	// Cols is the art's column width guessed when the capture stopped
+	// (SAUCE width, explicit sizing, or content); 0 if never stopped
+	Cols int `json:"cols,omitempty"`
+	// ANSI music played while capturing, in order
+	Music []CaptureMusic `json:"music,omitempty"`
+}
+
+// CaptureMusic is one ANSI music sequence seen during a capture.
+type CaptureMusic struct {
+	OffsetMs int64  `json:"offsetMs"` // since the capture started
+	MML      string `json:"mml"`
+}
+
+// maxCaptureMusic bounds the music sequences kept per capture.
+const maxCaptureMusic = 1000
+
+// CaptureInfo describes one stored capture.
+type CaptureInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Mode     string    `json:"mode,omitempty"`
+	Music    int       `json:"music,omitempty"` // ANSI music sequences recorded
+	Cols     int       `json:"cols,omitempty"`  // detected column width
+	owner    string
+}
+
+// CaptureUsage reports the captures directory against its quota. Zero
+// limits mean unlimited.
+type CaptureUsage struct {
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	MaxFiles int    `json:"maxFiles"`
+	MaxBytes int64  `json:"maxBytes"`
+	Policy   string `json:"policy"`
+}
+
+// capturesEnabled reports whether captures are turned on in config.
+func capturesEnabled() bool {
+	cfg := LoadAppConfig()
+	return cfg != nil && cfg.Capture.Enabled
+}
+
+// captureDir returns the captures directory (default "./captures").
+func captureDir() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Capture.Dir != "" {
+		return cfg.Capture.Dir
+	}
+	return "./captures"
+}
+
+// captureLimits returns the configured quota and policy ("refuse" or
+// "evict", default refuse).
+func captureLimits() (maxBytes int64, maxFiles int, policy string) {
+	cfg := LoadAppConfig()
+	policy = "refuse"
+	if cfg == nil {
+		return 0, 0, policy
+	}
+	if strings.EqualFold(cfg.Capture.QuotaPolicy, "evict") {
+		policy = "evict"
+	}
+	return cfg.Capture.MaxTotalBytes, cfg.Capture.MaxFiles, policy
+}
+
+// defaultCaptureTemplate reproduces the original flat naming.
+const defaultCaptureTemplate = "{timestamp}_{host}_{port}_{charset}.bin"
+
+// captureTemplateFields are the placeholders a name template may use.
+var captureTemplateFields = []string{"date", "time", "timestamp", "board", "host", "port", "protocol", "charset", "mode"}
+
+var captureTemplatePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validateCaptureTemplate rejects templates with unknown placeholders or
+// unsafe path components (absolute paths, "..", empty segments).
+func validateCaptureTemplate(tmpl string) error {
+	for _, m := range captureTemplatePlaceholder.FindAllStringSubmatch(tmpl, -1) {
+		if !slices.Contains(captureTemplateFields, m[1]) {
+			return fmt.Errorf("unknown placeholder {%s}", m[1])
+		}
+	}
+	if strings.Contains(tmpl, "\\") || filepath.IsAbs(tmpl) || strings.HasPrefix(tmpl, "/") {
+		return errors.New("must be a relative path using /")
+	}
+	for _, seg := range strings.Split(tmpl, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return fmt.Errorf("unsafe path component %q", seg)
+		}
+	}
+	if strings.HasSuffix(tmpl, captureMetaSuffix) {
+		return fmt.Errorf("must not end in %s", captureMetaSuffix)
+	}
+	return nil
+}
+
+// captureNameTemplate returns the configured template, or the default when
+// unset or invalid (the config check at startup reports why).
+func captureNameTemplate() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Capture.NameTemplate != "" {
+		if validateCaptureTemplate(cfg.Capture.NameTemplate) == nil {
+			return cfg.Capture.NameTemplate
+		}
+	}
+	return defaultCaptureTemplate
+}
+
+// expandCaptureTemplate fills in a template. Each placeholder value is
+// sanitized, so values cannot add path components.
+func expandCaptureTemplate(tmpl string, vars map[string]string) string {
+	return captureTemplatePlaceholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		return sanitizeCaptureComponent(vars[m[1:len(m)-1]])
+	})
+}
+
+// listCaptures returns stored captures, oldest first. Names are paths
+// relative to the captures directory, using /.
+func listCaptures() ([]CaptureInfo, error) {
+	root := captureDir()
+	var out []CaptureInfo
+	err := filepath.WalkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return nil
+		}
+		if e.IsDir() || strings.HasSuffix(e.Name(), captureMetaSuffix) {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		ci := CaptureInfo{Name: name, Size: info.Size(), Modified: info.ModTime()}
+		if raw, err := os.ReadFile(path + captureMetaSuffix); err == nil {
+			var meta CaptureMeta
+			if json.Unmarshal(raw, &meta) == nil {
+				ci.Mode = meta.Mode
+				ci.Music = len(meta.Music)
+				ci.Cols = meta.Cols
+				ci.owner = meta.Owner
+			}
+		}
+		out = append(out, ci)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Modified.Before(out[j].Modified) })
+	return out, nil
+}
+
+// captureUsage totals the captures directory.
+func captureUsage() (CaptureUsage, error) {
+	maxBytes, maxFiles, policy := captureLimits()
+	u := CaptureUsage{MaxFiles: maxFiles, MaxBytes: maxBytes, Policy: policy}
+	files, err := listCaptures()
+	if err != nil {
+		return u, err
+	}
+	u.Files = len(files)
+	for _, f := range files {
+		u.Bytes += f.Size
+	}
+	return u, nil
+}
+
+// enforceCaptureQuota checks the directory against the quota. With room
+// for a new file reserved (starting a capture), a full quota either evicts
+// the oldest captures or returns errCaptureQuota. skip names a capture
+// still being written that must not be evicted.
+func enforceCaptureQuota(reserve bool, skip map[string]bool) error {
+	maxBytes, maxFiles, policy := captureLimits()
+	if maxBytes <= 0 && maxFiles <= 0 {
+		return nil
+	}
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	files, err := listCaptures()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+	count := len(files)
+	if reserve {
+		count++
+	}
+	over := func() bool {
+		return (maxFiles > 0 && count > maxFiles) || (maxBytes > 0 && total >= maxBytes)
+	}
+	if !over() {
+		return nil
+	}
+	if policy != "evict" {
+		return errCaptureQuota
+	}
+	for _, f := range files {
+		if !over() {
+			break
+		}
+		if skip[f.Name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(captureDir(), filepath.FromSlash(f.Name))); err != nil {
+			log.Printf("Capture quota: could not evict %s: %v", f.Name, err)
+			continue
+		}
+		os.Remove(filepath.Join(captureDir(), filepath.FromSlash(f.Name)+captureMetaSuffix))
+		removeEmptyCaptureDirs(filepath.Dir(filepath.Join(captureDir(), filepath.FromSlash(f.Name))))
+		log.Printf("Capture quota: evicted %s (%d bytes)", f.Name, f.Size)
+		total -= f.Size
+		count--
+	}
+	if over() {
+		return errCaptureQuota
+	}
+	return nil
+}
+
+// removeEmptyCaptureDirs prunes template subdirectories left empty by
+// eviction, stopping at the captures directory.
+func removeEmptyCaptureDirs(dir string) {
+	root := filepath.Clean(captureDir())
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// openCaptures tracks capture files still being written so periodic
+// eviction leaves them alone.
+var openCaptures = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// openCaptureNames returns a copy of the captures still being written.
+func openCaptureNames() map[string]bool {
+	openCaptures.Lock()
+	defer openCaptures.Unlock()
+	skip := make(map[string]bool, len(openCaptures.names))
+	for n := range openCaptures.names {
+		skip[n] = true
+	}
+	return skip
+}
+
+// watchCaptureQuota re-checks the quota every minute, evicting under the
+// "evict" policy as captures grow.
+func watchCaptureQuota() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := enforceCaptureQuota(false, openCaptureNames()); err != nil && !errors.Is(err, errCaptureQuota) {
+			log.Printf("Capture quota check failed: %v", err)
+		}
+	}
+}
+
+// StartCapture begins recording the board's output for this session in
+// mode "converted" (default) or "raw".
+func (c *Client) StartCapture(mode string) error {
+	if !capturesEnabled() {
+		return errors.New("captures are disabled on this server")
+	}
+	switch strings.ToLower(mode) {
+	case "", captureModeConverted:
+		mode = captureModeConverted
+	case captureModeRaw:
+		mode = captureModeRaw
+	default:
+		return fmt.Errorf("unknown capture mode %q", mode)
+	}
+	c.mu.Lock()
+	board := c.board
+	charset := c.charset
+	token := c.clientToken
+	active := c.capture != nil
+	c.mu.Unlock()
+	if active {
+		return errors.New("capture already running")
+	}
+	// Other sessions' captures in progress are never evicted
+	if err := enforceCaptureQuota(true, openCaptureNames()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(captureDir(), 0o755); err != nil {
+		return fmt.Errorf("could not create captures directory: %w", err)
+	}
+	now := time.Now().UTC()
+	name := expandCaptureTemplate(captureNameTemplate(), map[string]string{
+		"date":      now.Format("2006-01-02"),
+		"time":      now.Format("150405Z"),
+		"timestamp": now.Format("20060102T150405Z"),
+		"board":     board.Name,
+		"host":      board.Host,
+		"port":      strconv.Itoa(board.Port),
+		"protocol":  board.Protocol,
+		"charset":   charset,
+		"mode":      mode,
+	})
+	f, name, err := createCaptureFile(name)
+	if err != nil {
+		return fmt.Errorf("could not create capture: %w", err)
+	}
+	openCaptures.Lock()
+	openCaptures.names[name] = true
+	openCaptures.Unlock()
+	cp := &sessionCapture{file: f, name: name, mode: mode, meta: CaptureMeta{
+		Mode:     mode,
+		Board:    board.Name,
+		Host:     board.Host,
+		Port:     board.Port,
+		Protocol: board.Protocol,
+		Charset:  charset,
+		Started:  time.Now().UTC(),
+	}}
+	if token != "" {
+		cp.meta.Owner = clientKey(token)
+	}
+	writeCaptureMeta(cp)
+	c.mu.Lock()
+	c.capture = cp
+	c.mu.Unlock()
+	log.Printf("Capture started: %s (%s)", name, mode)
+	return nil
+}
+
+// createCaptureFile creates a new capture at the relative name, making
+// template subdirectories as needed. A name already taken gets a -2, -3...
+// suffix before its extension. Returns the name actually used.
+func createCaptureFile(name string) (*os.File, string, error) {
+	path := filepath.Join(captureDir(), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, "", err
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; n <= 100; n++ {
+		try := name
+		if n > 1 {
+			try = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		f, err := os.OpenFile(filepath.Join(captureDir(), filepath.FromSlash(try)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			return f, try, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", err
+		}
+	}
+	return nil, "", fmt.Errorf("%s: too many captures with this name", name)
+}
+
+// writeCaptureMeta (re)writes the capture's metadata file.
+func writeCaptureMeta(cp *sessionCapture) {
+	raw, err := json.MarshalIndent(cp.meta, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(captureDir(), filepath.FromSlash(cp.name)+captureMetaSuffix), raw, 0o644); err != nil {
+		log.Printf("Capture metadata for %s not written: %v", cp.name, err)
+	}
+}
+
+// StopCapture closes the session's capture, if any, and returns its name.
+func (c *Client) StopCapture() string {
+	c.mu.Lock()
+	cp := c.capture
+	c.capture = nil
+	c.mu.Unlock()
+	return closeCapture(cp)
+}
+
+// closeCapture closes a capture detached from its session. It reads the
+// capture back to detect its width, so callers must not hold the client
+// lock.
+func closeCapture(cp *sessionCapture) string {
+	if cp == nil {
+		return ""
+	}
+	cp.mu.Lock()
+	cp.file.Close()
+	cp.closed = true
+	written := cp.written
+	cp.mu.Unlock()
+	cp.meta.Stopped = time.Now().UTC()
+	cp.meta.Bytes = written
+	cp.meta.Cols = captureColumns(cp.name, cp.mode)
+	writeCaptureMeta(cp)
+	openCaptures.Lock()
+	delete(openCaptures.names, cp.name)
+	openCaptures.Unlock()
+	log.Printf("Capture stopped: %s (%d bytes)", cp.name, written)
+	return cp.name
+}
+
+// captureColsScanLimit bounds how much of a capture is read to guess its
+// width; a SAUCE record at the end of a longer capture is still honored.
+const captureColsScanLimit = 1 << 20
+
+// captureColumns guesses a stored capture's column width from its SAUCE
+// record or content. Raw captures are stripped of telnet negotiation first.
+func captureColumns(name, mode string) int {
+	f, err := os.Open(filepath.Join(captureDir(), filepath.FromSlash(name)))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	if info.Size() > captureColsScanLimit {
+		tail := make([]byte, sauceRecordLen)
+		if _, err := f.ReadAt(tail, info.Size()-sauceRecordLen); err == nil {
+			if cols, ok := SAUCEColumns(tail); ok {
+				return cols
+			}
+		}
+	}
+	data := make([]byte, min(info.Size(), captureColsScanLimit))
+	n, _ := f.ReadAt(data, 0)
+	data = data[:n]
+	if mode == captureModeRaw {
+		data = (&Client{}).processTelnetData(data)
+	}
+	return DetectANSIColumns(data)
+}
+
+// writeCapture appends board output to the active capture when the
+// capture records the stream stage given by mode.
+func (c *Client) writeCapture(mode string, data []byte) {
+	c.mu.Lock()
+	cp := c.capture
+	c.mu.Unlock()
+	if cp == nil || cp.mode != mode || len(data) == 0 {
+		return
+	}
+	cp.mu.Lock()
+	if cp.closed {
+		cp.mu.Unlock()
+		return
+	}
+	n, err := cp.file.Write(data)
+	cp.written += int64(n)
+	cp.mu.Unlock()
+	if err != nil {
+		log.Printf("Capture write failed, stopping: %v", err)
+		// Only this capture; the user may have started another since
+		c.mu.Lock()
+		current := c.capture == cp
+		if current {
+			c.capture = nil
+		}
+		c.mu.Unlock()
+		if current {
+			closeCapture(cp)
+		}
+	}
+}
+
+// recordCaptureMusic adds an ANSI music payload to the active capture's
+// metadata; music is only kept while a capture runs.
+func (c *Client) recordCaptureMusic(mml string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp := c.capture
+	if cp == nil || len(cp.meta.Music) >= maxCaptureMusic {
+		return
+	}
+	cp.meta.Music = append(cp.meta.Music, CaptureMusic{
+		OffsetMs: time.Since(cp.meta.Started).Milliseconds(),
+		MML:      mml,
+	})
+}
+
+// readCaptureMeta loads the metadata of a stored capture by name.
+func readCaptureMeta(name string) (CaptureMeta, error) {
+	var meta CaptureMeta
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) || strings.HasSuffix(name, captureMetaSuffix) {
+		return meta, errors.New("invalid capture name")
+	}
+	raw, err := os.ReadFile(filepath.Join(captureDir(), filepath.FromSlash(name)+captureMetaSuffix))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(raw, &meta)
+	return meta, err
+}
+
+// captureViewer is who an HTTP request may see captures as: the admin
+// sees every capture, a browser only those its client token started.
+type captureViewer struct {
+	owner string // clientKey of the request's client token
+	admin bool
+}
+
+// captureViewerFor identifies the viewer of r.
+func captureViewerFor(r *http.Request) captureViewer {
+	v := captureViewer{admin: hasAdminToken(r)}
+	if token := clientToken(nil, r, false); token != "" {
+		v.owner = clientKey(token)
+	}
+	return v
+}
+
+// sees reports whether the viewer may see a capture with this owner.
+func (v captureViewer) sees(owner string) bool {
+	return v.admin || (v.owner != "" && owner == v.owner)
+}
+
+// viewCaptureMeta loads a capture's metadata if the viewer may see it;
+// captures of other browsers read as not found.
+func (v captureViewer) viewCaptureMeta(name string) (CaptureMeta, error) {
+	meta, err := readCaptureMeta(name)
+	if err != nil {
+		return meta, err
+	}
+	if !v.sees(meta.Owner) {
+		return CaptureMeta{}, fs.ErrNotExist
+	}
+	return meta, nil
+}
+
+// sanitizeCaptureComponent keeps a file name component to letters, digits,
+// dot and dash.
+func sanitizeCaptureComponent(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	out := strings.Trim(b.String(), ".")
+	if out == "" {
+		return "unknown"
+	}
+	return out
+}
+
+// handleListCaptures returns the caller's stored captures (all of them
+// for the admin) and quota usage.
+func handleListCaptures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !capturesEnabled() {
+		http.Error(w, "Captures disabled", http.StatusNotFound)
+		return
+	}
+	all, err := listCaptures()
+	if err != nil {
+		http.Error(w, "Could not list captures", http.StatusInternalServerError)
+		return
+	}
+	viewer := captureViewerFor(r)
+	files := []CaptureInfo{}
+	for _, f := range all {
+		if viewer.sees(f.owner) {
+			files = append(files, f)
+		}
+	}
+	usage, _ := captureUsage()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Success  bool          `json:"success"`
+		Captures []CaptureInfo `json:"captures"`
+		Usage    CaptureUsage  `json:"usage"`
+	}{true, files, usage})
+}
+
+// handleCaptureMusic serves the ANSI music recorded with a capture:
+// ?name=<capture>&format=json (default; each sequence with its parsed
+// notes) or format=mus (the MML text, one sequence per line, as a file).
+func handleCaptureMusic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !capturesEnabled() {
+		http.Error(w, "Captures disabled", http.StatusNotFound)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	meta, err := captureViewerFor(r).viewCaptureMeta(name)
+	if err != nil {
+		http.Error(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "mus":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		base := path.Base(name)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimSuffix(base, path.Ext(base))+".mus"))
+		for _, m := range meta.Music {
+			fmt.Fprintln(w, m.MML)
+		}
+	case "", "json":
+		type sequence struct {
+			CaptureMusic
+			Notes []MMLNote `json:"notes"`
+			Error string    `json:"error,omitempty"`
+		}
+		seqs := make([]sequence, 0, len(meta.Music))
+		for _, m := range meta.Music {
+			notes, err := ParseMML(m.MML)
+			seq := sequence{CaptureMusic: m, Notes: notes}
+			if err != nil {
+				seq.Error = err.Error()
+			}
+			seqs = append(seqs, seq)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "name": name, "music": seqs})
+	default:
+		http.Error(w, "format must be json or mus", http.StatusBadRequest)
+	}
+}
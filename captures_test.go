@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureTestConfig(t *testing.T, maxFiles int, policy string) *Config {
+	cfg := &Config{}
+	cfg.Capture.Enabled = true
+	cfg.Capture.Dir = t.TempDir()
+	cfg.Capture.MaxFiles = maxFiles
+	cfg.Capture.QuotaPolicy = policy
+	cfg.Capture.NameTemplate = "{timestamp}-{host}.ans"
+	useConfig(t, cfg)
+	return cfg
+}
+
+func TestCaptureEvictSkipsOpenCaptures(t *testing.T) {
+	cfg := captureTestConfig(t, 2, "evict")
+	old := filepath.Join(cfg.Capture.Dir, "old.ans")
+	if err := os.WriteFile(old, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(old, past, past)
+
+	// Another session's capture in progress, older than old.ans once touched
+	a := &Client{board: BBSInfo{Host: "a.example", Port: 23}}
+	if err := a.StartCapture(""); err != nil {
+		t.Fatal(err)
+	}
+	aName := a.capture.name
+	aPath := filepath.Join(cfg.Capture.Dir, aName)
+	older := past.Add(-time.Hour)
+	os.Chtimes(aPath, older, older)
+
+	b := &Client{board: BBSInfo{Host: "b.example", Port: 23}}
+	if err := b.StartCapture(""); err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopCapture()
+	if _, err := os.Stat(aPath); err != nil {
+		t.Errorf("open capture %s evicted: %v", aName, err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("oldest closed capture not evicted")
+	}
+	a.writeCapture(captureModeConverted, []byte("still recording"))
+	a.StopCapture()
+}
+
+func TestCaptureRefusePolicy(t *testing.T) {
+	captureTestConfig(t, 1, "")
+	a := &Client{board: BBSInfo{Host: "a.example", Port: 23}}
+	if err := a.StartCapture(""); err != nil {
+		t.Fatal(err)
+	}
+	defer a.StopCapture()
+	b := &Client{board: BBSInfo{Host: "b.example", Port: 23}}
+	if err := b.StartCapture(""); !errors.Is(err, errCaptureQuota) {
+		t.Errorf("second capture: %v, want quota error", err)
+	}
+}
+
+// ownedCapture records one capture from a session with the given client
+// token and returns its name.
+func ownedCapture(t *testing.T, token, host string) string {
+	t.Helper()
+	c := &Client{clientToken: token, charset: "UTF-8", board: BBSInfo{Host: host, Port: 23}}
+	if err := c.StartCapture(""); err != nil {
+		t.Fatal(err)
+	}
+	c.writeCapture(captureModeConverted, []byte("hello from "+host+"\r\n"))
+	return c.StopCapture()
+}
+
+func TestCaptureEndpointsScopedToOwner(t *testing.T) {
+	cfg := captureTestConfig(t, 0, "")
+	cfg.Admin.Token = "admin-secret"
+	useClientTokenKey(t)
+	aliceToken, bobToken := newClientToken(), newClientToken()
+	alice := ownedCapture(t, aliceToken, "a.example")
+	bob := ownedCapture(t, bobToken, "b.example")
+
+	get := func(handler http.HandlerFunc, target, token, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set(clientTokenHeader, token)
+		}
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	listed := func(token, bearer string) []string {
+		rec := get(handleListCaptures, "/api/captures", token, bearer)
+		var body struct{ Captures []CaptureInfo }
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("list: %v (%s)", err, rec.Body.String())
+		}
+		var names []string
+		for _, c := range body.Captures {
+			names = append(names, c.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	both := []string{alice, bob}
+	sort.Strings(both)
+	for _, tt := range []struct {
+		name   string
+		token  string
+		bearer string
+		want   []string
+	}{
+		{"alice", aliceToken, "", []string{alice}},
+		{"bob", bobToken, "", []string{bob}},
+		{"unissued token", "bob-token", "", nil},
+		{"no token", "", "", nil},
+		{"wrong admin token", "", "guess", nil},
+		{"admin", "", "admin-secret", both},
+	} {
+		if got := listed(tt.token, tt.bearer); !slices.Equal(got, tt.want) {
+			t.Errorf("%s lists %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	q := url.QueryEscape
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+	}{
+		{"lines", handleCaptureLines, "/api/captures/lines?name=" + q(bob)},
+		{"music", handleCaptureMusic, "/api/captures/music?name=" + q(bob)},
+		{"compare bytes", handleCompareCaptures, "/api/captures/compare?a=" + q(alice) + "&b=" + q(bob)},
+		{"compare lines", handleCompareCaptures, "/api/captures/compare?mode=lines&a=" + q(alice) + "&b=" + q(bob)},
+	} {
+		if rec := get(tt.handler, tt.target, aliceToken, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: alice reading bob's capture got %d, want 404", tt.name, rec.Code)
+		}
+		if rec := get(tt.handler, tt.target, "", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: anonymous request got %d, want 404", tt.name, rec.Code)
+		}
+		if rec := get(tt.handler, tt.target, "", "admin-secret"); rec.Code != http.StatusOK {
+			t.Errorf("%s: admin got %d: %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := get(handleCaptureLines, "/api/captures/lines?name="+q(bob), bobToken, ""); rec.Code != http.StatusOK {
+		t.Errorf("bob reading their own capture got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The metadata holds a hash, never the token itself
+	raw, err := os.ReadFile(filepath.Join(cfg.Capture.Dir, alice+captureMetaSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), aliceToken) || !strings.Contains(string(raw), clientKey(aliceToken)) {
+		t.Errorf("metadata owner not stored as a hash: %s", raw)
+	}
+}
+
+// TestCaptureWriteDuringStop writes from the read goroutine while the
+// WebSocket goroutine stops the capture (run with -race).
+func TestCaptureWriteDuringStop(t *testing.T) {
+	captureTestConfig(t, 0, "")
+	// Several Ps so the two sides really overlap, even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(max(4, runtime.GOMAXPROCS(0))))
+	for i := 0; i < 20; i++ {
+		c := &Client{board: BBSInfo{Host: "race.example", Port: 23}}
+		if err := c.StartCapture(""); err != nil {
+			t.Fatal(err)
+		}
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		writing := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.writeCapture(captureModeConverted, []byte("first\r\n"))
+			close(writing)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					c.writeCapture(captureModeConverted, []byte("line\r\n"))
+				}
+			}
+		}()
+		<-writing
+		name := c.StopCapture()
+		close(stop)
+		<-done
+		meta, err := readCaptureMeta(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(captureDir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Bytes != info.Size() {
+			t.Errorf("run %d: metadata says %d bytes, file has %d", i, meta.Bytes, info.Size())
+		}
+	}
+}
+
+func TestCaptureWriteErrorStopsCapture(t *testing.T) {
+	captureTestConfig(t, 0, "")
+	c := &Client{board: BBSInfo{Host: "full.example", Port: 23}}
+	if err := c.StartCapture(""); err != nil {
+		t.Fatal(err)
+	}
+	cp := c.capture
+	cp.file.Close() // the next write fails like a full disk
+	c.writeCapture(captureModeConverted, []byte("lost"))
+	if c.capture != nil {
+		t.Fatal("capture still active after a write error")
+	}
+	if !cp.closed {
+		t.Error("failed capture not closed")
+	}
+	if openCaptureNames()[cp.name] {
+		t.Error("failed capture still listed as open")
+	}
+}
+
+func TestDisconnectFinishesCapture(t *testing.T) {
+	captureTestConfig(t, 0, "")
+	c := &Client{board: BBSInfo{Host: "wide.example", Port: 23}}
+	if err := c.StartCapture(""); err != nil {
+		t.Fatal(err)
+	}
+	name := c.capture.name
+	c.writeCapture(captureModeConverted, []byte("\x1b[?3hwide art\r\n"))
+	c.disconnect()
+	if c.capture != nil {
+		t.Fatal("capture still attached after disconnect")
+	}
+	meta, err := readCaptureMeta(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Cols != 132 || meta.Stopped.IsZero() {
+		t.Errorf("metadata cols %d, stopped %v; want 132 and a stop time", meta.Cols, meta.Stopped)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+// CP437/UTF-8 mismatch detection. A board listed as CP437 that actually
+// sends UTF-8 is double-encoded into mojibake ("weird characters"). Early
+// output is checked for well-formed multibyte UTF-8; CP437 art rarely
+// forms it for long because its box-drawing bytes are not continuation
+// bytes.
+
+import (
+	"log"
+	"unicode/utf8"
+)
+
+const (
+	// charsetCheckBytes is how much high-bit output is examined per connection
+	charsetCheckBytes = 8192
+	// charsetMismatchRunes is the multibyte sequences needed to flag a mismatch
+	charsetMismatchRunes = 8
+)
+
+// charsetAutoSwitch reports whether a detected mismatch switches the
+// session to UTF-8 (config terminal.charsetAutoSwitch).
+func charsetAutoSwitch() bool {
+	cfg := LoadAppConfig()
+	return cfg != nil && cfg.Terminal.CharsetAutoSwitch
+}
+
+// checkCharsetMismatch inspects raw board output while the session is
+// CP437. Any byte sequence that is not valid UTF-8 ends the check; enough
+// valid multibyte sequences raise a "charsetMismatch" warning, switching
+// to UTF-8 when configured.
+func (c *Client) checkCharsetMismatch(data []byte) {
+	c.mu.Lock()
+	if c.charsetChecked || c.charset != "CP437" {
+		c.mu.Unlock()
+		return
+	}
+	// Hold back an incomplete trailing sequence split across reads
+	data = append(c.charsetTail, data...)
+	c.charsetTail = nil
+	if cut := incompleteUTF8Suffix(data); cut > 0 {
+		c.charsetTail = append([]byte(nil), data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		if size == 1 {
+			if r == utf8.RuneError {
+				c.charsetChecked = true // genuine 8-bit text
+				c.charsetTail = nil
+				c.mu.Unlock()
+				return
+			}
+			continue
+		}
+		c.charsetSeen += size
+		c.charsetRunes++
+	}
+	flagged := c.charsetRunes >= charsetMismatchRunes
+	if flagged || c.charsetSeen >= charsetCheckBytes {
+		c.charsetChecked = true
+		c.charsetTail = nil
+	}
+	switched := false
+	if flagged && charsetAutoSwitch() {
+		switched = c.setCharsetLocked("UTF-8", charsetSourceDetected)
+	}
+	c.mu.Unlock()
+
+	if !flagged {
+		return
+	}
+	msg := "This board appears to send UTF-8 but is listed as CP437; try the UTF-8 charset"
+	if switched {
+		msg = "This board appears to send UTF-8 but is listed as CP437; switched to UTF-8"
+	}
+	log.Printf("Charset: %s", msg)
+	c.sendJSON(Message{Type: "charsetMismatch", Message: msg, Charset: "UTF-8"})
+	if switched {
+		c.reportCharset()
+	}
+}
+
+// resetCharsetCheck re-arms detection for a new connection; caller holds c.mu.
+func (c *Client) resetCharsetCheck() {
+	c.charsetChecked = false
+	c.charsetTail = nil
+	c.charsetSeen = 0
+	c.charsetRunes = 0
+}
+
+// incompleteUTF8Suffix returns the length of a truncated multibyte
+// sequence at the end of data, or 0.
+func incompleteUTF8Suffix(data []byte) int {
+	for i := 1; i <= 3 && i <= len(data); i++ {
+		b := data[len(data)-i]
+		if b < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(b) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
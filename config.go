@@ -2,8 +2,13 @@ package main
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
     "os"
+    "regexp"
+    "strings"
+    "sync/atomic"
+    "time"
 )
 
 // Config holds server and proxy settings loaded from config.json.
@@ -13,6 +18,16 @@ type Config struct {
 		Port            int    `json:"port"`
 		UseCuratedList  bool   `json:"useCuratedList"`
 		ExternalBaseURL string `json:"externalBaseURL"`
+		// StrictMessages answers WebSocket messages of unknown type with
+		// "unsupportedMessage" instead of ignoring them (default off)
+		StrictMessages bool `json:"strictMessages"`
+		// TLS enables built-in HTTPS/WSS when both cert and key are set
+		TLS struct {
+			CertFile string `json:"certFile"`
+			KeyFile  string `json:"keyFile"`
+			// RedirectPort, if set, serves plain HTTP redirects to HTTPS
+			RedirectPort int `json:"redirectPort"`
+		} `json:"tls"`
 	} `json:"server"`
 	// Email and Database removed in stateless mode; kept here for backward-compat JSON parsing
 	Email    any `json:"email"`
@@ -25,10 +40,226 @@ type Config struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	} `json:"proxy"`
-	DefaultBBSList []BBSInfo `json:"defaultBBSList"`
+	// Proxies are named alternatives users can pick per connection
+	Proxies        []NamedProxy `json:"proxies"`
+	DefaultBBSList []BBSInfo    `json:"defaultBBSList"`
+	ANSI           struct {
+		// MaxSequenceBytes caps a buffered escape sequence (default 4096)
+		MaxSequenceBytes int `json:"maxSequenceBytes"`
+		// MaxExpansion bounds ANSI normalization output at this multiple
+		// of the input (default 8; negative disables)
+		MaxExpansion int `json:"maxExpansion"`
+		// CP437Mapping selects "true" (default) or "compat" glyphs
+		CP437Mapping string `json:"cp437Mapping"`
+		// MusicFormat selects how ANSI music reaches the browser: "raw"
+		// (default), "notes" or "midi"
+		MusicFormat string `json:"musicFormat"`
+	} `json:"ansi"`
+	Connection struct {
+		// FailureCooldownSeconds refuses reconnects to a board from the same
+		// browser (client token, else IP) for this long after a failed
+		// connect (default 15; negative disables)
+		FailureCooldownSeconds int `json:"failureCooldownSeconds"`
+		// NegotiationLoopThreshold refuses a telnet option the board
+		// requests more than this many times in 5s (default 10; negative disables)
+		NegotiationLoopThreshold int `json:"negotiationLoopThreshold"`
+		// BindAddress is the local IP direct board connections are made from
+		BindAddress string `json:"bindAddress"`
+		// ImmediateNegotiation writes each telnet negotiation reply as soon
+		// as its command is parsed instead of once per read (default off)
+		ImmediateNegotiation bool `json:"immediateNegotiation"`
+		// ResumeSeconds keeps the board connection open this long after the
+		// browser's WebSocket drops so it can resume (default 30; negative disables)
+		ResumeSeconds int `json:"resumeSeconds"`
+	} `json:"connection"`
+	SSH struct {
+		// TermType is the $TERM requested for SSH PTYs when the board does
+		// not set one (default "xterm-256color")
+		TermType string `json:"termType"`
+		// TerminalModes adds to or overrides the raw PTY modes by RFC 4254
+		// name, e.g. {"ECHO": 1} (see ssh_modes.go)
+		TerminalModes map[string]uint32 `json:"terminalModes"`
+		// RemoteCommand is run when the server refuses a shell
+		RemoteCommand string `json:"remoteCommand"`
+	} `json:"ssh"`
+	// ConnectionLog writes JSON-lines connect/disconnect records when Path is set
+	ConnectionLog struct {
+		Path     string `json:"path"`
+		MaxBytes int64  `json:"maxBytes"` // rotate above this size (default 10MB)
+		Keep     int    `json:"keep"`     // rotated files kept (default 3)
+	} `json:"connectionLog"`
+	Terminal struct {
+		// InitialCPRWindowSeconds answers the first CPR request within this
+		// many seconds of connecting (default 5; negative disables)
+		InitialCPRWindowSeconds int `json:"initialCPRWindowSeconds"`
+		// EORPrompt sends a "prompt" message when the board marks a
+		// prompt with telnet IAC EOR
+		EORPrompt bool `json:"eorPrompt"`
+		// BellMessages sends a "bell" message when the board rings the
+		// bell (BEL), in addition to passing the BEL on
+		BellMessages bool `json:"bellMessages"`
+		// VirtualScreen keeps a server-side screen model per session for
+		// screen text and CPR replies (default off for its memory/CPU cost)
+		VirtualScreen *bool `json:"virtualScreen"`
+		// ANSIPromptPatterns (regular expressions) and ANSIPromptResponse
+		// drive the per-board ANSI prompt auto-responder
+		ANSIPromptPatterns []string `json:"ansiPromptPatterns"`
+		ANSIPromptResponse string   `json:"ansiPromptResponse"`
+		// LogoutDetect ends the session shortly after the board shows a
+		// logout banner matching LogoutPatterns (regular expressions;
+		// default: common goodbye lines). Default off
+		LogoutDetect   bool     `json:"logoutDetect"`
+		LogoutPatterns []string `json:"logoutPatterns"`
+		// CharsetAutoSwitch moves a CP437 session to UTF-8 when the board
+		// is detected sending UTF-8 (otherwise only a warning is sent)
+		CharsetAutoSwitch bool `json:"charsetAutoSwitch"`
+		// Answerback replies to ENQ for boards without their own
+		// (default empty: no reply)
+		Answerback string `json:"answerback"`
+		// Identity is the terminal reported to DA queries: vt100, vt102
+		// (default), vt220, vt320, xterm, or a literal ESC[...c reply
+		Identity string `json:"identity"`
+		// NULPolicy handles NULs other than the telnet CR NUL pair (whose
+		// NUL is always removed outside BINARY mode): drop (default), keep
+		// or space
+		NULPolicy string `json:"nulPolicy"`
+		// TelnetSpeed is reported to boards that ask with telnet TSPEED:
+		// "transmit,receive" bits per second (default "38400,38400"), a
+		// single speed for both, or "off" to refuse the option
+		TelnetSpeed string `json:"telnetSpeed"`
+	} `json:"terminal"`
+	// Favorites persists per-client favorites (default "favorites.json")
+	Favorites struct {
+		Path string `json:"path"`
+	} `json:"favorites"`
+	// Recent keeps each client's last Max connections (default 10;
+	// negative disables) in Path (default "recent.json")
+	Recent struct {
+		Path string `json:"path"`
+		Max  int    `json:"max"`
+	} `json:"recent"`
+	// Flood pauses a session whose output stays above BytesPerSecond
+	// (default 1MB; negative disables) for SustainSeconds (default 5)
+	Flood struct {
+		BytesPerSecond int64 `json:"bytesPerSecond"`
+		SustainSeconds int   `json:"sustainSeconds"`
+	} `json:"flood"`
+	Transfer struct {
+		// MaxUploadBytes caps a browser upload sent to the board (default 50MB)
+		MaxUploadBytes int64 `json:"maxUploadBytes"`
+		// MaxMessageBytes is the largest base64 file sent in one WebSocket
+		// message; bigger downloads are chunked (default 1MB)
+		MaxMessageBytes int `json:"maxMessageBytes"`
+		// AllowExtensions / DenyExtensions filter received files by
+		// extension, e.g. ["zip", ".txt"]; deny wins, empty allows all
+		AllowExtensions []string `json:"allowExtensions"`
+		DenyExtensions  []string `json:"denyExtensions"`
+		// BinaryLeakBytes drops output once this many bytes in a row look
+		// like binary data from an undetected transfer (default 0, off;
+		// e.g. 4096 turns it on)
+		BinaryLeakBytes int `json:"binaryLeakBytes"`
+		// PartialFiles is what happens to a download smaller than the size
+		// the board declared: "mark" (default) or "refuse"
+		PartialFiles string `json:"partialFiles"`
+		// ZmodemSuppressMillis keeps output off the screen for at most this
+		// long after a ZMODEM signature, until rz takes over (default
+		// 2000; negative disables)
+		ZmodemSuppressMillis int `json:"zmodemSuppressMillis"`
+	} `json:"transfer"`
+	Capture struct {
+		// Enabled allows sessions to record board output server-side
+		Enabled bool   `json:"enabled"`
+		Dir     string `json:"dir"` // default "./captures"
+		// Quota for the captures directory; zero means unlimited
+		MaxTotalBytes int64 `json:"maxTotalBytes"`
+		MaxFiles      int   `json:"maxFiles"`
+		// QuotaPolicy is "refuse" (default) or "evict" (delete oldest)
+		QuotaPolicy string `json:"quotaPolicy"`
+		// NameTemplate lays out capture files, e.g. "{date}/{board}/{time}.ans"
+		// (see captureNameTemplate for placeholders)
+		NameTemplate string `json:"nameTemplate"`
+	} `json:"capture"`
+	// Banners holds directory card art referenced by bbs.csv "Banner"
+	Banners struct {
+		Dir      string `json:"dir"`      // default "banners"
+		MaxBytes int    `json:"maxBytes"` // default 16KB
+	} `json:"banners"`
+	// ProtocolDefaults overrides the per-protocol session defaults, keyed
+	// by "telnet" or "ssh" (see protocolDefaults)
+	ProtocolDefaults map[string]ProtocolDefaults `json:"protocolDefaults"`
+	// Admin enables the /api/admin endpoints for requests carrying
+	// "Authorization: Bearer <token>"; unset disables them
+	Admin struct {
+		Token string `json:"token"`
+	} `json:"admin"`
+	// Profiles adds or replaces named connection profiles (see profiles.go)
+	Profiles map[string]ConnectionProfile `json:"profiles"`
 }
 
-var AppConfig *Config
+// appConfig is the active configuration, read from request and session
+// goroutines; always go through LoadAppConfig and StoreAppConfig.
+var appConfig atomic.Pointer[Config]
+
+// LoadAppConfig returns the active configuration, or nil before one is
+// loaded. Callers read it once and use that snapshot for a whole operation.
+func LoadAppConfig() *Config {
+	return appConfig.Load()
+}
+
+// StoreAppConfig makes config the active configuration.
+func StoreAppConfig(config *Config) {
+	appConfig.Store(config)
+}
+
+// ProtocolDefaults is the charset and ANSI policy a session starts with
+// for a protocol, before any profile or directory entry settings.
+type ProtocolDefaults struct {
+	Charset string `json:"charset"`
+	// ANSINormalize turns the ANSI normalizer on or off; nil keeps the
+	// ANSI_NORMALIZE default
+	ANSINormalize *bool `json:"ansiNormalize,omitempty"`
+}
+
+// protocolDefaults returns the starting settings for protocol: telnet
+// boards are overwhelmingly CP437, SSH boards usually UTF-8.
+func protocolDefaults(protocol string) ProtocolDefaults {
+	cfg := LoadAppConfig()
+	d := ProtocolDefaults{Charset: "CP437"}
+	if strings.EqualFold(protocol, "ssh") {
+		d.Charset = "UTF-8"
+	}
+	if cfg != nil {
+		for name, o := range cfg.ProtocolDefaults {
+			if !strings.EqualFold(name, protocol) {
+				continue
+			}
+			if o.Charset != "" {
+				d.Charset = o.Charset
+			}
+			if o.ANSINormalize != nil {
+				d.ANSINormalize = o.ANSINormalize
+			}
+		}
+	}
+	return d
+}
+
+// sshTermType returns the terminal type requested for an SSH PTY: the
+// board's own, else the browser's preferred one, else config ssh.termType,
+// else "xterm-256color".
+func sshTermType(board BBSInfo, preferred string) string {
+	cfg := LoadAppConfig()
+	if board.TermType != "" {
+		return board.TermType
+	}
+	if preferred != "" {
+		return preferred
+	}
+	if cfg != nil && cfg.SSH.TermType != "" {
+		return cfg.SSH.TermType
+	}
+	return "xterm-256color"
+}
 
 // LoadConfig reads and parses a JSON config file and applies defaults where
 // appropriate. It returns an error if the file is missing or invalid.
@@ -44,22 +275,134 @@ func LoadConfig(path string) (*Config, error) {
         return nil, fmt.Errorf("error reading config file: %v", err)
     }
 
-	// Parse JSON
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file: %v", err)
+	}
+	// Stateless-only: no mode switching
+
+	StoreAppConfig(config)
+	return config, nil
+}
+
+// ParseConfig decodes config JSON and applies defaults without installing
+// it, so a candidate config can be checked before use.
+func ParseConfig(data []byte) (*Config, error) {
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing config file: %v", err)
+		return nil, err
 	}
 
 	// Set default values if not specified
 	if config.Server.Port == 0 {
 		config.Server.Port = 8080
 	}
-	// Stateless-only: no mode switching
-
-	AppConfig = &config
 	return &config, nil
 }
 
+// Validate reports configuration mistakes that would otherwise surface
+// only at runtime. All problems are returned together (errors.Join).
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		bad("server.port %d is out of range", c.Server.Port)
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		bad("server.tls needs both certFile and keyFile")
+	}
+	if c.Proxy.Enabled {
+		if c.Proxy.Host == "" || c.Proxy.Port < 1 || c.Proxy.Port > 65535 {
+			bad("proxy is enabled but host/port are not set")
+		}
+	}
+	if a := c.Connection.BindAddress; a != "" {
+		if err := checkBindAddress(a); err != nil {
+			bad("connection.bindAddress: %v", err)
+		}
+	}
+	seen := map[string]bool{}
+	for i, p := range c.Proxies {
+		switch {
+		case p.Name == "":
+			bad("proxies[%d] has no name", i)
+		case strings.EqualFold(p.Name, proxyDirect):
+			bad("proxies[%d]: %q is reserved", i, p.Name)
+		case seen[strings.ToLower(p.Name)]:
+			bad("proxies[%d]: duplicate name %q", i, p.Name)
+		}
+		seen[strings.ToLower(p.Name)] = true
+		if p.Host == "" || p.Port < 1 || p.Port > 65535 {
+			bad("proxies[%d] (%s): host/port are not set", i, p.Name)
+		}
+	}
+	if m := c.ANSI.CP437Mapping; m != "" && m != "true" && m != "compat" {
+		bad("ansi.cp437Mapping must be \"true\" or \"compat\", not %q", m)
+	}
+	switch c.ANSI.MusicFormat {
+	case "", musicFormatRaw, musicFormatNotes, musicFormatMIDI:
+	default:
+		bad("ansi.musicFormat must be \"raw\", \"notes\" or \"midi\", not %q", c.ANSI.MusicFormat)
+	}
+	if t := c.Capture.NameTemplate; t != "" {
+		if err := validateCaptureTemplate(t); err != nil {
+			bad("capture.nameTemplate: %v", err)
+		}
+	}
+	if q := strings.ToLower(c.Capture.QuotaPolicy); q != "" && q != "refuse" && q != "evict" {
+		bad("capture.quotaPolicy must be \"refuse\" or \"evict\", not %q", c.Capture.QuotaPolicy)
+	}
+	for _, p := range c.Terminal.ANSIPromptPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			bad("terminal.ansiPromptPatterns: %v", err)
+		}
+	}
+	for _, p := range c.Terminal.LogoutPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			bad("terminal.logoutPatterns: %v", err)
+		}
+	}
+	if _, err := resolveTerminalIdentity(c.Terminal.Identity); err != nil {
+		bad("terminal.identity: %v", err)
+	}
+	switch c.Terminal.NULPolicy {
+	case "", nulPolicyDrop, nulPolicyKeep, nulPolicySpace:
+	default:
+		bad("terminal.nulPolicy: must be drop, keep or space, got %q", c.Terminal.NULPolicy)
+	}
+	if err := validateTelnetSpeed(c.Terminal.TelnetSpeed); err != nil {
+		bad("terminal.telnetSpeed: %v", err)
+	}
+	switch c.Transfer.PartialFiles {
+	case "", partialFilesMark, partialFilesRefuse:
+	default:
+		bad("transfer.partialFiles: must be mark or refuse, got %q", c.Transfer.PartialFiles)
+	}
+	for name := range c.SSH.TerminalModes {
+		if _, ok := sshModeNames[strings.ToUpper(name)]; !ok {
+			bad("ssh.terminalModes: unknown mode %q", name)
+		}
+	}
+	for name := range c.ProtocolDefaults {
+		if !strings.EqualFold(name, "telnet") && !strings.EqualFold(name, "ssh") {
+			bad("protocolDefaults: unknown protocol %q", name)
+		}
+	}
+	for name, d := range c.ProtocolDefaults {
+		if d.Charset != "" && normalizeCharset(d.Charset) == "" {
+			bad("protocolDefaults.%s.charset: unsupported charset %q", name, d.Charset)
+		}
+	}
+	for name, p := range c.Profiles {
+		if p.Charset != "" && normalizeCharset(p.Charset) == "" {
+			bad("profiles.%s.charset: unsupported charset %q", name, p.Charset)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // GetBBSList returns the curated/approved BBS list populated from CSV.
 // Kept as a function for future flexibility.
 func GetBBSList() []BBSInfo {
@@ -67,3 +410,65 @@ func GetBBSList() []BBSInfo {
     // Maintains backward compatibility with existing handlers.
     return ApprovedBBSList
 }
+
+// ansiMaxSequenceBytes returns the configured cap on a buffered ANSI escape
+// sequence, defaulting to 4KB.
+func ansiMaxSequenceBytes() int {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.ANSI.MaxSequenceBytes > 0 {
+		return cfg.ANSI.MaxSequenceBytes
+	}
+	return 4096
+}
+
+// ansiMaxExpansion returns the bound on normalized output as a multiple of
+// the input, or 0 when unbounded.
+func ansiMaxExpansion() int {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.ANSI.MaxExpansion == 0 {
+		return 8
+	}
+	if cfg.ANSI.MaxExpansion < 0 {
+		return 0
+	}
+	return cfg.ANSI.MaxExpansion
+}
+
+// initialCPRWindow returns how long after connecting the first CPR request
+// is answered regardless of CPR policy; zero means disabled.
+func initialCPRWindow() time.Duration {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Terminal.InitialCPRWindowSeconds != 0 {
+		if cfg.Terminal.InitialCPRWindowSeconds < 0 {
+			return 0
+		}
+		return time.Duration(cfg.Terminal.InitialCPRWindowSeconds) * time.Second
+	}
+	return 5 * time.Second
+}
+
+// virtualScreenEnabled reports whether sessions keep a VTScreen model
+// (opt-in: every session pays for the cells and parsing).
+func virtualScreenEnabled() bool {
+	cfg := LoadAppConfig()
+	return cfg != nil && cfg.Terminal.VirtualScreen != nil && *cfg.Terminal.VirtualScreen
+}
+
+// screenModelEnabled reports whether new sessions get a VTScreen: when
+// terminal.virtualScreen is on, or for resume, which redraws from it.
+func screenModelEnabled() bool {
+	return virtualScreenEnabled() || resumeWindow() > 0
+}
+
+// connectCooldown returns the per-board reconnect backoff after a failure;
+// zero means disabled.
+func connectCooldown() time.Duration {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Connection.FailureCooldownSeconds != 0 {
+		if cfg.Connection.FailureCooldownSeconds < 0 {
+			return 0
+		}
+		return time.Duration(cfg.Connection.FailureCooldownSeconds) * time.Second
+	}
+	return 15 * time.Second
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+// useConfig makes cfg the active configuration for the rest of the test.
+func useConfig(t *testing.T, cfg *Config) {
+	t.Helper()
+	prev := LoadAppConfig()
+	StoreAppConfig(cfg)
+	t.Cleanup(func() { StoreAppConfig(prev) })
+}
+
+func TestVirtualScreenOptIn(t *testing.T) {
+	useConfig(t, nil)
+	if virtualScreenEnabled() {
+		t.Error("enabled without config")
+	}
+	cfg := &Config{}
+	useConfig(t, cfg)
+	if virtualScreenEnabled() {
+		t.Error("enabled when unset")
+	}
+	on := true
+	cfg.Terminal.VirtualScreen = &on
+	if !virtualScreenEnabled() {
+		t.Error("disabled when set to true")
+	}
+	if !currentFeatures().ScreenText {
+		t.Error("screenText feature not reported when enabled")
+	}
+}
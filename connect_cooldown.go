@@ -0,0 +1,88 @@
+package main
+
+// Connect cooldown. After a failed connect to a board, further attempts
+// from the same browser are refused for a short backoff so an impatient
+// user or a reconnect loop cannot hammer a board that is down. Failures are
+// kept server-wide by client token (or IP) and board, so a frontend that
+// reconnects on a new WebSocket still sees the cooldown.
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errConnectCooldown is returned for a connect refused by the cooldown,
+// after the browser has been sent the "cooldown" message.
+var errConnectCooldown = errors.New("endpoint cooling down after a failed connect")
+
+// connectFailures holds the last failed connect per client and board.
+var connectFailures = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: make(map[string]time.Time)}
+
+// boardKey identifies a remote endpoint for cooldown tracking.
+func boardKey(protocol, host string, port int) string {
+	return fmt.Sprintf("%s://%s:%d", strings.ToLower(protocol), strings.ToLower(host), port)
+}
+
+// cooldownKey scopes a board key to the browser: its client token, else
+// its IP address.
+func (c *Client) cooldownKey(key string) string {
+	owner := c.clientToken
+	if owner == "" {
+		owner = c.clientIP
+	}
+	return owner + " " + key
+}
+
+// recordConnectFailure starts the cooldown for key.
+func (c *Client) recordConnectFailure(key string) {
+	cooldown := connectCooldown()
+	if cooldown <= 0 {
+		return
+	}
+	now := time.Now()
+	connectFailures.Lock()
+	// Drop expired entries so the map stays bounded by recent failures
+	for k, at := range connectFailures.at {
+		if now.Sub(at) > cooldown {
+			delete(connectFailures.at, k)
+		}
+	}
+	connectFailures.at[c.cooldownKey(key)] = now
+	connectFailures.Unlock()
+}
+
+// checkConnectCooldown reports whether key is still cooling down after a
+// failure; if so the browser is sent a "cooldown" message with the time it
+// may retry.
+func (c *Client) checkConnectCooldown(key string) bool {
+	cooldown := connectCooldown()
+	k := c.cooldownKey(key)
+	connectFailures.Lock()
+	failedAt, ok := connectFailures.at[k]
+	connectFailures.Unlock()
+	if !ok || cooldown <= 0 {
+		return false
+	}
+	retryAt := failedAt.Add(cooldown)
+	if time.Now().After(retryAt) {
+		connectFailures.Lock()
+		delete(connectFailures.at, k)
+		connectFailures.Unlock()
+		return false
+	}
+	wait := time.Until(retryAt).Round(time.Second)
+	log.Printf("Connect to %s refused: cooling down for %v after failure", key, wait)
+	c.sendJSON(Message{
+		Type:    "cooldown",
+		Message: fmt.Sprintf("Last connection attempt failed; retry in %v", wait),
+		RetryAt: retryAt.UTC().Format(time.RFC3339),
+	})
+	return true
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestConnectCooldownSurvivesReconnect(t *testing.T) {
+	useConfig(t, &Config{})
+	key := boardKey("telnet", "Down.Example", 23)
+	var cooldowns int
+	newClient := func(token, ip string) *Client {
+		return &Client{clientToken: token, clientIP: ip, sink: func(m Message) {
+			if m.Type == "cooldown" {
+				cooldowns++
+			}
+		}}
+	}
+
+	newClient("tok-a", "192.0.2.1").recordConnectFailure(key)
+	// Same browser on a new WebSocket
+	if !newClient("tok-a", "192.0.2.1").checkConnectCooldown(boardKey("telnet", "down.example", 23)) {
+		t.Error("reconnected session not cooling down")
+	}
+	if cooldowns != 1 {
+		t.Errorf("cooldown messages = %d, want 1", cooldowns)
+	}
+	// Another browser, and the same browser on another board
+	if newClient("tok-b", "192.0.2.1").checkConnectCooldown(key) {
+		t.Error("other client token cooling down")
+	}
+	if newClient("tok-a", "192.0.2.1").checkConnectCooldown(boardKey("telnet", "up.example", 23)) {
+		t.Error("other board cooling down")
+	}
+	// Without a token the IP address identifies the browser
+	newClient("", "198.51.100.7").recordConnectFailure(key)
+	if !newClient("", "198.51.100.7").checkConnectCooldown(key) {
+		t.Error("IP-keyed session not cooling down")
+	}
+	if newClient("", "198.51.100.8").checkConnectCooldown(key) {
+		t.Error("other IP cooling down")
+	}
+}
+
+func TestConnectCooldownDisabled(t *testing.T) {
+	cfg := &Config{}
+	cfg.Connection.FailureCooldownSeconds = -1
+	useConfig(t, cfg)
+	key := boardKey("ssh", "off.example", 22)
+	c := &Client{clientToken: "tok-off", sink: func(Message) {}}
+	c.recordConnectFailure(key)
+	if c.checkConnectCooldown(key) {
+		t.Error("cooldown applied while disabled")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+// Connection log. An optional append-only JSON-lines file with one record
+// per connect and disconnect, kept separate from the application log so it
+// can be retained and analyzed. Rotated by size.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConnectionLogRecord is one line of the connection log.
+type ConnectionLogRecord struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"` // "connect" or "disconnect"
+	SessionID string    `json:"sessionId"`
+	ClientIP  string    `json:"clientIp"`
+	BoardID   string    `json:"boardId,omitempty"`
+	Board     string    `json:"board,omitempty"`
+	Address   string    `json:"address"`
+	Protocol  string    `json:"protocol"`
+	// Disconnect only
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	BytesIn         int64   `json:"bytesIn,omitempty"`
+	BytesOut        int64   `json:"bytesOut,omitempty"`
+}
+
+// connectionLogger appends records to a file, rotating it to path.1,
+// path.2, ... once it exceeds maxBytes.
+type connectionLogger struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	file     *os.File
+	size     int64
+}
+
+// connLog is the process-wide connection log; nil when disabled.
+var connLog *connectionLogger
+
+// openConnectionLog opens (or creates) the log at path for appending.
+func openConnectionLog(path string, maxBytes int64, keep int) (*connectionLogger, error) {
+	if maxBytes <= 0 {
+		maxBytes = 10 << 20
+	}
+	if keep <= 0 {
+		keep = 3
+	}
+	l := &connectionLogger{path: path, maxBytes: maxBytes, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *connectionLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("open connection log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat connection log: %w", err)
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 to path.N down to path -> path.1 and reopens.
+func (l *connectionLogger) rotate() error {
+	l.file.Close()
+	for i := l.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil && !os.IsNotExist(err) {
+		log.Printf("Connection log: rotate failed: %v", err)
+	}
+	return l.open()
+}
+
+// Write appends one record, rotating first if the file is full.
+func (l *connectionLogger) Write(rec ConnectionLogRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.size+int64(len(line)) > l.maxBytes && l.size > 0 {
+		if err := l.rotate(); err != nil {
+			log.Printf("Connection log disabled: %v", err)
+			l.file = nil
+			return
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("Connection log write failed: %v", err)
+	}
+}
+
+// newSessionID returns a random identifier for a browser session.
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// clientIP extracts the peer address of a request without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// logConnectionLocked writes a connect/disconnect record for the current
+// remote; the caller holds c.mu.
+func (c *Client) logConnectionLocked(event string) {
+	if connLog == nil {
+		return
+	}
+	rec := ConnectionLogRecord{
+		Time:      time.Now().UTC(),
+		Event:     event,
+		SessionID: c.sessionID,
+		ClientIP:  c.clientIP,
+		BoardID:   c.board.ID,
+		Board:     c.board.Name,
+		Address:   c.remoteAddr,
+		Protocol:  c.remoteProtocol,
+	}
+	if event == "disconnect" {
+		rec.DurationSeconds = time.Since(c.connectedAt).Round(time.Second).Seconds()
+		rec.BytesIn = c.bytesIn.Load()
+		rec.BytesOut = c.bytesOut.Load()
+	}
+	connLog.Write(rec)
+}
@@ -42,6 +42,50 @@ var cp437ToUnicodeEnhanced = [256]rune{
 	0x00B0, 0x2219, 0x00B7, 0x221A, 0x207F, 0x00B2, 0x25A0, 0x00A0,
 }
 
+// cp437CompatOverrides replaces glyphs that many browser fonts lack with
+// widely-supported code points. Mixed single/double box characters keep
+// their horizontal line style; rare symbols fall back to ASCII look-alikes.
+var cp437CompatOverrides = map[byte]rune{
+	0x7F: 0x0394, // ⌂ house -> Δ
+	0x9E: 'P',    // ₧ peseta
+	0xA9: 0x00AC, // ⌐ reversed not -> ¬
+	0xB5: 0x2563, // ╡ -> ╣
+	0xB6: 0x2524, // ╢ -> ┤
+	0xB7: 0x2510, // ╖ -> ┐
+	0xB8: 0x2557, // ╕ -> ╗
+	0xBD: 0x2518, // ╜ -> ┘
+	0xBE: 0x255D, // ╛ -> ╝
+	0xC6: 0x2560, // ╞ -> ╠
+	0xC7: 0x251C, // ╟ -> ├
+	0xCF: 0x2569, // ╧ -> ╩
+	0xD0: 0x2534, // ╨ -> ┴
+	0xD1: 0x2566, // ╤ -> ╦
+	0xD2: 0x252C, // ╥ -> ┬
+	0xD3: 0x2514, // ╙ -> └
+	0xD4: 0x255A, // ╘ -> ╚
+	0xD5: 0x2554, // ╒ -> ╔
+	0xD6: 0x250C, // ╓ -> ┌
+	0xD7: 0x253C, // ╫ -> ┼
+	0xD8: 0x256C, // ╪ -> ╬
+	0xF4: 0x2502, // ⌠ top half integral -> │
+	0xF5: 0x2502, // ⌡ bottom half integral -> │
+	0xF9: 0x00B7, // ∙ bullet operator -> ·
+	0xFC: 'n',    // ⁿ superscript n
+}
+
+// cp437ToUnicodeCompat is the "compatibility" mapping selected with
+// ansi.cp437Mapping = "compat"; the true mapping stays the default.
+var cp437ToUnicodeCompat [256]rune
+
+// activeCP437Table returns the CP437 -> Unicode table selected in config.
+func activeCP437Table() *[256]rune {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.ANSI.CP437Mapping == "compat" {
+		return &cp437ToUnicodeCompat
+	}
+	return &cp437ToUnicodeEnhanced
+}
+
 // Reverse lookup: Unicode rune -> CP437 byte
 var unicodeToCP437Enhanced map[rune]byte
 
@@ -65,6 +109,12 @@ func init() {
 	unicodeToCP437Enhanced[0x2580] = 0xDF // Upper half block
 	unicodeToCP437Enhanced[0x258C] = 0xDD // Left half block
 	unicodeToCP437Enhanced[0x2590] = 0xDE // Right half block
+
+	// Build the compatibility table from the true mapping
+	cp437ToUnicodeCompat = cp437ToUnicodeEnhanced
+	for b, r := range cp437CompatOverrides {
+		cp437ToUnicodeCompat[b] = r
+	}
 }
 
 // ConvertCP437ToUTF8Enhanced converts CP437 encoded bytes to UTF-8 string
@@ -72,6 +122,7 @@ func init() {
 func ConvertCP437ToUTF8Enhanced(data []byte) string {
 	runes := make([]rune, 0, len(data))
 	inAnsiSequence := false
+	table := activeCP437Table()
 	
 	for i := 0; i < len(data); i++ {
 		b := data[i]
@@ -97,7 +148,7 @@ func ConvertCP437ToUTF8Enhanced(data []byte) string {
 			runes = append(runes, rune(b))
 		} else {
 			// Convert CP437 character to Unicode
-			runes = append(runes, cp437ToUnicodeEnhanced[b])
+			runes = append(runes, table[b])
 		}
 	}
 	return string(runes)
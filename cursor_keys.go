@@ -0,0 +1,40 @@
+package main
+
+// Cursor key mode (DECCKM). Boards that switch to application cursor keys
+// (ESC[?1h) expect arrows as ESC O A rather than ESC [ A. The browser
+// terminal may not see the switch (output filtering, a reconnect, a RIS
+// it handled differently), so the session tracks the mode from the
+// board's output (TerminalModes) and rewrites the browser's cursor keys to
+// match.
+
+import "strings"
+
+// cursorKeyFinals are the finals DECCKM affects: arrows, Home and End.
+const cursorKeyFinals = "ABCDHF"
+
+// translateCursorKeys rewrites unmodified cursor key sequences to the
+// board's mode: ESC [ x to ESC O x in application mode, and back in
+// normal mode. Modified keys (ESC[1;5A) are left alone.
+func translateCursorKeys(data string, app bool) string {
+	from, to := "\x1b[", "\x1bO"
+	if !app {
+		from, to = to, from
+	}
+	if !strings.Contains(data, from) {
+		return data
+	}
+	var b strings.Builder
+	b.Grow(len(data))
+	for i := 0; i < len(data); {
+		if strings.HasPrefix(data[i:], from) && i+2 < len(data) &&
+			strings.IndexByte(cursorKeyFinals, data[i+2]) >= 0 {
+			b.WriteString(to)
+			b.WriteByte(data[i+2])
+			i += 3
+			continue
+		}
+		b.WriteByte(data[i])
+		i++
+	}
+	return b.String()
+}
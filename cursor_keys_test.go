@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestTranslateCursorKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		app  bool
+		want string
+	}{
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", true, "\x1bOA\x1bOB\x1bOC\x1bOD"},
+		{"\x1b[H\x1b[F", true, "\x1bOH\x1bOF"},
+		{"\x1bOA\x1bOD", false, "\x1b[A\x1b[D"},
+		{"\x1b[A", false, "\x1b[A"},
+		{"\x1bOA", true, "\x1bOA"},
+		{"\x1b[1;5A", true, "\x1b[1;5A"}, // modified keys keep CSI form
+		{"\x1b[2~\x1b[K", true, "\x1b[2~\x1b[K"},
+		{"x\x1b[", true, "x\x1b["}, // truncated at the end
+		{"plain text", true, "plain text"},
+	}
+	for _, tt := range tests {
+		if got := translateCursorKeys(tt.in, tt.app); got != tt.want {
+			t.Errorf("translateCursorKeys(%q, %v) = %q, want %q", tt.in, tt.app, got, tt.want)
+		}
+	}
+}
+
+func TestDECCKMToggleTranslatesArrows(t *testing.T) {
+	remote := &scriptedRemote{}
+	c := &Client{charset: "UTF-8", telnet: remote, modes: defaultTerminalModes()}
+	steps := []struct {
+		board string // board output before the key
+		key   string
+		want  string
+	}{
+		{"", "\x1b[A", "\x1b[A"},
+		{"\x1b[?1h", "\x1b[A", "\x1bOA"},
+		{"menu", "\x1b[D", "\x1bOD"}, // mode persists across output
+		{"\x1b[?1l", "\x1bOB", "\x1b[B"},
+		{"\x1b[?1h\x1bc", "\x1b[C", "\x1b[C"}, // RIS restores normal keys
+	}
+	for _, s := range steps {
+		remote.written = nil
+		c.trackTerminalModes([]byte(s.board))
+		c.sendToRemote(s.key)
+		if got := string(remote.written); got != s.want {
+			t.Errorf("after %q, key %q: board got %q, want %q", s.board, s.key, got, s.want)
+		}
+	}
+}
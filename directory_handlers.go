@@ -12,9 +12,11 @@ import (
     "regexp"
     "strconv"
     "strings"
+    "time"
 )
 
-// handleGetBBSDirectory returns the full BBS directory.
+// handleGetBBSDirectory returns the full BBS directory, sorted by
+// ?sort=name|software|location|port and ?order=asc|desc (default name, asc).
 // Note: bbs.csv is the single source of truth; failures return an empty list
 // so the UI remains responsive even if the file is temporarily unavailable.
 func handleGetBBSDirectory(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +33,16 @@ func handleGetBBSDirectory(w http.ResponseWriter, r *http.Request) {
         json.NewEncoder(w).Encode([]BBSEntry{})
         return
     }
+    if err := sortBBSEntries(entries, r.URL.Query().Get("sort"), r.URL.Query().Get("order")); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    // Mark the caller's server-side favorites
+    if favs := favoriteSet(r); len(favs) > 0 {
+        for i := range entries {
+            entries[i].IsFavorite = favs[entries[i].ID]
+        }
+    }
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(entries)
 }
@@ -55,6 +67,23 @@ func handleImportBBSGuide(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // Keep the listing date of boards already in the directory; new
+    // boards are stamped now (feeds /api/bbs-feed.xml)
+    added := map[string]time.Time{}
+    if existing, err := GetBBSDirectoryEntries(); err == nil {
+        for _, e := range existing {
+            added[strings.ToLower(e.Name)] = e.AddedAt
+        }
+    }
+    now := time.Now().UTC().Truncate(time.Second)
+    for i := range entries {
+        if t, ok := added[strings.ToLower(entries[i].Name)]; ok {
+            entries[i].AddedAt = t
+        } else {
+            entries[i].AddedAt = now
+        }
+    }
+
     // Write to bbs.csv (single source of truth)
     f, err := os.Create("bbs.csv")
     if err != nil {
@@ -65,7 +94,7 @@ func handleImportBBSGuide(w http.ResponseWriter, r *http.Request) {
 
     cw := csv.NewWriter(f)
     // Header must match LoadBBSFromCSV expectations
-    if err := cw.Write([]string{"Name", "Software", "Telnet Server Address"}); err != nil {
+    if err := cw.Write([]string{"Name", "Software", "Telnet Server Address", "Added"}); err != nil {
         http.Error(w, "Failed to write CSV header", http.StatusInternalServerError)
         return
     }
@@ -74,7 +103,15 @@ func handleImportBBSGuide(w http.ResponseWriter, r *http.Request) {
         if e.Port > 0 {
             addr = addr + ":" + strconv.Itoa(e.Port)
         }
-        if err := cw.Write([]string{e.Name, e.Software, addr}); err != nil {
+        // Keep non-telnet protocols through the CSV round trip
+        if e.Protocol != "" && !strings.EqualFold(e.Protocol, "telnet") {
+            addr = strings.ToLower(e.Protocol) + "://" + addr
+        }
+        var addedAt string
+        if !e.AddedAt.IsZero() {
+            addedAt = e.AddedAt.Format(time.RFC3339)
+        }
+        if err := cw.Write([]string{e.Name, e.Software, addr, addedAt}); err != nil {
             http.Error(w, "Failed to write CSV row", http.StatusInternalServerError)
             return
         }
@@ -111,12 +148,12 @@ func parseBBSGuide(text string) []BBSEntry {
         }
         // Only include if we have host
         if cur.Host != "" {
-            if cur.Port == 0 {
-                cur.Port = 23
-            }
             if cur.Protocol == "" {
                 cur.Protocol = "telnet"
             }
+            if cur.Port == 0 {
+                cur.Port = defaultPort(cur.Protocol)
+            }
             // ensure defaults
             if cur.Encoding == "" {
                 cur.Encoding = "CP437"
@@ -151,32 +188,14 @@ func parseBBSGuide(text string) []BBSEntry {
             if cur == nil {
                 cur = &BBSEntry{}
             }
-            addr := strings.TrimSpace(m[1])
-            // strip protocol-like prefixes
-            if i := strings.Index(addr, "//"); i != -1 {
-                addr = addr[i+2:]
-            }
-            // remove username@ if present
-            if i := strings.LastIndex(addr, "@"); i != -1 {
-                addr = addr[i+1:]
-            }
-            host := addr
-            port := 23
-            if i := strings.LastIndex(addr, ":"); i != -1 {
-                host = addr[:i]
-                p := addr[i+1:]
-                if p != "" {
-                    if v, err := strconv.Atoi(p); err == nil {
-                        port = v
-                    }
-                }
-            }
+            // Strips scheme and username@; the port defaults by protocol
+            host, port, protocol := parseBoardAddress(strings.TrimSpace(m[1]), "")
             cur.Host = host
             cur.Port = port
             if cur.Name == "" {
                 cur.Name = host
             }
-            cur.Protocol = "telnet"
+            cur.Protocol = protocol
             continue
         }
 
@@ -221,4 +240,3 @@ func parseBBSGuide(text string) []BBSEntry {
     return entries
 }
 
-// Favorites endpoint intentionally omitted; single source is bbs.csv
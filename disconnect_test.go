@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingRemote is a RemoteConn whose Read blocks until Close, then fails
+// like a socket closed under a pending read.
+type blockingRemote struct {
+	scriptedRemote
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newBlockingRemote() *blockingRemote {
+	return &blockingRemote{closed: make(chan struct{})}
+}
+
+func (r *blockingRemote) Read([]byte) (int, error) {
+	<-r.closed
+	return 0, errors.New("use of closed network connection")
+}
+
+func (r *blockingRemote) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+// eofRemote ends the script with io.EOF instead of detaching.
+type eofRemote struct {
+	*scriptedRemote
+}
+
+func (r *eofRemote) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	empty := len(r.reads) == 0
+	r.mu.Unlock()
+	if empty {
+		return 0, io.EOF
+	}
+	return r.scriptedRemote.Read(p)
+}
+
+// disconnectRecorder attaches remote to a session and collects the reasons
+// of the "disconnected" messages it sends.
+func disconnectRecorder(remote RemoteConn) (*Client, func() []string) {
+	var mu sync.Mutex
+	var reasons []string
+	c := &Client{telnet: remote, done: make(chan bool, 1), events: true}
+	c.sink = func(msg Message) {
+		if msg.Type == "disconnected" {
+			mu.Lock()
+			reasons = append(reasons, msg.Message)
+			mu.Unlock()
+		}
+	}
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), reasons...)
+	}
+}
+
+func TestSingleDisconnectWhenBoardCloses(t *testing.T) {
+	remote := &scriptedRemote{reads: [][]byte{[]byte("bye\r\n")}}
+	// After the script the board hangs up
+	c, reasons := disconnectRecorder(&eofRemote{remote})
+	c.readTelnet(c.telnet)
+	c.endSession("closed by user") // the browser's disconnect arriving late
+	c.disconnect()                 // and a sendJSON write-error cleanup
+	if got := reasons(); len(got) != 1 || got[0] != "closed by board" {
+		t.Errorf("disconnected messages %q, want one \"closed by board\"", got)
+	}
+}
+
+func TestSingleDisconnectWhenUserCloses(t *testing.T) {
+	remote := newBlockingRemote()
+	c, reasons := disconnectRecorder(remote)
+	returned := make(chan struct{})
+	go func() {
+		c.readTelnet(remote)
+		close(returned)
+	}()
+	// Closing the socket fails the pending read; only the user's reason
+	// reaches the browser
+	c.endSession("closed by user")
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readTelnet still running")
+	}
+	if got := reasons(); len(got) != 1 || got[0] != "closed by user" {
+		t.Errorf("disconnected messages %q, want one \"closed by user\"", got)
+	}
+}
+
+func TestSingleDisconnectConcurrentTeardown(t *testing.T) {
+	for run := 0; run < 20; run++ {
+		c, reasons := disconnectRecorder(newBlockingRemote())
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.endSession("teardown")
+			}()
+		}
+		wg.Wait()
+		if got := reasons(); len(got) != 1 {
+			t.Fatalf("run %d: %d disconnected messages, want 1", run, len(got))
+		}
+	}
+}
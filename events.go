@@ -0,0 +1,43 @@
+package main
+
+// Opt-in session timeline. A client that sends {"type":"subscribeEvents",
+// "enable":true} receives "event" messages for notable moments in the
+// session: name is the event kind, message a short human-readable detail
+// and time an RFC 3339 timestamp. Clients that do not subscribe pay
+// nothing beyond a flag check.
+
+import "time"
+
+// Session event kinds.
+const (
+	eventConnected    = "connected"
+	eventNegotiation  = "negotiation"
+	eventCharset      = "charset"
+	eventTransfer     = "transfer"
+	eventMusic        = "music"
+	eventDisconnected = "disconnected"
+)
+
+// setEventsEnabled turns the event stream on or off for the session.
+func (c *Client) setEventsEnabled(on bool) {
+	c.mu.Lock()
+	c.events = on
+	c.mu.Unlock()
+}
+
+// emitEvent sends an "event" message if the client subscribed. Must not
+// be called with c.mu held.
+func (c *Client) emitEvent(kind, detail string) {
+	c.mu.Lock()
+	on := c.events
+	c.mu.Unlock()
+	if !on {
+		return
+	}
+	c.sendJSON(Message{
+		Type:    "event",
+		Name:    kind,
+		Message: detail,
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+// SSH to telnet fallback for boards that offer both. A directory entry may
+// name a telnet endpoint (CSV "Fallback", "telnet://host:port") that is
+// tried when its SSH endpoint cannot be reached or fails the handshake.
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseFallback splits a "telnet://host:port" fallback into host and port.
+func parseFallback(s string) (string, int, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return "", 0, err
+	}
+	if !strings.EqualFold(u.Scheme, "telnet") {
+		return "", 0, fmt.Errorf("fallback must be telnet://host:port, got %q", s)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil || host == "" {
+		return "", 0, fmt.Errorf("fallback needs an explicit host:port, got %q", s)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("fallback port out of range in %q", s)
+	}
+	return host, port, nil
+}
+
+// connectSSHWithFallback connects over SSH and, if that fails before a
+// session exists and the board declares a fallback, connects to the
+// fallback's telnet endpoint instead.
+func (c *Client) connectSSHWithFallback(host string, port int, username, password string) {
+	err := c.connectSSH(host, port, username, password)
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	fallback := c.board.Fallback
+	c.mu.Unlock()
+	if fallback == "" {
+		// A cooldown has already told the browser when to retry
+		if !errors.Is(err, errConnectCooldown) {
+			c.sendMessage("error", err.Error())
+		}
+		return
+	}
+	fhost, fport, perr := parseFallback(fallback)
+	if perr != nil {
+		log.Printf("Ignoring fallback for %s:%d: %v", host, port, perr)
+		if !errors.Is(err, errConnectCooldown) {
+			c.sendMessage("error", err.Error())
+		}
+		return
+	}
+	// Captures and logs should name the endpoint actually in use
+	c.mu.Lock()
+	c.board.Protocol, c.board.Host, c.board.Port = "telnet", fhost, fport
+	c.mu.Unlock()
+	log.Printf("SSH to %s:%d failed (%v); falling back to telnet %s:%d", host, port, err, fhost, fport)
+	c.sendMessage("fallback", fmt.Sprintf("SSH connection failed (%v); trying telnet at %s:%d", err, fhost, fport))
+	c.connectTelnet(fhost, fport)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseFallback(t *testing.T) {
+	tests := []struct {
+		in   string
+		host string
+		port int
+		ok   bool
+	}{
+		{"telnet://bbs.example.com:23", "bbs.example.com", 23, true},
+		{" TELNET://bbs.example.com:6023 ", "bbs.example.com", 6023, true},
+		{"telnet://[::1]:2323", "::1", 2323, true},
+		{"telnet://bbs.example.com", "", 0, false}, // port required
+		{"ssh://bbs.example.com:22", "", 0, false},
+		{"bbs.example.com:23", "", 0, false},
+		{"telnet://:23", "", 0, false},
+		{"telnet://bbs.example.com:0", "", 0, false},
+		{"telnet://bbs.example.com:70000", "", 0, false},
+		{"telnet://bbs.example.com:telnet", "", 0, false},
+	}
+	for _, tt := range tests {
+		host, port, err := parseFallback(tt.in)
+		if (err == nil) != tt.ok || host != tt.host || port != tt.port {
+			t.Errorf("parseFallback(%q) = %q, %d, %v; want %q, %d, ok=%v",
+				tt.in, host, port, err, tt.host, tt.port, tt.ok)
+		}
+	}
+}
+
+// hangUpListener accepts one connection on loopback and closes it at
+// once, failing any SSH handshake.
+func hangUpListener(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// runFallback connects c to the SSH endpoint on sshPort, with a loopback
+// telnet fallback that greets and closes. It returns the "cooldown" and
+// "fallback" message types and decoded data seen up to the greeting, and
+// the fallback's port.
+func runFallback(t *testing.T, c *Client, sshPort int) ([]string, int) {
+	t.Helper()
+	telnetLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer telnetLn.Close()
+	go func() {
+		if conn, err := telnetLn.Accept(); err == nil {
+			conn.Write([]byte("fallback ok\r\n"))
+			time.Sleep(200 * time.Millisecond)
+			conn.Close()
+		}
+	}()
+
+	var mu sync.Mutex
+	var got []string
+	gotData := make(chan struct{}, 1)
+	c.sink = func(msg Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch msg.Type {
+		case "cooldown", "fallback":
+			got = append(got, msg.Type)
+		case "data":
+			data, _ := base64.StdEncoding.DecodeString(msg.Data)
+			got = append(got, string(data))
+			select {
+			case gotData <- struct{}{}:
+			default:
+			}
+		}
+	}
+	c.board = BBSInfo{
+		Protocol: "ssh",
+		Host:     "127.0.0.1",
+		Port:     sshPort,
+		Fallback: "telnet://" + telnetLn.Addr().String(),
+	}
+	go c.connectSSHWithFallback("127.0.0.1", sshPort, "test", "")
+	select {
+	case <-gotData:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no data from the telnet fallback")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return slices.Clone(got), telnetLn.Addr().(*net.TCPAddr).Port
+}
+
+// fallbackClient returns a session ready to render a telnet greeting.
+func fallbackClient() *Client {
+	return &Client{
+		charset:      "CP437",
+		ansiEnhanced: NewANSIEnhancedProcessor(false, DefaultANSIOptions()),
+		termCols:     80,
+		termRows:     25,
+		modes:        defaultTerminalModes(),
+		proxyName:    proxyDirect,
+	}
+}
+
+// TestSSHFallsBackToTelnet points a session at a loopback "SSH" endpoint
+// that hangs up before the handshake.
+func TestSSHFallsBackToTelnet(t *testing.T) {
+	c := fallbackClient()
+	got, telnetPort := runFallback(t, c, hangUpListener(t))
+	if want := []string{"fallback", "fallback ok\r\n"}; !slices.Equal(got, want) {
+		t.Errorf("messages %q, want %q", got, want)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.board.Protocol != "telnet" || c.board.Port != telnetPort {
+		t.Errorf("board is %s:%d, want the telnet fallback", c.board.Protocol, c.board.Port)
+	}
+}
+
+// TestSSHCooldownFallsBackToTelnet reconnects while the SSH endpoint is
+// cooling down: the telnet side is tried without dialing SSH again.
+func TestSSHCooldownFallsBackToTelnet(t *testing.T) {
+	cfg := &Config{}
+	cfg.Recent.Max = -1 // keep the fallback connect out of recent.json
+	useConfig(t, cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close() // nothing should dial it
+	sshPort := ln.Addr().(*net.TCPAddr).Port
+
+	c := fallbackClient()
+	c.clientToken = "cooldown-fallback"
+	c.recordConnectFailure(boardKey("ssh", "127.0.0.1", sshPort))
+	got, _ := runFallback(t, c, sshPort)
+	if want := []string{"cooldown", "fallback", "fallback ok\r\n"}; !slices.Equal(got, want) {
+		t.Errorf("messages %q, want %q", got, want)
+	}
+}
+
+func TestSSHCooldownWithoutFallback(t *testing.T) {
+	useConfig(t, &Config{})
+	var types []string
+	c := &Client{clientToken: "cooldown-only", proxyName: proxyDirect}
+	c.sink = func(msg Message) { types = append(types, msg.Type) }
+	c.recordConnectFailure(boardKey("ssh", "127.0.0.1", 2222))
+	c.board = BBSInfo{Protocol: "ssh", Host: "127.0.0.1", Port: 2222}
+	c.connectSSHWithFallback("127.0.0.1", 2222, "test", "")
+	if want := []string{"cooldown"}; !slices.Equal(types, want) {
+		t.Errorf("messages %v, want %v", types, want)
+	}
+}
+
+// TestSSHFailureWithoutFallback checks that a board without a fallback
+// reports the SSH error and does not try telnet.
+func TestSSHFailureWithoutFallback(t *testing.T) {
+	port := hangUpListener(t)
+	var types []string
+	c := &Client{proxyName: proxyDirect}
+	c.sink = func(msg Message) { types = append(types, msg.Type) }
+	c.board = BBSInfo{Protocol: "ssh", Host: "127.0.0.1", Port: port}
+	c.connectSSHWithFallback("127.0.0.1", port, "test", "")
+
+	if !slices.Contains(types, "error") || slices.Contains(types, "fallback") {
+		t.Errorf("messages %v, want an error and no fallback", types)
+	}
+	if c.board.Protocol != "ssh" || c.board.Port != port {
+		t.Errorf("board changed to %s:%d without a fallback", c.board.Protocol, c.board.Port)
+	}
+}
+
+func TestLoadBBSFromCSVFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bbs.csv")
+	csv := "Name,Software,Telnet Server Address,Protocol,Fallback\n" +
+		"Good,Mystic,ssh://good.example.com,,telnet://good.example.com:23\n" +
+		"Telnet Board,Mystic,plain.example.com,,telnet://plain.example.com:2323\n" +
+		"Bad URL,Mystic,ssh://bad.example.com,,bad.example.com:23\n"
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := LoadBBSFromCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Good":         "telnet://good.example.com:23",
+		"Telnet Board": "", // only SSH boards fall back
+		"Bad URL":      "",
+	}
+	for _, e := range entries {
+		if w, ok := want[e.Name]; ok && e.Fallback != w {
+			t.Errorf("%s: fallback %q, want %q", e.Name, e.Fallback, w)
+		}
+	}
+	if len(entries) != len(want) {
+		t.Errorf("loaded %d entries, want %d", len(entries), len(want))
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+// Server-side favorites. The app has no accounts, so favorites are scoped by
+// an opaque client token (a long-lived cookie, or the X-Client-Token header
+// for non-browser clients) and persisted in favorites.json keyed by a hash
+// of that token. Tokens are signed when issued and others are ignored, so
+// the stores only hold clients this server handed a token to.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	clientTokenCookie = "retroterm_client"
+	clientTokenHeader = "X-Client-Token"
+	// maxFavorites bounds one client's list
+	maxFavorites = 500
+	// maxStoredClients bounds each client store; the clients changed
+	// longest ago are dropped first
+	maxStoredClients = 10000
+)
+
+// clientToken returns the caller's client token, ignoring tokens this
+// server did not issue. With create set, a new token is issued as a cookie
+// when the request carries none.
+func clientToken(w http.ResponseWriter, r *http.Request, create bool) string {
+	if t := strings.TrimSpace(r.Header.Get(clientTokenHeader)); validClientToken(t) {
+		return t
+	}
+	if ck, err := r.Cookie(clientTokenCookie); err == nil && validClientToken(ck.Value) {
+		return ck.Value
+	}
+	if !create {
+		return ""
+	}
+	ck := newClientTokenCookie(r)
+	http.SetCookie(w, ck)
+	return ck.Value
+}
+
+// newClientTokenCookie issues a fresh client token cookie.
+func newClientTokenCookie(r *http.Request) *http.Cookie {
+	return &http.Cookie{
+		Name:     clientTokenCookie,
+		Value:    newClientToken(),
+		Path:     "/",
+		Expires:  time.Now().AddDate(1, 0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+	}
+}
+
+// clientTokenKey signs issued tokens. It is kept in client_token.key beside
+// the favorites file so tokens stay valid across restarts.
+var clientTokenKey struct {
+	sync.Mutex
+	key []byte
+}
+
+// clientTokenSigningKey loads the signing key, creating it on first use.
+func clientTokenSigningKey() []byte {
+	clientTokenKey.Lock()
+	defer clientTokenKey.Unlock()
+	if clientTokenKey.key != nil {
+		return clientTokenKey.key
+	}
+	path := filepath.Join(filepath.Dir(favoritesPath()), "client_token.key")
+	if raw, err := os.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(raw))); err == nil && len(key) >= 32 {
+			clientTokenKey.key = key
+			return key
+		}
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		log.Printf("Client token key not saved, tokens will not survive a restart: %v", err)
+	}
+	clientTokenKey.key = key
+	return key
+}
+
+// signClientToken returns the signature part of a token for id.
+func signClientToken(id string) string {
+	mac := hmac.New(sha256.New, clientTokenSigningKey())
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// newClientToken issues a token: a random id and its signature.
+func newClientToken() string {
+	id := newSessionID() + newSessionID()
+	return id + "." + signClientToken(id)
+}
+
+// validClientToken reports whether token was issued by this server.
+func validClientToken(token string) bool {
+	id, sig, ok := strings.Cut(token, ".")
+	return ok && id != "" && hmac.Equal([]byte(sig), []byte(signClientToken(id)))
+}
+
+// clientKey hashes a client token for storage so the store never holds
+// usable tokens.
+func clientKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientStore is a small JSON file mapping client keys to per-client data,
+// shared by favorites and connection history. It keeps at most
+// maxStoredClients clients.
+type clientStore[T any] struct {
+	mu          sync.Mutex
+	defaultPath func() string // resolved on first use, after config loads
+	path        string
+	loaded      bool
+	data        map[string]clientEntry[T]
+}
+
+// clientEntry is one client's value and when it last changed.
+type clientEntry[T any] struct {
+	Value   T         `json:"value"`
+	Changed time.Time `json:"changed"`
+}
+
+// load reads the file once; a missing file is an empty store. Caller holds mu.
+func (s *clientStore[T]) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.path == "" {
+		s.path = s.defaultPath()
+	}
+	s.data = make(map[string]clientEntry[T])
+	raw, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read %s: %w", s.path, err)
+	}
+	if len(raw) > 0 {
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return fmt.Errorf("parse %s: %w", s.path, err)
+		}
+		for key, v := range entries {
+			var e clientEntry[T]
+			if err := json.Unmarshal(v, &e); err != nil {
+				// Files written before entries carried a change time
+				if err := json.Unmarshal(v, &e.Value); err != nil {
+					return fmt.Errorf("parse %s: %w", s.path, err)
+				}
+			}
+			s.data[key] = e
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// prune drops the clients changed longest ago beyond maxStoredClients.
+// Caller holds mu.
+func (s *clientStore[T]) prune() {
+	for len(s.data) > maxStoredClients {
+		var oldest string
+		for key, e := range s.data {
+			if oldest == "" || e.Changed.Before(s.data[oldest].Changed) {
+				oldest = key
+			}
+		}
+		delete(s.data, oldest)
+	}
+}
+
+// save writes the store atomically. Caller holds mu.
+func (s *clientStore[T]) save() error {
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// get returns the stored value for a client.
+func (s *clientStore[T]) get(token string) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var zero T
+	if err := s.load(); err != nil {
+		return zero, err
+	}
+	return s.data[clientKey(token)].Value, nil
+}
+
+// update applies fn to a client's value and persists the result.
+func (s *clientStore[T]) update(token string, fn func(T) T) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var zero T
+	if err := s.load(); err != nil {
+		return zero, err
+	}
+	key := clientKey(token)
+	v := fn(s.data[key].Value)
+	s.data[key] = clientEntry[T]{Value: v, Changed: time.Now().UTC()}
+	s.prune()
+	if err := s.save(); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// favoritesStore holds each client's favorite BBS IDs.
+var favoritesStore = &clientStore[[]string]{defaultPath: favoritesPath}
+
+// favoritesPath returns the favorites file (default "favorites.json").
+func favoritesPath() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Favorites.Path != "" {
+		return cfg.Favorites.Path
+	}
+	return "favorites.json"
+}
+
+// favoriteSet returns the caller's favorites as a set; empty without a token.
+func favoriteSet(r *http.Request) map[string]bool {
+	token := clientToken(nil, r, false)
+	if token == "" {
+		return nil
+	}
+	ids, err := favoritesStore.get(token)
+	if err != nil {
+		return nil
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// knownBBSID reports whether id is in the directory.
+func knownBBSID(id string) bool {
+	entries, err := GetBBSDirectoryEntries()
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// handleFavorite lists (GET), adds (POST) or removes (DELETE) a favorite
+// for the calling client. The BBS ID comes from ?id= or a JSON body
+// {"id": "..."}.
+func handleFavorite(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ids := []string{}
+		if token := clientToken(w, r, false); token != "" {
+			if got, err := favoritesStore.get(token); err == nil && got != nil {
+				ids = got
+			}
+		}
+		writeFavorites(w, ids)
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" && r.Body != nil {
+		var body struct {
+			ID string `json:"id"`
+		}
+		_ = json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body)
+		id = body.ID
+	}
+	id = strings.TrimSpace(id)
+	if id == "" || !knownBBSID(id) {
+		http.Error(w, "Unknown BBS id", http.StatusBadRequest)
+		return
+	}
+
+	token := clientToken(w, r, true)
+	add := r.Method == http.MethodPost
+	ids, err := favoritesStore.update(token, func(cur []string) []string {
+		out := make([]string, 0, len(cur)+1)
+		for _, existing := range cur {
+			if existing != id {
+				out = append(out, existing)
+			}
+		}
+		if add && len(out) < maxFavorites {
+			out = append(out, id)
+		}
+		sort.Strings(out)
+		return out
+	})
+	if err != nil {
+		http.Error(w, "Could not save favorites", http.StatusInternalServerError)
+		return
+	}
+	writeFavorites(w, ids)
+}
+
+func writeFavorites(w http.ResponseWriter, ids []string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "favorites": ids})
+}
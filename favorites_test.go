@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useClientTokenKey signs client tokens with a fresh in-memory key for the
+// test, so no key file is written.
+func useClientTokenKey(t *testing.T) {
+	t.Helper()
+	clientTokenKey.Lock()
+	prev := clientTokenKey.key
+	clientTokenKey.key = []byte(newSessionID() + newSessionID())
+	clientTokenKey.Unlock()
+	t.Cleanup(func() {
+		clientTokenKey.Lock()
+		clientTokenKey.key = prev
+		clientTokenKey.Unlock()
+	})
+}
+
+func TestClientTokenOnlyIssued(t *testing.T) {
+	useClientTokenKey(t)
+	issued := newClientToken()
+	id, _, _ := strings.Cut(issued, ".")
+	tests := []struct {
+		name, header, cookie, want string
+	}{
+		{"issued header", issued, "", issued},
+		{"issued cookie", "", issued, issued},
+		{"made-up header", "anything", "", ""},
+		{"made-up header, issued cookie", "anything", issued, issued},
+		{"forged signature", id + ".00", "", ""},
+		{"unsigned old cookie", "", "0123456789abcdef0123456789abcdef", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/favorite", nil)
+		if tt.header != "" {
+			req.Header.Set(clientTokenHeader, tt.header)
+		}
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: clientTokenCookie, Value: tt.cookie})
+		}
+		if got := clientToken(nil, req, false); got != tt.want {
+			t.Errorf("%s: token %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// A request without an issued token gets a new one
+	req := httptest.NewRequest(http.MethodGet, "/api/favorite", nil)
+	req.Header.Set(clientTokenHeader, "anything")
+	rec := httptest.NewRecorder()
+	got := clientToken(rec, req, true)
+	if !validClientToken(got) {
+		t.Errorf("issued token %q does not validate", got)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != got {
+		t.Errorf("cookies %v, want the issued token", cookies)
+	}
+}
+
+func TestClientStorePrunesOldest(t *testing.T) {
+	store := &clientStore[[]string]{path: filepath.Join(t.TempDir(), "store.json")}
+	store.loaded = true
+	store.data = make(map[string]clientEntry[[]string])
+	old := time.Now().Add(-time.Hour)
+	for i := range maxStoredClients {
+		store.data[clientKey(fmt.Sprint("client-", i))] = clientEntry[[]string]{
+			Value:   []string{"board"},
+			Changed: old.Add(time.Duration(i) * time.Second),
+		}
+	}
+	if _, err := store.update("newcomer", func([]string) []string { return []string{"x"} }); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.data) != maxStoredClients {
+		t.Errorf("store holds %d clients, want %d", len(store.data), maxStoredClients)
+	}
+	if _, ok := store.data[clientKey("client-0")]; ok {
+		t.Error("least recently changed client kept")
+	}
+	for _, token := range []string{"client-1", "newcomer"} {
+		if _, ok := store.data[clientKey(token)]; !ok {
+			t.Errorf("%s dropped", token)
+		}
+	}
+}
+
+func TestClientStoreLoadsOldFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "favorites.json")
+	old := fmt.Sprintf(`{%q: ["board-1", "board-2"]}`, clientKey("tok"))
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := &clientStore[[]string]{path: path}
+	got, err := store.get("tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"board-1", "board-2"}; !slices.Equal(got, want) {
+		t.Errorf("favorites %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+// Atom feed of the directory's newest boards, so enthusiasts can subscribe
+// to new listings. Boards are ordered by when they were added (the bbs.csv
+// "Added" column, filled in by the guide importer); boards without a date
+// are left out.
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxFeedEntries bounds the feed to the newest boards.
+const maxFeedEntries = 50
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// feedCache holds the rendered feed for one directory version and base URL,
+// rebuilt when bbs.csv changes like the directory cache itself.
+var feedCache struct {
+	sync.Mutex
+	mtime time.Time
+	base  string
+	body  []byte
+}
+
+// requestBaseURL returns scheme://host for absolute feed links.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// buildBBSFeed renders the Atom feed for entries.
+func buildBBSFeed(entries []BBSEntry, base string) ([]byte, error) {
+	var dated []BBSEntry
+	for _, e := range entries {
+		if !e.AddedAt.IsZero() {
+			dated = append(dated, e)
+		}
+	}
+	sort.SliceStable(dated, func(i, j int) bool { return dated[i].AddedAt.After(dated[j].AddedAt) })
+	if len(dated) > maxFeedEntries {
+		dated = dated[:maxFeedEntries]
+	}
+
+	feed := atomFeed{
+		Title: "RetroTerm: newly listed BBSes",
+		ID:    base + "/api/bbs-feed.xml",
+		Links: []atomLink{
+			{Href: base + "/api/bbs-feed.xml", Rel: "self"},
+			{Href: base + "/"},
+		},
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+	}
+	if len(dated) > 0 {
+		feed.Updated = dated[0].AddedAt.UTC().Format(time.RFC3339)
+	}
+	for _, e := range dated {
+		summary := e.Description
+		if e.Software != "" {
+			summary += " (" + e.Software + ")"
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   e.Name,
+			ID:      base + "/" + e.Slug,
+			Link:    atomLink{Href: base + "/" + e.Slug},
+			Updated: e.AddedAt.UTC().Format(time.RFC3339),
+			Summary: summary,
+		})
+	}
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// handleBBSFeed serves /api/bbs-feed.xml.
+func handleBBSFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries, err := GetBBSDirectoryEntries()
+	if err != nil {
+		http.Error(w, "Directory unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	bbsCacheMu.RLock()
+	mtime := bbsCacheMTime
+	bbsCacheMu.RUnlock()
+	base := requestBaseURL(r)
+
+	feedCache.Lock()
+	defer feedCache.Unlock()
+	if feedCache.body == nil || !feedCache.mtime.Equal(mtime) || feedCache.base != base {
+		body, err := buildBBSFeed(entries, base)
+		if err != nil {
+			http.Error(w, "Could not build feed", http.StatusInternalServerError)
+			return
+		}
+		feedCache.mtime, feedCache.base, feedCache.body = mtime, base, body
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Last-Modified", mtime.UTC().Format(http.TimeFormat))
+	w.Write(feedCache.body)
+}
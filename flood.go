@@ -0,0 +1,83 @@
+package main
+
+// Runaway-output protection. A misbehaving board, or a binary stream we
+// failed to recognize, can push megabytes a second at the browser and
+// freeze it. When output stays above a rate for a sustained period the
+// session stops reading from the board (TCP backpressure pauses it) and
+// asks the user to continue or disconnect.
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// floodLimits returns the byte rate per second and how many consecutive
+// seconds above it trip the limiter (config flood.bytesPerSecond, default
+// 1MB, negative disables; flood.sustainSeconds, default 5).
+func floodLimits() (rate int64, sustain int) {
+	cfg := LoadAppConfig()
+	rate, sustain = 1<<20, 5
+	if cfg != nil {
+		if cfg.Flood.BytesPerSecond != 0 {
+			rate = cfg.Flood.BytesPerSecond
+		}
+		if cfg.Flood.SustainSeconds > 0 {
+			sustain = cfg.Flood.SustainSeconds
+		}
+	}
+	return rate, sustain
+}
+
+// floodState counts output per one-second bucket. Used only from the
+// session's read loop, except wait which is guarded by c.mu.
+type floodState struct {
+	second time.Time
+	bytes  int64
+	over   int
+	wait   chan struct{} // non-nil while paused; closed to resume
+}
+
+// checkFlood accounts n bytes forwarded to the browser. When the limit
+// trips it sends "floodDetected" and blocks the read loop until the user
+// sends "floodContinue" or the session disconnects.
+func (c *Client) checkFlood(n int) {
+	rate, sustain := floodLimits()
+	if rate < 0 || n == 0 {
+		return
+	}
+	f := &c.flood
+	now := time.Now()
+	if now.Sub(f.second) >= time.Second {
+		if f.bytes > rate {
+			f.over++
+		} else {
+			f.over = 0
+		}
+		f.second, f.bytes = now, 0
+	}
+	f.bytes += int64(n)
+	if f.over < sustain {
+		return
+	}
+	f.over, f.bytes = 0, 0
+
+	wait := make(chan struct{})
+	c.mu.Lock()
+	c.flood.wait = wait
+	c.mu.Unlock()
+	log.Printf("Flood: board output above %d bytes/s for %ds; pausing", rate, sustain)
+	c.sendJSON(Message{Type: "floodDetected", Message: fmt.Sprintf(
+		"The board is sending more than %d KB/s; output paused. Continue or disconnect?", rate>>10)})
+	<-wait
+	f.second = time.Now()
+}
+
+// resumeFloodLocked releases a paused read loop ("floodContinue" or
+// disconnect); the caller holds c.mu.
+func (c *Client) resumeFloodLocked() {
+	if c.flood.wait != nil {
+		close(c.flood.wait)
+		c.flood.wait = nil
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+// Per-board capability announcement. Some boards wait for the terminal to
+// identify itself unprompted (an unsolicited CPR, a DA reply, an ANSI
+// probe answer) and fall back to plain text otherwise. The bbs.csv
+// "Handshake" column holds raw bytes sent right after connect, before the
+// board's first output is read.
+
+import "log"
+
+// sendHandshake writes the board's handshake bytes, if any, as-is: no
+// charset conversion, key translation or IAC escaping, so a handshake may
+// carry telnet commands.
+func (c *Client) sendHandshake() {
+	c.mu.Lock()
+	hs := c.board.Handshake
+	name := c.board.Name
+	telnet := c.telnet != nil
+	sshIn := c.sshIn
+	c.mu.Unlock()
+	if hs == "" {
+		return
+	}
+	log.Printf("Sending handshake to %s: %q", name, hs)
+	c.bytesOut.Add(int64(len(hs)))
+	if telnet {
+		c.writeTelnetCommand([]byte(hs))
+	} else if sshIn != nil {
+		_, _ = sshIn.Write([]byte(hs))
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+// Board logout detection. Boards usually close the connection after their
+// goodbye screen, but some leave it open and silent until the read times
+// out. With terminal.logoutDetect on, a logout banner in the output ends
+// the session shortly after, once the goodbye screen has been shown.
+
+import (
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// logoutGrace is how long the goodbye screen stays up before teardown;
+	// a board that closes on its own within it ends the session normally
+	logoutGrace = 3 * time.Second
+	// logoutTail bounds the text kept to match banners split across reads
+	logoutTail = 256
+)
+
+// defaultLogoutPatterns match common logout banners.
+var defaultLogoutPatterns = []string{
+	`(?i)thanks?( you)? for (calling|visiting)`,
+	`(?i)(logging you off|you are (now )?logged (off|out))`,
+	`NO CARRIER`,
+}
+
+var (
+	logoutOnce     sync.Once
+	logoutPatterns []*regexp.Regexp
+)
+
+// logoutDetectEnabled reports whether logout banners end the session
+// (terminal.logoutDetect, default off).
+func logoutDetectEnabled() bool {
+	cfg := LoadAppConfig()
+	return cfg != nil && cfg.Terminal.LogoutDetect
+}
+
+// logoutRegexps compiles the configured patterns once, falling back to the
+// defaults; invalid patterns are logged and skipped.
+func logoutRegexps() []*regexp.Regexp {
+	logoutOnce.Do(func() {
+		src := defaultLogoutPatterns
+		cfg := LoadAppConfig()
+		if cfg != nil && len(cfg.Terminal.LogoutPatterns) > 0 {
+			src = cfg.Terminal.LogoutPatterns
+		}
+		for _, p := range src {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Printf("Logout detection: ignoring invalid pattern %q: %v", p, err)
+				continue
+			}
+			logoutPatterns = append(logoutPatterns, re)
+		}
+	})
+	return logoutPatterns
+}
+
+// watchLogout scans board text for a logout banner and, on the first
+// match, schedules the session teardown.
+func (c *Client) watchLogout(data []byte) {
+	if len(data) == 0 || !logoutDetectEnabled() {
+		return
+	}
+	c.mu.Lock()
+	if c.logoutTimer != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.logoutText = append(c.logoutText, data...)
+	if len(c.logoutText) > logoutTail {
+		c.logoutText = c.logoutText[len(c.logoutText)-logoutTail:]
+	}
+	var matched *regexp.Regexp
+	for _, re := range logoutRegexps() {
+		if re.Match(c.logoutText) {
+			matched = re
+			break
+		}
+	}
+	if matched != nil {
+		c.logoutText = nil
+		connectedAt := c.connectedAt
+		c.logoutTimer = time.AfterFunc(logoutGrace, func() { c.endAfterLogout(connectedAt) })
+	}
+	addr := c.remoteAddr
+	c.mu.Unlock()
+
+	if matched != nil {
+		log.Printf("Logout banner from %s matched %q; closing session in %v", addr, matched, logoutGrace)
+	}
+}
+
+// endAfterLogout ends the session a logout banner was seen in, unless it
+// already ended or was replaced by a new connection.
+func (c *Client) endAfterLogout(connectedAt time.Time) {
+	c.mu.Lock()
+	same := c.connectedAt.Equal(connectedAt) && (c.telnet != nil || c.ssh != nil)
+	c.mu.Unlock()
+	if !same {
+		return
+	}
+	log.Printf("Closing session after board logout")
+	c.endSession("Logged off by the board")
+}
+
+// resetLogoutWatch arms logout detection for a new connection; caller
+// holds c.mu.
+func (c *Client) resetLogoutWatch() {
+	if c.logoutTimer != nil {
+		c.logoutTimer.Stop()
+		c.logoutTimer = nil
+	}
+	c.logoutText = nil
+}
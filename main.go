@@ -7,6 +7,7 @@ package main
 import (
     "bytes"
     "encoding/base64"
+    "encoding/json"
     "fmt"
     "io"
     "log"
@@ -17,6 +18,7 @@ import (
     "strconv"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
 
     "github.com/gorilla/websocket"
@@ -41,8 +43,8 @@ var upgrader = websocket.Upgrader{
 			return true
 		}
 		// Additionally allow configured ExternalBaseURL host, if provided
-		if AppConfig != nil && AppConfig.Server.ExternalBaseURL != "" {
-			if eu, err2 := neturl.Parse(AppConfig.Server.ExternalBaseURL); err2 == nil && eu.Host == u.Host {
+		if cfg := LoadAppConfig(); cfg != nil && cfg.Server.ExternalBaseURL != "" {
+			if eu, err2 := neturl.Parse(cfg.Server.ExternalBaseURL); err2 == nil && eu.Host == u.Host {
 				return true
 			}
 		}
@@ -69,6 +71,57 @@ type Message struct {
     BBSID    string    `json:"bbsId,omitempty"`
     BBSList  []BBSInfo `json:"bbsList,omitempty"`
     Enable   bool      `json:"enable,omitempty"`
+    Trace    []NegotiationEvent `json:"trace,omitempty"`
+    // Last rz run for "getTransferDebug" (ZMODEM_DEBUG=true)
+    Transfer *RzRunInfo `json:"transfer,omitempty"`
+    RetryAt  string    `json:"retryAt,omitempty"`
+    // Partial ANSIOptions for "setAnsiOptions"; omitted fields keep their value
+    ANSIOptions json.RawMessage `json:"ansiOptions,omitempty"`
+    // Upload protocol (uploadStart/uploadChunk)
+    Name   string `json:"name,omitempty"`
+    Size   int64  `json:"size,omitempty"`
+    SHA256 string `json:"sha256,omitempty"`
+    Seq    int    `json:"seq,omitempty"`
+    // Download smaller than the size the board declared (fileDownload,
+    // fileDownloadStart/End), see zmodem_partial.go
+    Partial  bool  `json:"partial,omitempty"`
+    Declared int64 `json:"declared,omitempty"`
+    // Terminal types the browser emulates, preferred first ("connect")
+    TermTypes []string `json:"termTypes,omitempty"`
+    // BELs in one chunk of board output ("bell")
+    Count int `json:"count,omitempty"`
+    Proxies []string `json:"proxies,omitempty"`
+    // Capture mode for "startCapture": "converted" (default) or "raw"
+    Mode string `json:"mode,omitempty"`
+    // Why the charset changed ("charsetChanged"), see session_charset.go
+    Source string `json:"source,omitempty"`
+    // Parsed ANSI music with ansi.musicFormat "notes"
+    Notes []MMLNote `json:"notes,omitempty"`
+    // Session resume token ("resumeToken"), see resume.go
+    Token string `json:"token,omitempty"`
+    // Supported charsets ("charsets")
+    Charsets []CharsetInfo `json:"charsets,omitempty"`
+    // Timestamp of a session "event" (RFC 3339)
+    Time string `json:"time,omitempty"`
+}
+
+// TerminalSize is a terminal size the browser offers and telnet NAWS reports.
+type TerminalSize struct {
+    Cols int `json:"cols"`
+    Rows int `json:"rows"`
+}
+
+// terminalSizes are the BBS-friendly sizes; the first is the default.
+var terminalSizes = []TerminalSize{{80, 25}, {100, 31}}
+
+// offeredTerminalSize reports whether cols x rows is one of terminalSizes.
+func offeredTerminalSize(cols, rows int) bool {
+    for _, s := range terminalSizes {
+        if s.Cols == cols && s.Rows == rows {
+            return true
+        }
+    }
+    return false
 }
 
 type BBSInfo struct {
@@ -80,6 +133,19 @@ type BBSInfo struct {
     Description string `json:"description"`
     Encoding    string `json:"encoding,omitempty"`
     Location    string `json:"location,omitempty"`
+    // Per-board connection quirks (opt-in)
+    AnnounceCaps bool   `json:"announceCaps,omitempty"`
+    InitCommand  string `json:"initCommand,omitempty"`
+    ExpandCR     bool   `json:"expandCR,omitempty"`
+    RequiresCPR  bool   `json:"requiresCPR,omitempty"`
+    AutoANSI     bool   `json:"autoANSI,omitempty"`
+    Profile      string `json:"profile,omitempty"`
+    TermType     string `json:"termType,omitempty"`
+    Answerback   string `json:"answerback,omitempty"`
+    Identity     string `json:"identity,omitempty"`
+    ZmodemEscape string `json:"zmodemEscape,omitempty"`
+    Handshake    string `json:"handshake,omitempty"`
+    Fallback     string `json:"fallback,omitempty"`
 }
 
 // ZmodemHandler abstracts different ZMODEM implementations (e.g., external
@@ -94,7 +160,7 @@ type ZmodemHandler interface {
 // connection (telnet or SSH). It owns the ZMODEM lifecycle for that session.
 type Client struct {
     ws             *websocket.Conn // WebSocket connection to browser
-    telnet         net.Conn        // Telnet connection to BBS
+    telnet         RemoteConn      // Telnet connection to BBS
     ssh            *ssh.Client     // SSH client (if using SSH)
     // SSH session and input pipe for writing
     sshSession     *ssh.Session    // SSH session (if using SSH)
@@ -102,22 +168,34 @@ type Client struct {
     mu             sync.Mutex    // Protects concurrent access
     done           chan bool     // Signals connection closure
     charset        string        // Character set for conversion
+    charsetSource  string        // Why charset has its value (session_charset.go)
     zmodemReceiver ZmodemHandler // Active Zmodem handler
+    zmodemSender   *LrzszSender  // Running browser upload, owns the stream while active
+    upload         *uploadSession // Upload being assembled (WebSocket goroutine only)
+    capture        *sessionCapture // Server-side capture of board output
     ansiEnhanced   *ANSIEnhancedProcessor // Enhanced ANSI processor
-    // Pre-transfer suppression to avoid displaying binary data
-    suppressZmodem bool      // Whether to suppress output
-    suppressUntil  time.Time // When suppression expires
-    // Telnet binary mode negotiation state
+    // Pre-transfer suppression to avoid displaying binary data (telnet
+    // read goroutine only, so unlocked)
+    preZmodem zmodemSuppress // See zmodem_suppress.go
+    // Telnet binary mode negotiation state (c.mu; see setNegotiated)
     telnetBinaryTX bool // We WILL transmit binary
     telnetBinaryRX bool // Remote WILL transmit binary
 
-    // Telnet negotiation state
+    // Telnet negotiation state (c.mu; see setNegotiated)
     telnetNAWS     bool // NAWS negotiated (we WILL NAWS)
     telnetTTYPE    bool // TTYPE negotiated (we WILL TTYPE)
+    telnetTSPEED   bool // TSPEED negotiated (we WILL TSPEED)
+    // Browser terminal types and the next one for TTYPE (c.mu; see
+    // terminal_type.go)
+    termTypes  []string
+    ttypeIndex int
 
     // Terminal dimensions (fixed BBS-friendly sizes)
     termCols int
     termRows int
+    // Last browser size from "resize" (any size), used for SSH PTYs
+    winCols int
+    winRows int
 
     // Lightweight cursor tracking for CPR replies
     cursorRow int
@@ -126,6 +204,86 @@ type Client struct {
 
     // ANSI music processor (CSI | sequences)
     music *AnsiMusicProcessor
+
+    // PETSCII screen editor state (reverse/color) for Commodore charsets
+    petscii petsciiState
+
+    // DEC private modes set by the board (bracketed paste, DECCKM, ...)
+    modes TerminalModes
+
+    // Directory entry for the current connection (per-board quirks)
+    board BBSInfo
+
+    // Session start and whether the first CPR request has been seen
+    connectedAt    time.Time
+    initialCPRSeen bool
+
+    // Telnet negotiation trace (nil unless TELNET_TRACE=true)
+    trace *negotiationTrace
+
+    // Bare-CR expansion: previous chunk ended in CR
+    pendingCR bool
+    // NUL stripping: previous chunk ended in CR (see newline.go)
+    nulAfterCR bool
+    // Telnet command cut off at the end of the previous read
+    telnetCarry []byte
+    // Reply to CPR requests (board's RequiresCPR or connection profile)
+    answerCPR bool
+
+    // ANSI-detection prompt responder: already answered, recent text
+    ansiPromptDone bool
+    ansiPromptText []byte
+    // Logout banner detection: recent text, pending teardown (logout.go)
+    logoutText  []byte
+    logoutTimer *time.Timer
+
+    // Server-side model of the visible screen (nil when disabled)
+    screen *VTScreen
+
+    // CP437/UTF-8 mismatch detection state (see charset_mismatch.go)
+    charsetChecked bool
+    charsetTail    []byte
+    charsetSeen    int
+    charsetRunes   int
+
+    // Client subscribed to the "event" timeline (see events.go)
+    events bool
+
+    // Runaway-output limiter (see flood.go)
+    flood floodState
+
+    // Receives messages instead of ws (tests only)
+    sink func(Message)
+
+    // Leaked binary detector (see binary_leak.go)
+    binaryLeak binaryLeakState
+    // OSC tracking for "bell" messages (see bell.go)
+    bell bellState
+
+    // Telnet negotiation loop breaker state (see negotiation_loop.go)
+    negCounts  map[uint16]*negotiationCount
+    negBlocked map[byte]bool
+
+    // DA identity chosen with "setTerminalIdentity" ("" = board/config)
+    terminalIdentity string
+
+    // Proxy chosen with "setProxy" for the next connection ("" = default)
+    proxyName string
+
+    // Token the browser presents to resume after a drop (see resume.go)
+    resumeToken string
+    // WebSocket the session was last parked from
+    parkedFrom *websocket.Conn
+
+    // Connection log identity and per-connection traffic counters
+    sessionID      string
+    clientIP       string
+    // clientToken scopes favorites and connection history (see favorites.go)
+    clientToken    string
+    remoteAddr     string
+    remoteProtocol string
+    bytesIn        atomic.Int64
+    bytesOut       atomic.Int64
 }
 
 // Global list of approved BBSes (loaded from both config and bbs.json)
@@ -142,7 +300,20 @@ func main() {
 		// Create minimal config
 		config = &Config{}
 		config.Server.Port = 8080
-		AppConfig = config
+		StoreAppConfig(config)
+	}
+	if err := config.Validate(); err != nil {
+		log.Printf("Warning: config.json problems:\n%v", err)
+	}
+
+	// Optional JSON-lines connection log
+	if path := config.ConnectionLog.Path; path != "" {
+		if l, err := openConnectionLog(path, config.ConnectionLog.MaxBytes, config.ConnectionLog.Keep); err != nil {
+			log.Printf("Warning: connection log disabled: %v", err)
+		} else {
+			connLog = l
+			log.Printf("Connection log: %s", path)
+		}
 	}
 
 	// Populate the approved list from bbs.csv
@@ -169,24 +340,43 @@ func main() {
 		fmt.Println("Proxy: disabled (direct connections)")
 	}
 
+	tlsCfg := config.Server.TLS
+	if tlsCfg.CertFile != "" && tlsCfg.KeyFile != "" {
+		if tlsCfg.RedirectPort > 0 {
+			go serveHTTPSRedirect(tlsCfg.RedirectPort, port)
+		}
+		fmt.Printf("TLS: enabled (https/wss on :%d)\n", port)
+		log.Fatal(http.ListenAndServeTLS(fmt.Sprintf(":%d", port), tlsCfg.CertFile, tlsCfg.KeyFile, nil))
+	}
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
 }
 
+// serveHTTPSRedirect answers plain HTTP on redirectPort with a permanent
+// redirect to the same host and path on the HTTPS port.
+func serveHTTPSRedirect(redirectPort, httpsPort int) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+	fmt.Printf("TLS: redirecting http on :%d to https\n", redirectPort)
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", redirectPort), handler); err != nil {
+		log.Printf("HTTP redirect listener failed: %v", err)
+	}
+}
+
 // refreshApprovedBBSList populates the in-memory allowlist from CSV
 func refreshApprovedBBSList() error {
     if entries, err := GetBBSDirectoryEntries(); err == nil && len(entries) > 0 {
         list := make([]BBSInfo, 0, len(entries))
         for _, e := range entries {
-            list = append(list, BBSInfo{
-                ID:          e.ID,
-                Name:        e.Name,
-                Host:        e.Host,
-                Port:        e.Port,
-                Protocol:    strings.ToLower(e.Protocol),
-                Description: e.Description,
-                Encoding:    e.Encoding,
-                Location:    e.Location,
-            })
+            list = append(list, e.Info())
         }
         ApprovedBBSList = list
         return nil
@@ -205,8 +395,28 @@ func setupRoutes(config *Config) {
 
 	// BBS Directory endpoints (public read)
 	http.HandleFunc("/api/bbs-directory", handleGetBBSDirectory)
+	http.HandleFunc("/api/charsets", handleGetCharsets)
+	http.HandleFunc("/api/bbs-feed.xml", handleBBSFeed)
+	http.HandleFunc("/api/bbs-banner", handleGetBBSBanner)
 	http.HandleFunc("/api/import-bbs-guide", handleImportBBSGuide)
 	http.HandleFunc("/api/bbs-by-slug", handleGetBBSBySlug)
+	http.HandleFunc("/api/favorite", handleFavorite)
+	http.HandleFunc("/api/recent", handleRecent)
+
+	// Admin config export, dry-run validation and the pipeline self-test
+	// (needs admin.token)
+	http.HandleFunc("/api/admin/config", handleAdminConfig)
+	http.HandleFunc("/api/admin/config/validate", handleAdminValidateConfig)
+	http.HandleFunc("/api/admin/selftest", handleSelfTest)
+
+	// Capture listing and quota usage (when captures are enabled)
+	http.HandleFunc("/api/captures", handleListCaptures)
+	http.HandleFunc("/api/captures/music", handleCaptureMusic)
+	http.HandleFunc("/api/captures/lines", handleCaptureLines)
+	http.HandleFunc("/api/captures/compare", handleCompareCaptures)
+	if config.Capture.Enabled {
+		go watchCaptureQuota()
+	}
 
 	// 404 for any other /api/* paths
 	http.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
@@ -216,42 +426,36 @@ func setupRoutes(config *Config) {
 	})
 
 	// Handle slug-based routing and static files
+	checkStaticAssets()
 	http.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Parse the path
 		path := r.URL.Path
 
-
-		// If it's root or has file extension, serve normally
-		if path == "/" || strings.Contains(path, ".") {
-			http.FileServer(http.Dir("./static")).ServeHTTP(w, r)
+		if path == "/" {
+			serveIndex(w, r)
 			return
 		}
 
-		// Check if path might be a BBS slug (single segment, no extension)
-		pathParts := strings.Split(strings.Trim(path, "/"), "/")
-		if len(pathParts) == 1 && pathParts[0] != "" && !strings.Contains(pathParts[0], ".") {
-			// Potential BBS slug - check if it exists
-			slug := pathParts[0]
-
-			// Get BBS directory entries
-			entries, err := GetBBSDirectoryEntries()
-			if err == nil {
-				// Check if this slug corresponds to a BBS
-				if bbs := FindBBSBySlug(slug, entries); bbs != nil {
-					// Serve the index.html for the BBS quick link
-					http.ServeFile(w, r, "./static/index.html")
-					return
-				}
-			}
+		// BBS quick links get index.html; everything else is a static file
+		if isSlugRoute(path, GetBBSDirectoryEntries) {
+			serveIndex(w, r)
+			return
 		}
-
-		// Otherwise, try to serve as static file
-		http.FileServer(http.Dir("./static")).ServeHTTP(w, r)
+		serveStatic(w, r)
 	}))
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Issue a client token with the upgrade so history works without
+	// the browser having used favorites first
+	token := clientToken(nil, r, false)
+	var upgradeHeader http.Header
+	if token == "" {
+		ck := newClientTokenCookie(r)
+		token = ck.Value
+		upgradeHeader = http.Header{"Set-Cookie": {ck.String()}}
+	}
+	conn, err := upgrader.Upgrade(w, r, upgradeHeader)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
@@ -272,34 +476,50 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
         ws:           conn,
         done:         make(chan bool),
         charset:      "CP437",
-        ansiEnhanced: NewANSIEnhancedProcessor(debugMode),
+        sessionID:    newSessionID(),
+        clientIP:     clientIP(r),
+        clientToken:  token,
+        ansiEnhanced: NewANSIEnhancedProcessor(debugMode, DefaultANSIOptions()),
         termCols:     80,
         termRows:     25,
         cursorRow:    1,
         cursorCol:    1,
         cursorSeqBuf: make([]byte, 0, 64),
+        modes:        defaultTerminalModes(),
+    }
+    if screenModelEnabled() {
+        client.screen = NewVTScreen(80, 25)
+    }
+    if os.Getenv("TELNET_TRACE") == "true" {
+        client.trace = newNegotiationTrace(256)
     }
-    // Music emitter sends a JSON message to the client; keep simple payload
+    // Music emitter sends a JSON message to the client in the configured format
     client.music = NewAnsiMusicProcessor(func(payload string) {
-        client.sendJSON(Message{Type: "music", Message: payload})
+        client.recordCaptureMusic(payload)
+        client.emitEvent(eventMusic, payload)
+        client.sendJSON(musicMessage(payload, musicFormat()))
     })
 
-	// Start ping ticker for keepalive
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+    // Pick up a session parked by a dropped WebSocket (see resume.go)
+    resumeToken := r.URL.Query().Get("resume")
+    resumed := false
+    if resumeToken != "" {
+        if parked := takeParked(resumeToken, token); parked != nil {
+            client, resumed = parked, true
+        }
+    }
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					return
-				}
-			case <-client.done:
-				return
-			}
-		}
-	}()
+	// Start ping ticker for keepalive
+	// Stops this connection's pinger; a resumed client outlives it
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go client.keepAlive(conn, 30*time.Second, stopPing)
+
+	if resumed {
+		client.resume(conn)
+	} else if resumeToken != "" {
+		client.sendMessage("resumeFailed", "Previous session has ended")
+	}
 
 	for {
 		var msg Message
@@ -310,7 +530,11 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket unexpected close: %v", err)
 			}
-			client.disconnect()
+			// Keep the board connection for a quick reconnect if possible
+			if !client.park(conn) {
+				client.disconnect()
+			}
+			client.abortUpload("")
 			break
 		}
 
@@ -318,6 +542,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		case "connect":
 			// SECURITY: Always validate connections against curated allowlist
 			isApproved := false
+			var board BBSInfo
 			if len(ApprovedBBSList) == 0 {
 				// Attempt a lazy refresh if list is empty
 				if err := refreshApprovedBBSList(); err != nil {
@@ -330,6 +555,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 					bbs.Port == msg.Port &&
 					strings.EqualFold(bbs.Protocol, msg.Protocol) {
 					isApproved = true
+					board = bbs
 					log.Printf("SECURITY: Approved connection to %s://%s:%d", msg.Protocol, msg.Host, msg.Port)
 					break
 				}
@@ -341,27 +567,34 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				client.sendMessage("error", "Connection blocked: Host not in approved list")
 				continue
 			}
-			if msg.Charset != "" {
-				client.charset = msg.Charset
-			}
+			client.setBoard(client.applyProfile(board))
+			client.setCharset(msg.Charset, charsetSourceConfigured)
+			client.setTermTypes(msg.TermTypes)
             if msg.Protocol == "telnet" {
                 go client.connectTelnet(msg.Host, msg.Port)
             } else if msg.Protocol == "ssh" {
-                go client.connectSSH(msg.Host, msg.Port, msg.Username, msg.Password)
+                go client.connectSSHWithFallback(msg.Host, msg.Port, msg.Username, msg.Password)
             }
 		case "data":
 			client.sendToRemote(msg.Data)
     case "resize":
-        // Update PTY size for SSH sessions if present
+        // Update PTY size for SSH sessions if present, and remember the
+        // browser size for the PTY of the next SSH connection
         client.mu.Lock()
         sshSession := client.sshSession
+        if msg.Cols > 0 && msg.Rows > 0 {
+            client.winCols, client.winRows = msg.Cols, msg.Rows
+        }
         client.mu.Unlock()
         if sshSession != nil && msg.Cols > 0 && msg.Rows > 0 {
             // Note: WindowChange takes rows, cols order
             _ = sshSession.WindowChange(msg.Rows, msg.Cols)
         }
+        if msg.Cols > 0 && msg.Rows > 0 {
+            client.screen.Resize(msg.Cols, msg.Rows)
+        }
         // Accept only fixed BBS-friendly sizes for telnet NAWS
-        if (msg.Cols == 80 && msg.Rows == 25) || (msg.Cols == 100 && msg.Rows == 31) {
+        if offeredTerminalSize(msg.Cols, msg.Rows) {
             client.mu.Lock()
             client.termCols = msg.Cols
             client.termRows = msg.Rows
@@ -373,24 +606,147 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
             }
         }
 		case "setCharset":
-			client.charset = msg.Charset
+			client.setCharset(msg.Charset, charsetSourceUser)
+		case "getCharsets":
+			client.sendJSON(Message{Type: "charsets", Charsets: supportedCharsets})
 		case "getBBSList":
 			client.sendBBSList()
 		case "connectToBBS":
 			// SECURITY: This message type only uses pre-approved BBS IDs
 			log.Printf("SECURITY: BBS connection via ID: %s", msg.BBSID)
-			client.connectToBBS(msg.BBSID)
+			client.connectToBBS(msg.BBSID, msg.TermTypes)
+		case "setAnsiOptions":
+			client.setANSIOptions(msg.ANSIOptions)
+		case "setProxy":
+			client.setProxy(msg.Name)
+		case "subscribeEvents":
+			client.setEventsEnabled(msg.Enable)
+		case "floodContinue":
+			client.mu.Lock()
+			client.resumeFloodLocked()
+			client.mu.Unlock()
+		case "setTerminalIdentity":
+			if err := client.setTerminalIdentity(msg.Name); err != nil {
+				client.sendMessage("error", err.Error())
+				continue
+			}
+			client.sendJSON(Message{Type: "terminalIdentity", Name: msg.Name})
+		case "getProxies":
+			client.sendJSON(Message{Type: "proxies", Proxies: proxyNames()})
+		case "getScreenText":
+			if client.screen == nil {
+				client.sendMessage("error", "Screen model disabled (terminal.virtualScreen)")
+				continue
+			}
+			client.sendJSON(Message{Type: "screenText", Data: client.screen.Text()})
+		case "getNegotiationTrace":
+			if client.trace == nil {
+				client.sendMessage("error", "Negotiation trace disabled (set TELNET_TRACE=true)")
+				continue
+			}
+			client.sendJSON(Message{Type: "negotiationTrace", Trace: client.trace.snapshot()})
+		case "getTransferDebug":
+			if !zmodemDebug() {
+				client.sendMessage("error", "Transfer debugging disabled (set ZMODEM_DEBUG=true)")
+				continue
+			}
+			info, ok := client.transferDebug()
+			if !ok {
+				client.sendMessage("error", "No ZMODEM download has run in this session")
+				continue
+			}
+			client.sendJSON(Message{Type: "transferDebug", Transfer: &info})
+		case "uploadStart":
+			client.startUpload(msg.Name, msg.Size, msg.SHA256)
+		case "uploadChunk":
+			client.uploadChunk(msg.Seq, msg.Data)
+		case "uploadEnd":
+			client.finishUpload()
+		case "cancelUpload":
+			client.abortUpload("")
+			if sender := client.activeSender(); sender != nil {
+				sender.Cancel()
+			}
+		case "startCapture":
+			if err := client.StartCapture(msg.Mode); err != nil {
+				client.sendMessage("captureError", err.Error())
+				continue
+			}
+			client.sendMessage("captureStarted", "")
+		case "stopCapture":
+			client.sendMessage("captureStopped", client.StopCapture())
+		case "startDownload":
+			client.startDownload()
 		case "cancelDownload":
 			if client.zmodemReceiver != nil {
 				client.zmodemReceiver.Cancel()
 			}
         case "disconnect":
-            client.disconnect()
+            client.endSession("closed by user")
+            client.abortUpload("")
             return
+        default:
+            client.unknownMessage(msg.Type)
         }
 	}
 }
 
+// setANSIOptions applies a partial ANSIOptions update to the session's
+// processor and replies with the resulting options. An empty update just
+// reports the current ones.
+func (c *Client) setANSIOptions(raw json.RawMessage) {
+    if c.ansiEnhanced == nil {
+        return
+    }
+    opts := c.ansiEnhanced.Options()
+    if len(raw) > 0 {
+        if err := json.Unmarshal(raw, &opts); err != nil {
+            c.sendMessage("error", "Invalid ANSI options: "+err.Error())
+            return
+        }
+        c.ansiEnhanced.SetOptions(opts)
+        log.Printf("ANSI options updated: %+v", opts)
+    }
+    encoded, _ := json.Marshal(opts)
+    c.sendJSON(Message{Type: "ansiOptions", ANSIOptions: encoded})
+}
+
+// unknownMessage handles a message type this server does not know, e.g.
+// from a newer frontend. It is ignored unless WS_DEBUG=true (logged) or
+// server.strictMessages is set (logged and answered).
+func (c *Client) unknownMessage(msgType string) {
+    cfg := LoadAppConfig()
+    strict := cfg != nil && cfg.Server.StrictMessages
+    if strict || os.Getenv("WS_DEBUG") == "true" {
+        log.Printf("Session %s: unsupported WebSocket message type %q", c.sessionID, msgType)
+    }
+    if strict {
+        c.sendJSON(Message{Type: "unsupportedMessage", Name: msgType, Message: fmt.Sprintf("Unsupported message type %q", msgType)})
+    }
+}
+
+// setProxy selects the proxy used by the session's next connection.
+// Unknown names are rejected; "" restores the server default.
+func (c *Client) setProxy(name string) {
+    name = strings.TrimSpace(name)
+    if !validProxyName(name) {
+        c.sendMessage("error", fmt.Sprintf("Unknown proxy: %s", name))
+        return
+    }
+    c.mu.Lock()
+    c.proxyName = name
+    c.mu.Unlock()
+    log.Printf("Session proxy set to %q", name)
+    c.sendJSON(Message{Type: "proxySelected", Name: name})
+}
+
+// selectedProxy returns the proxy name chosen for this session.
+func (c *Client) selectedProxy() string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.proxyName
+}
+
 // sendBBSList sends the current curated BBS list to the browser.
 func (c *Client) sendBBSList() {
     msg := Message{
@@ -400,18 +756,20 @@ func (c *Client) sendBBSList() {
     c.sendJSON(msg)
 }
 
-// connectToBBS looks up a curated BBS by ID and starts a telnet/SSH connection.
-func (c *Client) connectToBBS(bbsID string) {
+// connectToBBS looks up a curated BBS by ID and starts a telnet/SSH
+// connection, offering the browser's terminal types as "connect" does.
+func (c *Client) connectToBBS(bbsID string, termTypes []string) {
     for _, bbs := range ApprovedBBSList {
         if bbs.ID == bbsID {
-            // Set charset from BBS config if specified
-            if bbs.Encoding != "" {
-                c.charset = bbs.Encoding
-            }
+            bbs = c.applyProfile(bbs)
+            c.setBoard(bbs)
+            // Set charset from BBS config if specified (wins over the profile)
+            c.setCharset(bbs.Encoding, charsetSourceConfigured)
+			c.setTermTypes(termTypes)
 			if bbs.Protocol == "telnet" {
 				go c.connectTelnet(bbs.Host, bbs.Port)
 			} else if bbs.Protocol == "ssh" {
-				go c.connectSSH(bbs.Host, bbs.Port, "", "")
+				go c.connectSSHWithFallback(bbs.Host, bbs.Port, "", "")
 			}
 			return
 		}
@@ -419,72 +777,157 @@ func (c *Client) connectToBBS(bbsID string) {
 	c.sendMessage("error", fmt.Sprintf("BBS not found: %s", bbsID))
 }
 
+// setBoard records the directory entry the session is connecting to so
+// per-board options apply to the new connection.
+func (c *Client) setBoard(bbs BBSInfo) {
+    c.mu.Lock()
+    c.board = bbs
+    c.mu.Unlock()
+}
+
 // connectTelnet dials a telnet endpoint (optionally via proxy) and starts
 // the read loop. A ZMODEM receiver is lazily created for telnet sessions.
 func (c *Client) connectTelnet(host string, port int) {
 	address := fmt.Sprintf("%s:%d", host, port)
+	key := boardKey("telnet", host, port)
+	if c.checkConnectCooldown(key) {
+		return
+	}
 	log.Printf("Connecting to telnet://%s", address)
 
-	// Use proxy if configured
-	conn, err := DialWithProxy("tcp", address)
+	// Use the session's selected proxy, else the configured default
+	conn, err := DialVia(c.selectedProxy(), "tcp", address)
 	if err != nil {
+		c.recordConnectFailure(key)
 		c.sendMessage("error", err.Error())
 		return
 	}
 
+	c.attachTelnet(NewNetRemoteConn(conn, "telnet", address))
+}
+
+// attachTelnet installs an established telnet remote on the session and
+// starts the read loop. Split from connectTelnet so a scripted RemoteConn
+// can drive the full pipeline without dialing.
+func (c *Client) attachTelnet(remote RemoteConn) {
 	c.mu.Lock()
-	c.telnet = conn
+	c.telnet = remote
 	// Initialize Zmodem receiver (lrzsz-based) for telnet connections
 	c.zmodemReceiver = NewLrzszReceiver(c)
+	c.connectedAt = time.Now()
+	c.initialCPRSeen = false
+	c.resetANSIPrompt()
+	c.resetLogoutWatch()
+	c.resetCharsetCheck()
+	c.resetNegotiationLoop()
+	c.binaryLeak = binaryLeakState{}
+	c.bell = bellState{}
+	c.modes = defaultTerminalModes()
+	// Options are negotiated afresh on every connection
+	c.telnetBinaryTX, c.telnetBinaryRX = false, false
+	c.nulAfterCR = false
+	c.telnetCarry = nil
+	c.telnetNAWS, c.telnetTTYPE, c.telnetTSPEED = false, false, false
+	c.ttypeIndex = 0
+	c.remoteAddr = remote.Address()
+	c.remoteProtocol = remote.Protocol()
+	c.bytesIn.Store(0)
+	c.bytesOut.Store(0)
+	c.logConnectionLocked("connect")
+	c.recordRecentLocked()
+	announce := c.board.AnnounceCaps
 	c.mu.Unlock()
 
-	c.sendMessage("connected", fmt.Sprintf("Connected to %s", address))
+	// Some boards probe capabilities immediately; offer ours before reading
+	if announce {
+		c.announceTelnetCapabilities()
+	}
+	c.sendHandshake()
+
+	c.sendMessage("connected", fmt.Sprintf("Connected to %s", remote.Address()))
+	c.emitEvent(eventConnected, remote.Protocol()+"://"+remote.Address())
+	c.issueResumeToken()
 
 	// Handle telnet data
-	go c.readTelnet()
+	go c.readTelnet(remote)
+	go c.sendInitCommand()
+}
+
+// sendInitCommand types the board's configured init command (if any) once
+// the remote has had a moment to draw its first prompt.
+func (c *Client) sendInitCommand() {
+	c.mu.Lock()
+	cmd := c.board.InitCommand
+	name := c.board.Name
+	c.mu.Unlock()
+	if cmd == "" {
+		return
+	}
+	time.Sleep(750 * time.Millisecond)
+	log.Printf("Sending init command to %s: %q", name, cmd)
+	c.sendToRemote(cmd)
 }
 
 // readTelnet pumps data from the telnet connection to the browser, handling
 // telnet negotiations, CP437 conversion, ANSI processing, and ZMODEM detection.
-func (c *Client) readTelnet() {
+// It stops once conn is no longer the session's remote (torn down or
+// replaced by a new connection).
+func (c *Client) readTelnet(conn RemoteConn) {
     buffer := make([]byte, 8192)
 
 	for {
 		c.mu.Lock()
-		conn := c.telnet
+		current := c.telnet == conn
 		c.mu.Unlock()
 
-		if conn == nil {
+		if !current {
 			return
 		}
 
 		// Set read timeout to detect stale connections
 		conn.SetReadDeadline(time.Now().Add(120 * time.Second))
 		n, err := conn.Read(buffer)
+		c.bytesIn.Add(int64(n))
 		if err != nil {
+			reason := "closed by board"
 			if err == io.EOF {
 				log.Printf("Telnet connection closed by remote host")
 			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				log.Printf("Telnet read timeout - connection may be stale")
+				reason = "read timeout"
 			} else {
 				log.Printf("Telnet read error: %v", err)
+				reason = "read error: " + err.Error()
 			}
-			c.sendJSON(Message{Type: "disconnected"})
-			c.disconnect()
+			c.endSession(reason)
 			return
 		}
 
         if n > 0 {
             // Check for Zmodem in raw data FIRST (before telnet processing)
             rawData := buffer[:n]
+            c.writeCapture(captureModeRaw, rawData)
+
+            // An outgoing upload owns the stream until sz exits
+            if sender := c.activeSender(); sender != nil {
+                sender.ProcessData(rawData)
+                continue
+            }
 
             // Debug logging removed
 
+			// After a cancelled download, show the board's next output
+			// rather than treating its trailing frames as a new transfer
+			recovering := c.zmodemRecovering()
+			if recovering {
+				c.preZmodem.release()
+				c.binaryLeak = binaryLeakState{}
+			}
+
 			// Pre-suppress terminal output on first ZMODEM signature before receiver activates
-			if c.hasZmodemSignature(rawData) && (c.zmodemReceiver == nil || !c.zmodemReceiver.Active()) {
-				if !c.suppressZmodem {
-					c.suppressZmodem = true
-					c.suppressUntil = time.Now().Add(5 * time.Second)
+			if !recovering && (c.zmodemReceiver == nil || !c.zmodemReceiver.Active()) {
+				if c.preZmodem.observe(rawData, time.Now(), zmodemSuppressWindow()) {
+					log.Println("Detected Zmodem signature in data stream")
 				}
 			}
 
@@ -513,56 +956,82 @@ func (c *Client) readTelnet() {
 				cleanData = c.processTelnetData(rawData)
 			}
 
-			// Check for Zmodem signatures and log them (once per transfer)
-			if c.hasZmodemSignature(rawData) && (c.zmodemReceiver == nil || !c.zmodemReceiver.Active()) {
-				// Log detection once per transfer to avoid spam
-				if !c.suppressZmodem || time.Since(c.suppressUntil) > 0 {
-					log.Println("Detected Zmodem signature in data stream")
-				}
-			}
-
-			// Clear pre-suppression if it expired or transfer became active
-			if c.suppressZmodem && (time.Now().After(c.suppressUntil) || (c.zmodemReceiver != nil && c.zmodemReceiver.Active())) {
-				c.suppressZmodem = false
+			// Clear pre-suppression once the transfer is active
+			if c.zmodemReceiver != nil && c.zmodemReceiver.Active() {
+				c.preZmodem.release()
 			}
 
             // Only send to terminal if not in active ZMODEM transfer and not in pre-suppression window
-            if len(cleanData) > 0 && (c.zmodemReceiver == nil || !c.zmodemReceiver.Active()) && !c.suppressZmodem {
+            if len(cleanData) > 0 && (c.zmodemReceiver == nil || !c.zmodemReceiver.Active()) && !c.preZmodem.suppressing(time.Now()) &&
+                !c.checkBinaryLeak(cleanData, c.sessionCharset()) {
                 // ANSI Music: detect and emit events, suppressing music sequences
                 if c.music != nil {
                     if remaining, consumed := c.music.Process(cleanData); consumed {
                         cleanData = remaining
                     }
                 }
+                // Commodore boards: rewrite PETSCII control codes to ANSI
+                if isPETSCIICharset(c.sessionCharset()) {
+                    cleanData = c.translatePETSCIIToANSI(cleanData)
+                }
+                c.trackTerminalModes(cleanData)
+                c.resetOnRIS(cleanData)
+                c.watchANSIPrompt(cleanData)
+                c.watchLogout(cleanData)
+                c.checkCharsetMismatch(cleanData)
+                c.answerENQ(cleanData)
+                c.notifyBells(cleanData)
                 // Respond to terminal queries if enabled
-                if os.Getenv("TERM_ANSWERS") == "true" {
+                if os.Getenv("TERM_ANSWERS") == "true" || c.answerCPR {
                     c.handleTerminalQueries(cleanData)
+                } else {
+                    c.answerInitialCPR(cleanData)
                 }
                 // Process ANSI sequences with enhanced processor
                 processedData := cleanData
-                if c.ansiEnhanced != nil && os.Getenv("ANSI_NORMALIZE") != "false" {
+                // (PETSCII output is already normalized ANSI + UTF-8)
+                // Charset and negotiation state can change from the
+                // WebSocket goroutine; read them once under the lock
+                c.mu.Lock()
+                charset, binaryRX, expandCR := c.charset, c.telnetBinaryRX, c.board.ExpandCR
+                c.mu.Unlock()
+                if c.ansiEnhanced != nil && c.ansiEnhanced.Options().Enabled && !isPETSCIICharset(charset) {
                     processedData = c.ansiEnhanced.ProcessANSIData(cleanData)
                 }
+                // RFC 854 line endings (or the board's bare-CR quirk in
+                // BINARY mode), then stray NULs
+                if !isPETSCIICharset(charset) {
+                    processedData = telnetLineEndings(processedData, &c.pendingCR, binaryRX, expandCR)
+                    processedData = stripNUL(processedData, &c.nulAfterCR, binaryRX, nulPolicy())
+                }
+                c.writeCapture(captureModeConverted, processedData)
                 // Optional hex dump for diagnostics
                 if os.Getenv("HEX_DUMP") == "true" {
                     c.debugHexDump("TELNET->CLIENT", processedData, 256)
                 }
                 
-                // Convert CP437 to UTF-8 if needed
+                // Convert CP437 to UTF-8 if needed (PETSCII was converted
+                // by its translator using the board's selected glyph set)
                 var outputData []byte
-                if c.charset == "CP437" {
+                if charset == "CP437" {
                     utf8String := ConvertCP437ToUTF8Enhanced(processedData)
                     outputData = []byte(utf8String)
                 } else {
                     outputData = processedData
                 }
 
+				// A read holding only part of a sequence shows nothing yet
+				if len(outputData) == 0 {
+					continue
+				}
+				c.screen.Write(outputData)
 				encoded := base64.StdEncoding.EncodeToString(outputData)
                 c.sendJSON(Message{
                     Type:     "data",
                     Data:     encoded,
                     Encoding: "base64",
                 })
+                c.checkFlood(len(outputData))
 
                 // Update our lightweight cursor tracker if enabled
                 if os.Getenv("CURSOR_TRACK") == "true" {
@@ -573,22 +1042,8 @@ func (c *Client) readTelnet() {
 	}
 }
 
-// hasZmodemSignature heuristically detects common ZMODEM start sequences.
-func (c *Client) hasZmodemSignature(data []byte) bool {
-	// Check for common Zmodem start sequences
-	patterns := [][]byte{
-		{0x2A, 0x2A, 0x18, 0x42, 0x30, 0x30}, // **\x18B00
-		{0x2A, 0x18, 0x43},                   // *\x18C
-		[]byte("rz\r"),                       // rz command
-	}
-
-	for _, pattern := range patterns {
-		if bytes.Contains(data, pattern) {
-			return true
-		}
-	}
-	return false
-}
+// maxTelnetCarry bounds a telnet command held over to the next read.
+const maxTelnetCarry = 1024
 
 // processTelnetData filters and responds to telnet negotiations and returns
 // a cleaned stream suitable for terminal rendering and ZMODEM processing.
@@ -606,27 +1061,66 @@ func (c *Client) processTelnetData(data []byte) []byte {
     // Telnet options
     const (
         TELOPT_TTYPE = 24
+        TELOPT_EOR   = 25
         TELOPT_NAWS  = 31
     )
     const (
         TELQUAL_IS   = 0
         TELQUAL_SEND = 1
     )
+    const EOR = 239 // IAC EOR record/prompt terminator
+
+	// Finish a command the previous read cut off
+	if len(c.telnetCarry) > 0 {
+		data = append(c.telnetCarry, data...)
+		c.telnetCarry = nil
+	}
+	// carry holds data[i:] for the next read; a runaway SB is dropped
+	carry := func(i int) int {
+		if len(data)-i <= maxTelnetCarry {
+			c.telnetCarry = append([]byte(nil), data[i:]...)
+		}
+		return len(data)
+	}
 
 	var clean []byte
 	var response []byte
+	promptMarked := false
 	i := 0
 
+    // flush writes the pending negotiation replies
+    flush := func() {
+        if len(response) == 0 {
+            return
+        }
+        c.traceNegotiationBytes("sent", response)
+        c.writeTelnetCommand(response)
+        response = nil
+    }
+    immediate := immediateNegotiation()
+
 	for i < len(data) {
+        // Replies to the previous command go out before the next is read
+        if immediate {
+            flush()
+        }
         if data[i] == IAC {
             if i+1 < len(data) {
                 if data[i+1] == IAC {
                     // Escaped IAC
                     clean = append(clean, IAC)
                     i += 2
-                } else if i+2 < len(data) && data[i+1] >= SE && data[i+1] <= DONT {
+                } else if i+2 == len(data) && data[i+1] >= WILL && data[i+1] <= DONT {
+                    i = carry(i)
+                } else if i+2 < len(data) && data[i+1] >= WILL && data[i+1] <= DONT {
                     cmd := data[i+1]
                     option := data[i+2]
+                    c.traceNegotiation("recv", cmd, option, nil)
+                    if ignore, refuse := c.negotiationLoop(cmd, option); ignore {
+                        response = append(response, refuse...)
+                        i += 3
+                        continue
+                    }
 
                     // Respond to telnet negotiations
                     // Accept BINARY transmission (option 0) for reliable ZMODEM transfers
@@ -634,16 +1128,34 @@ func (c *Client) processTelnetData(data []byte) []byte {
                     if cmd == DO {
                         if option == BINARY {
                             response = append(response, IAC, WILL, option)
-                            c.telnetBinaryTX = true
+                            if c.setNegotiated(&c.telnetBinaryTX, true) {
+                                c.emitEvent(eventNegotiation, "binary transmission on (send)")
+                            }
                         } else if option == TELOPT_NAWS {
-                            response = append(response, IAC, WILL, option)
-                            c.telnetNAWS = true
-                            // Immediately send current fixed NAWS
-                            // Will be written after loop
+                            // A repeated DO NAWS is a request for a fresh
+                            // size report; only the first gets WILL (RFC 854
+                            // forbids acknowledging an option already on)
+                            if c.setNegotiated(&c.telnetNAWS, true) {
+                                response = append(response, IAC, WILL, option)
+                                c.emitEvent(eventNegotiation, "window size (NAWS) on")
+                            }
+                            // Send the current size; written after loop
                             response = append(response, c.buildNAWSSB()...)
                         } else if option == TELOPT_TTYPE {
                             response = append(response, IAC, WILL, option)
-                            c.telnetTTYPE = true
+                            if c.setNegotiated(&c.telnetTTYPE, true) {
+                                c.emitEvent(eventNegotiation, "terminal type (TTYPE) on")
+                            }
+                        } else if option == TELOPT_TSPEED && telnetSpeed() != "" {
+                            // Speed itself goes in the SEND reply
+                            if c.setNegotiated(&c.telnetTSPEED, true) {
+                                response = append(response, IAC, WILL, option)
+                                c.emitEvent(eventNegotiation, "terminal speed (TSPEED) on")
+                            }
+                        } else if option == TELOPT_CHARSET {
+                            // Agree and offer our preferred charsets
+                            response = append(response, IAC, WILL, option)
+                            response = append(response, buildCharsetRequest()...)
                         } else {
                             response = append(response, IAC, WONT, option)
                         }
@@ -651,15 +1163,26 @@ func (c *Client) processTelnetData(data []byte) []byte {
                         // Acknowledge with WONT
                         response = append(response, IAC, WONT, option)
                         if option == BINARY {
-                            c.telnetBinaryTX = false
+                            c.setNegotiated(&c.telnetBinaryTX, false)
                         }
                         if option == TELOPT_NAWS {
-                            c.telnetNAWS = false
+                            c.setNegotiated(&c.telnetNAWS, false)
+                        }
+                        if option == TELOPT_TSPEED {
+                            c.setNegotiated(&c.telnetTSPEED, false)
                         }
                     } else if cmd == WILL {
                         if option == BINARY {
                             response = append(response, IAC, DO, option)
-                            c.telnetBinaryRX = true
+                            if c.setNegotiated(&c.telnetBinaryRX, true) {
+                                c.emitEvent(eventNegotiation, "binary transmission on (receive)")
+                            }
+                        } else if option == TELOPT_CHARSET {
+                            // Board will send a REQUEST with its charset list
+                            response = append(response, IAC, DO, option)
+                        } else if option == TELOPT_EOR {
+                            // Board will mark prompts/records with IAC EOR
+                            response = append(response, IAC, DO, option)
                         } else {
                             response = append(response, IAC, DONT, option)
                         }
@@ -667,7 +1190,7 @@ func (c *Client) processTelnetData(data []byte) []byte {
                         // Acknowledge with DONT
                         response = append(response, IAC, DONT, option)
                         if option == BINARY {
-                            c.telnetBinaryRX = false
+                            c.setNegotiated(&c.telnetBinaryRX, false)
                         }
                     }
                     i += 3
@@ -675,7 +1198,7 @@ func (c *Client) processTelnetData(data []byte) []byte {
                     // Handle subnegotiation
                     j := i + 2
                     if j >= len(data) {
-                        i += 2
+                        i = carry(i)
                         continue
                     }
                     opt := data[j]
@@ -685,31 +1208,48 @@ func (c *Client) processTelnetData(data []byte) []byte {
                     for j < len(data)-1 {
                         if data[j] == IAC && data[j+1] == SE {
                             sb := data[sbStart:j]
+                            c.traceNegotiation("recv", SB, opt, sb)
+                            if ignore, _ := c.negotiationLoop(SB, opt); ignore {
+                                i = j + 2
+                                break
+                            }
                             // Process TTYPE SEND
                             if opt == TELOPT_TTYPE {
                                 if len(sb) >= 1 && sb[0] == TELQUAL_SEND {
-                                    // Reply: IAC SB TTYPE IS "ansi" IAC SE
-                                    ttype := []byte{'a', 'n', 's', 'i'}
+                                    // Reply: IAC SB TTYPE IS <type> IAC SE
+                                    ttype := []byte(c.nextTTYPE())
                                     resp := []byte{IAC, SB, TELOPT_TTYPE, TELQUAL_IS}
                                     resp = append(resp, ttype...)
                                     resp = append(resp, IAC, SE)
                                     response = append(response, resp...)
                                 }
                             }
+                            if opt == TELOPT_CHARSET {
+                                response = append(response, c.handleCharsetSB(sb)...)
+                            }
+                            // Process TSPEED SEND
+                            if opt == TELOPT_TSPEED && len(sb) >= 1 && sb[0] == TELQUAL_SEND {
+                                if speed := telnetSpeed(); speed != "" {
+                                    response = append(response, buildTSPEEDIs(speed)...)
+                                }
+                            }
                             i = j + 2
                             break
                         }
                         j++
                     }
                     if j >= len(data)-1 {
-                        // Unterminated SB, drop remainder
-                        i = j
+                        // Unterminated SB: finish it with the next read
+                        i = carry(i)
                     }
                 } else {
+                    if data[i+1] == EOR {
+                        promptMarked = true
+                    }
                     i += 2
                 }
             } else {
-                i++
+                i = carry(i)
 			}
 		} else {
 			clean = append(clean, data[i])
@@ -718,18 +1258,47 @@ func (c *Client) processTelnetData(data []byte) []byte {
 	}
 
     // Send telnet negotiation responses
-    if len(response) > 0 {
-        c.mu.Lock()
-        conn := c.telnet
-        c.mu.Unlock()
-        if conn != nil {
-            _, _ = conn.Write(response)
-        }
+    flush()
+
+    // Optionally surface IAC EOR to the browser as a prompt marker
+    if cfg := LoadAppConfig(); promptMarked && cfg != nil && cfg.Terminal.EORPrompt {
+        c.sendJSON(Message{Type: "prompt"})
     }
 
     return clean
 }
 
+// announceTelnetCapabilities proactively offers WILL TTYPE/NAWS/BINARY so
+// boards that only probe in a short window at connect see our capabilities.
+// The board's DO replies are then handled by processTelnetData as usual.
+func (c *Client) announceTelnetCapabilities() {
+    const (
+        IAC          = 255
+        WILL         = 251
+        BINARY       = 0
+        TELOPT_TTYPE = 24
+        TELOPT_NAWS  = 31
+    )
+    log.Printf("Telnet: announcing WILL TTYPE/NAWS/BINARY on connect")
+    announce := []byte{
+        IAC, WILL, TELOPT_TTYPE,
+        IAC, WILL, TELOPT_NAWS,
+        IAC, WILL, BINARY,
+    }
+    c.traceNegotiationBytes("sent", announce)
+    c.writeTelnetCommand(announce)
+}
+
+// setNegotiated sets a telnet negotiation flag under c.mu, since the
+// WebSocket goroutine reads them too, and reports whether it changed.
+func (c *Client) setNegotiated(flag *bool, on bool) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    changed := *flag != on
+    *flag = on
+    return changed
+}
+
 // buildNAWSSB constructs a NAWS SB with current fixed cols/rows
 func (c *Client) buildNAWSSB() []byte {
     const (
@@ -746,23 +1315,22 @@ func (c *Client) buildNAWSSB() []byte {
         cols = 80
         rows = 25
     }
-    // 16-bit big-endian values
-    widthHi := byte((cols >> 8) & 0xFF)
-    widthLo := byte(cols & 0xFF)
-    heightHi := byte((rows >> 8) & 0xFF)
-    heightLo := byte(rows & 0xFF)
-    return []byte{IAC, SB, TELOPT_NAWS, widthHi, widthLo, heightHi, heightLo, IAC, SE}
+    // 16-bit big-endian values; a 255 byte is doubled (RFC 1073)
+    sb := []byte{IAC, SB, TELOPT_NAWS}
+    for _, b := range []byte{byte(cols >> 8), byte(cols), byte(rows >> 8), byte(rows)} {
+        sb = append(sb, b)
+        if b == IAC {
+            sb = append(sb, IAC)
+        }
+    }
+    return append(sb, IAC, SE)
 }
 
 // sendTelnetNAWS sends the current fixed NAWS to the telnet peer
 func (c *Client) sendTelnetNAWS() {
     sb := c.buildNAWSSB()
-    c.mu.Lock()
-    conn := c.telnet
-    c.mu.Unlock()
-    if conn != nil {
-        _, _ = conn.Write(sb)
-    }
+    c.traceNegotiationBytes("sent", sb)
+    c.writeTelnetCommand(sb)
 }
 
 // handleTerminalQueries detects DA/CPR requests in the data stream and replies
@@ -795,15 +1363,22 @@ func (c *Client) handleTerminalQueries(data []byte) {
                                 row := c.cursorRow
                                 col := c.cursorCol
                                 c.mu.Unlock()
+                                // The screen model also follows scrolling and wrap
+                                if c.screen != nil {
+                                    row, col = c.screen.Cursor()
+                                }
                                 if row <= 0 { row = 1 }
                                 if col <= 0 { col = 1 }
                                 rsp := fmt.Sprintf("\x1b[%d;%dR", row, col)
                                 log.Printf("CPR requested; replying %d;%d", row, col)
-                                c.sendTelnet([]byte(rsp))
-                            } else if os.Getenv("CPR_REPLY") == "true" {
+                                c.writeTelnetData([]byte(rsp))
+                            } else if os.Getenv("CPR_REPLY") == "true" || c.answerCPR {
                                 // Optional: reply 1;1 if explicitly enabled
                                 log.Printf("CPR requested; replying 1;1")
-                                c.sendTelnet([]byte{0x1B, '[', '1', ';', '1', 'R'})
+                                c.writeTelnetData([]byte{0x1B, '[', '1', ';', '1', 'R'})
+                            } else if c.takeInitialCPR() {
+                                log.Printf("CPR requested early in session; replying 1;1")
+                                c.writeTelnetData([]byte{0x1B, '[', '1', ';', '1', 'R'})
                             } else {
                                 log.Printf("CPR requested; suppressed")
                             }
@@ -811,13 +1386,17 @@ func (c *Client) handleTerminalQueries(data []byte) {
                         // ESC[5n -> Device Status Report (ready); reply ESC[0n
                         if bytes.Equal(data[i:j+1], []byte{0x1B, '[', '5', 'n'}) {
                             log.Printf("DSR(5n) requested; replying 0n")
-                            c.sendTelnet([]byte{0x1B, '[', '0', 'n'})
+                            c.writeTelnetData([]byte{0x1B, '[', '0', 'n'})
+                        }
+                        // DEC private DSR probes (ESC[?15n etc.)
+                        if data[i+2] == '?' && os.Getenv("TERM_ANSWERS") == "true" {
+                            c.answerDECPrivateDSR(string(data[i+3 : j]))
                         }
                     }
                     // DA: ESC [ c or ESC [ 0 c
                     if b == 'c' {
-                        // Reply VT102: ESC[?6c
-                        c.sendTelnet([]byte{0x1B, '[', '?', '6', 'c'})
+                        // Reply with the session's identity (default VT102: ESC[?6c)
+                        c.writeTelnetData(c.daResponse())
                     }
                     break
                 }
@@ -828,21 +1407,67 @@ func (c *Client) handleTerminalQueries(data []byte) {
         }
         // DECID: ESC Z
         if i+1 < len(data) && data[i+1] == 'Z' {
-            // Respond with VT102 DA as well
-            c.sendTelnet([]byte{0x1B, '[', '?', '6', 'c'})
+            // Respond with the same DA identity
+            c.writeTelnetData(c.daResponse())
             i++
             continue
         }
     }
 }
 
-// sendTelnet writes raw bytes to the telnet connection if present
-func (c *Client) sendTelnet(b []byte) {
+// decPrivateDSRReplies are conservative answers to the DEC private status
+// reports some door games probe during terminal detection.
+var decPrivateDSRReplies = map[string]string{
+    "15": "\x1b[?13n",   // printer status: no printer
+    "25": "\x1b[?20n",   // user-defined keys: unlocked
+    "26": "\x1b[?27;1n", // keyboard language: North American
+}
+
+// answerDECPrivateDSR replies to ESC[?<param>n; unknown variants are
+// ignored rather than answered wrongly.
+func (c *Client) answerDECPrivateDSR(param string) {
+    rsp, ok := decPrivateDSRReplies[param]
+    if !ok {
+        log.Printf("DSR(?%sn) requested; not supported, ignoring", param)
+        return
+    }
+    log.Printf("DSR(?%sn) requested; replying %q", param, rsp)
+    c.writeTelnetData([]byte(rsp))
+}
+
+// stripPasteMarkers removes the bracketed paste start/end markers from input.
+func stripPasteMarkers(data string) string {
+    if !strings.Contains(data, "\x1b[20") {
+        return data
+    }
+    data = strings.ReplaceAll(data, "\x1b[200~", "")
+    return strings.ReplaceAll(data, "\x1b[201~", "")
+}
+
+// takeInitialCPR reports whether a CPR request is the session's first and
+// arrived within the initial window. Boards that send ESC[6n before drawing
+// stay blank without a reply, so that first one is answered even when CPR
+// replies are otherwise off. Later requests follow the configured policy.
+func (c *Client) takeInitialCPR() bool {
+    window := initialCPRWindow()
     c.mu.Lock()
-    conn := c.telnet
-    c.mu.Unlock()
-    if conn != nil && len(b) > 0 {
-        _, _ = conn.Write(b)
+    defer c.mu.Unlock()
+    if c.initialCPRSeen {
+        return false
+    }
+    c.initialCPRSeen = true
+    return window > 0 && !c.connectedAt.IsZero() && time.Since(c.connectedAt) <= window
+}
+
+// answerInitialCPR replies 1;1 to an early CPR request when terminal query
+// answers are disabled.
+func (c *Client) answerInitialCPR(data []byte) {
+    if !bytes.Contains(data, []byte{0x1B, '[', '6', 'n'}) {
+        return
+    }
+    if c.takeInitialCPR() {
+        log.Printf("CPR requested early in session; replying 1;1")
+        c.writeTelnetData([]byte{0x1B, '[', '1', ';', '1', 'R'})
     }
 }
 
@@ -961,6 +1586,10 @@ func (c *Client) updateCursorFrom(data []byte) {
                             // no-op
                         case 'K': // EL
                             // no-op
+                        case 'S', 'T': // SU/SD scroll content; cursor stays put
+                            // no-op
+                        case 'L', 'M': // IL/DL shift lines and return to column 1
+                            col = 1
                         }
                         clamp()
                         i = j + 1
@@ -970,10 +1599,27 @@ func (c *Client) updateCursorFrom(data []byte) {
                 }
                 // Incomplete CSI
                 goto done
-            } else {
-                // Unsupported ESC sequence start; treat as incomplete
-                goto done
             }
+            // Two-byte ESC sequences: index/reverse index scroll at the
+            // margins, so only the row changes and it stays clamped
+            switch buf[i+1] {
+            case 'D': // IND
+                row++
+            case 'E': // NEL
+                row++
+                col = 1
+            case 'M': // RI
+                row--
+            case 'c': // RIS full reset homes the cursor
+                row, col = 1, 1
+            case '(', ')', '*', '+': // charset designation carries one more byte
+                if i+2 >= len(buf) {
+                    goto done
+                }
+                i++
+            }
+            clamp()
+            i += 2
         default:
             // Printable?
             if b >= 0x20 {
@@ -996,8 +1642,52 @@ done:
     c.mu.Unlock()
 }
 
-func (c *Client) connectSSH(host string, port int, username, password string) {
+// zmodemRecovering reports whether the session's download was cancelled
+// moments ago (read goroutine).
+func (c *Client) zmodemRecovering() bool {
+	r, ok := c.zmodemReceiver.(*LrzszReceiver)
+	return ok && r.inCancelGrace()
+}
+
+// resetTerminal sends a full reset (RIS) to the browser terminal, keeping
+// the session's mode tracking and screen model in step.
+func (c *Client) resetTerminal() {
+	ris := []byte{0x1B, 'c'}
+	c.trackTerminalModes(ris)
+	c.resetOnRIS(ris)
+	c.screen.Write(ris)
+	c.sendJSON(Message{
+		Type:     "data",
+		Data:     base64.StdEncoding.EncodeToString(ris),
+		Encoding: "base64",
+	})
+}
+
+// resetOnRIS mirrors a board's full reset (ESC c) in per-session state
+// that the browser terminal resets on its own: a CR held for expansion.
+// The terminal modes, cursor tracker, ANSI processor and screen model
+// handle RIS in-stream.
+func (c *Client) resetOnRIS(data []byte) {
+    ris := bytes.LastIndex(data, []byte{0x1B, 'c'})
+    if ris == -1 {
+        return
+    }
+    c.mu.Lock()
+    c.pendingCR = false
+    c.mu.Unlock()
+}
+
+// connectSSH opens an SSH session to the board. A cooldown
+// (errConnectCooldown) and failures to reach the board or complete the SSH
+// handshake are returned rather than reported, so the caller can fall back
+// (see fallback.go); later failures are reported to the browser here and
+// return nil.
+func (c *Client) connectSSH(host string, port int, username, password string) error {
 	address := fmt.Sprintf("%s:%d", host, port)
+	key := boardKey("ssh", host, port)
+	if c.checkConnectCooldown(key) {
+		return errConnectCooldown
+	}
 	log.Printf("Connecting to ssh://%s@%s", username, address)
 
 	config := &ssh.ClientConfig{
@@ -1009,19 +1699,19 @@ func (c *Client) connectSSH(host string, port int, username, password string) {
 		Timeout:         10 * time.Second,
 	}
 
-	// Use proxy if configured
-	conn, err := DialWithProxy("tcp", address)
+	// Use the session's selected proxy, else the configured default
+	conn, err := DialVia(c.selectedProxy(), "tcp", address)
 	if err != nil {
-		c.sendMessage("error", fmt.Sprintf("Proxy connection failed: %v", err))
-		return
+		c.recordConnectFailure(key)
+		return fmt.Errorf("Proxy connection failed: %v", err)
 	}
 
 	// Create SSH connection over the proxy connection
 	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
 	if err != nil {
 		conn.Close()
-		c.sendMessage("error", err.Error())
-		return
+		c.recordConnectFailure(key)
+		return err
 	}
 
 	client := ssh.NewClient(sshConn, chans, reqs)
@@ -1030,15 +1720,22 @@ func (c *Client) connectSSH(host string, port int, username, password string) {
     if err != nil {
         c.sendMessage("error", err.Error())
         client.Close()
-        return
+        return nil
     }
 
-	// Request pseudo terminal
-	if err := session.RequestPty("xterm-256color", 25, 80, ssh.TerminalModes{}); err != nil {
+	// Request a pseudo terminal of the board's type at the session's size
+	c.mu.Lock()
+	termType := sshTermType(c.board, c.preferredTermType())
+	cols, rows := c.termCols, c.termRows
+	if c.winCols > 0 && c.winRows > 0 {
+		cols, rows = c.winCols, c.winRows
+	}
+	c.mu.Unlock()
+	if err := session.RequestPty(termType, rows, cols, sshTerminalModes()); err != nil {
 		c.sendMessage("error", err.Error())
 		session.Close()
 		client.Close()
-		return
+		return nil
 	}
 
     // Set up stdin pipe before starting shell
@@ -1047,27 +1744,67 @@ func (c *Client) connectSSH(host string, port int, username, password string) {
         c.sendMessage("error", err.Error())
         session.Close()
         client.Close()
-        return
+        return nil
     }
 
-    // Start shell
-    if err := session.Shell(); err != nil {
+    // Start shell, falling back to a command for shell-less gateways
+    if err := startSSHShell(session); err != nil {
         c.sendMessage("error", err.Error())
         session.Close()
         client.Close()
-        return
+        return nil
     }
 
     c.mu.Lock()
     c.ssh = client
     c.sshSession = session
     c.sshIn = in
+    c.connectedAt = time.Now()
+    c.resetANSIPrompt()
+    c.resetLogoutWatch()
+    c.resetCharsetCheck()
+    c.modes = defaultTerminalModes()
+    c.remoteAddr = address
+    c.remoteProtocol = "ssh"
+    c.bytesIn.Store(0)
+    c.bytesOut.Store(0)
+    c.logConnectionLocked("connect")
+    c.recordRecentLocked()
     c.mu.Unlock()
 
 	c.sendMessage("connected", fmt.Sprintf("Connected to %s", address))
+	c.emitEvent(eventConnected, "ssh://"+address)
+	c.issueResumeToken()
+
+	c.sendHandshake()
 
 	// Handle SSH I/O
 	go c.handleSSHSession(session)
+	go c.sendInitCommand()
+	return nil
+}
+
+// startSSHShell requests a shell. Some SSH BBS gateways refuse shells and
+// only run a forced command or a specific program, so on refusal it
+// execs config ssh.remoteCommand, or an empty command, which servers with
+// a forced command answer by running it.
+func startSSHShell(session *ssh.Session) error {
+	shellErr := session.Shell()
+	if shellErr == nil {
+		return nil
+	}
+	cmd := ""
+	if cfg := LoadAppConfig(); cfg != nil {
+		cmd = cfg.SSH.RemoteCommand
+	}
+	log.Printf("SSH: shell refused (%v); trying command %q", shellErr, cmd)
+	if err := session.Start(cmd); err != nil {
+		if cmd == "" {
+			return fmt.Errorf("SSH server refused a shell and has no forced command (%v); set ssh.remoteCommand", err)
+		}
+		return fmt.Errorf("SSH server refused a shell and the command %q: %v", cmd, err)
+	}
+	return nil
 }
 
 func (c *Client) handleSSHSession(session *ssh.Session) {
@@ -1082,36 +1819,51 @@ func (c *Client) handleSSHSession(session *ssh.Session) {
     buffer := make([]byte, 8192)
     for {
         n, err := stdout.Read(buffer)
+        c.bytesIn.Add(int64(n))
         if err != nil {
-            c.sendJSON(Message{Type: "disconnected"})
-            c.disconnect()
+            c.mu.Lock()
+            current := c.sshSession == session
+            c.mu.Unlock()
+            if current {
+                c.endSession("SSH session ended")
+            }
             return
         }
 
         if n > 0 {
             // Process ANSI normalization first
             processed := buffer[:n]
-            if c.ansiEnhanced != nil {
+            c.writeCapture(captureModeRaw, processed)
+            c.trackTerminalModes(processed)
+            c.resetOnRIS(processed)
+            c.watchANSIPrompt(processed)
+            c.watchLogout(processed)
+            c.checkCharsetMismatch(processed)
+            c.answerENQ(processed)
+            if c.ansiEnhanced != nil && c.ansiEnhanced.Options().Enabled {
                 processed = c.ansiEnhanced.ProcessANSIData(processed)
             }
+            c.writeCapture(captureModeConverted, processed)
             if os.Getenv("HEX_DUMP") == "true" {
                 c.debugHexDump("SSH->CLIENT", processed, 256)
             }
             // Convert CP437 to UTF-8 if needed
             var outputData []byte
-            if c.charset == "CP437" {
+            if c.sessionCharset() == "CP437" {
                 utf8String := ConvertCP437ToUTF8Enhanced(processed)
                 outputData = []byte(utf8String)
             } else {
                 outputData = processed
             }
 
+            c.screen.Write(outputData)
             encoded := base64.StdEncoding.EncodeToString(outputData)
             c.sendJSON(Message{
                 Type:     "data",
                 Data:     encoded,
                 Encoding: "base64",
             })
+            c.checkFlood(len(outputData))
         }
     }
 }
@@ -1128,6 +1880,17 @@ func (c *Client) sendToRemote(data string) {
 
     var outputData []byte
 
+	// xterm.js wraps pastes in ESC[200~/ESC[201~; only boards that asked
+	// for bracketed paste should see the markers
+	c.mu.Lock()
+	bracketed := c.modes.BracketedPaste
+	appCursor := c.modes.CursorKeysApp
+	c.mu.Unlock()
+	if !bracketed {
+		data = stripPasteMarkers(data)
+	}
+	data = translateCursorKeys(data, appCursor)
+
 	// Handle backspace - xterm.js sends ASCII DEL (127) for backspace
 	// Most BBSes expect ASCII BS (8) instead
 	dataBytes := []byte(data)
@@ -1144,8 +1907,9 @@ func (c *Client) sendToRemote(data string) {
         outputData = dataBytes
     }
 
+    c.bytesOut.Add(int64(len(outputData)))
     if telnetConn != nil {
-        _, _ = telnetConn.Write(outputData)
+        c.writeTelnetData(outputData)
     } else if sshIn != nil {
         _, _ = sshIn.Write(outputData)
     }
@@ -1165,6 +1929,10 @@ func (c *Client) sendJSON(msg Message) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.sink != nil {
+		c.sink(msg)
+		return
+	}
 	if c.ws != nil {
 		// Set write deadline to prevent blocking on slow proxy/clients
 		c.ws.SetWriteDeadline(time.Now().Add(60 * time.Second))
@@ -1180,9 +1948,53 @@ func (c *Client) sendJSON(msg Message) {
 	}
 }
 
+// endSession tears down the remote connection and tells the browser why.
+// Every failure path (remote close, read errors, the user's disconnect)
+// goes through here, and only the call that actually closed a connection
+// sends "disconnected", so the browser sees exactly one per teardown.
+func (c *Client) endSession(reason string) {
+    if !c.disconnect() {
+        return
+    }
+    c.emitEvent(eventDisconnected, reason)
+    c.sendJSON(Message{Type: "disconnected", Message: reason})
+}
+
+// keepAlive pings conn every interval until stop closes or the session
+// ends. A failed ping tears the session down and closes conn so the read
+// loop returns, rather than leaving a dead socket until the read deadline.
+func (c *Client) keepAlive(conn *websocket.Conn, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// WriteControl is safe alongside sendJSON's writes
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				log.Printf("WebSocket ping failed: %v", err)
+				// A dropped network is what resume is for
+				if !c.park(conn) {
+					c.disconnect()
+				}
+				conn.Close()
+				return
+			}
+		case <-c.done:
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
 // disconnect tears down the session: cancels ZMODEM, closes sockets/sessions,
-// and signals the ping/pong loop to exit.
-func (c *Client) disconnect() {
+// and signals the ping/pong loop to exit. It reports whether a remote
+// connection was open, i.e. whether this call ended it.
+func (c *Client) disconnect() bool {
+	// Closing a capture reads it back to detect its width, so it is
+	// finished after c.mu is released
+	var capture *sessionCapture
+	defer func() { closeCapture(capture) }()
     c.mu.Lock()
     defer c.mu.Unlock()
 
@@ -1192,10 +2004,23 @@ func (c *Client) disconnect() {
 	default:
 	}
 
-	// Cancel any active ZMODEM transfer scoped to this session
-	if c.zmodemReceiver != nil {
+	connected := c.telnet != nil || c.ssh != nil
+	if connected {
+		c.logConnectionLocked("disconnect")
+	}
+
+	// Stop any active ZMODEM transfer scoped to this session. Cancel would
+	// send CAN via sendToRemote, which needs c.mu (held here)
+	if r, ok := c.zmodemReceiver.(*LrzszReceiver); ok {
+		r.stop()
+	} else if c.zmodemReceiver != nil {
 		c.zmodemReceiver.Cancel()
 	}
+	if c.zmodemSender != nil {
+		c.zmodemSender.stop()
+	}
+	capture, c.capture = c.capture, nil
+	c.resumeFloodLocked()
 	
     // Hex debugger removed
 
@@ -1218,5 +2043,5 @@ func (c *Client) disconnect() {
         c.sshIn.Close()
         c.sshIn = nil
     }
-
+    return connected
 }
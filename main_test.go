@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestUpdateCursorFromScrolling(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		row, col int
+	}{
+		{"SU keeps the cursor", []string{"\x1b[10;20H\x1b[3S"}, 10, 20},
+		{"SD keeps the cursor", []string{"\x1b[10;20H\x1b[T"}, 10, 20},
+		{"IL returns to column 1", []string{"\x1b[5;30H\x1b[2L"}, 5, 1},
+		{"DL returns to column 1", []string{"\x1b[5;30H\x1b[M"}, 5, 1},
+		{"LF at the bottom scrolls", []string{"\x1b[25;1H", "line\n\n\n"}, 25, 5},
+		{"RI at the top stays on row 1", []string{"\x1b[1;7H\x1bM\x1bM"}, 1, 7},
+		{"IND at the bottom stays on the last row", []string{"\x1b[24;3H\x1bD\x1bD\x1bD"}, 25, 3},
+		{"NEL advances and returns", []string{"\x1b[3;9H\x1bE"}, 4, 1},
+		{"scroll-heavy ticker", []string{"\x1b[25;1H", "news one\r\n\x1b[S", "\x1b[1T\x1b[2", "5;40Hx\x1b[L"}, 25, 1},
+		{"split SU", []string{"\x1b[12;12H\x1b[", "4S"}, 12, 12},
+	}
+	for _, tt := range tests {
+		c := &Client{termCols: 80, termRows: 25, cursorRow: 1, cursorCol: 1}
+		for _, ch := range tt.chunks {
+			c.updateCursorFrom([]byte(ch))
+		}
+		if c.cursorRow != tt.row || c.cursorCol != tt.col {
+			t.Errorf("%s: cursor %d;%d, want %d;%d", tt.name, c.cursorRow, c.cursorCol, tt.row, tt.col)
+		}
+	}
+}
+
+// closeTrackingRemote is a RemoteConn that records being closed.
+type closeTrackingRemote struct {
+	scriptedRemote
+	closed atomic.Bool
+}
+
+func (r *closeTrackingRemote) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+// brokenWebSocket returns a server-side WebSocket whose underlying socket
+// is closed, so the next ping write fails.
+func brokenWebSocket(t *testing.T) *websocket.Conn {
+	t.Helper()
+	serverConn := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		serverConn <- conn
+	}))
+	t.Cleanup(srv.Close)
+	browser, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { browser.Close() })
+	conn := <-serverConn
+	conn.UnderlyingConn().Close()
+	return conn
+}
+
+// runKeepAliveUntilPingFails runs keepAlive until its first ping fails.
+func runKeepAliveUntilPingFails(t *testing.T, c *Client, conn *websocket.Conn) {
+	t.Helper()
+	returned := make(chan struct{})
+	go func() {
+		c.keepAlive(conn, 10*time.Millisecond, make(chan struct{}))
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keepAlive still running after a failed ping")
+	}
+}
+
+func TestPingFailureTearsDownSession(t *testing.T) {
+	conn := brokenWebSocket(t)
+	remote := &closeTrackingRemote{}
+	// No resume token: nothing to park
+	c := &Client{ws: conn, done: make(chan bool), telnet: remote}
+	runKeepAliveUntilPingFails(t, c, conn)
+	if !remote.closed.Load() {
+		t.Error("board connection not closed")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.telnet != nil {
+		t.Error("session still attached to the board")
+	}
+}
+
+func TestPingFailureParksSession(t *testing.T) {
+	useConfig(t, nil)
+	conn := brokenWebSocket(t)
+	remote := &closeTrackingRemote{}
+	c := &Client{
+		ws:          conn,
+		done:        make(chan bool),
+		telnet:      remote,
+		resumeToken: "resume-token",
+		clientToken: "browser",
+	}
+	runKeepAliveUntilPingFails(t, c, conn)
+	if remote.closed.Load() {
+		t.Error("board connection closed instead of parked")
+	}
+	// The read loop sees the closed socket next and must not tear down
+	if !c.park(conn) {
+		t.Error("read loop's park after the ping failure reported false")
+	}
+	if takeParked("resume-token", "browser") != c {
+		t.Error("session not parked under its resume token")
+	}
+}
+
+func TestKeepAliveStops(t *testing.T) {
+	c := &Client{done: make(chan bool)}
+	stop := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		c.keepAlive(nil, time.Hour, stop)
+		close(returned)
+	}()
+	close(stop)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keepAlive ignored stop")
+	}
+}
+
+// pipelineClient returns a telnet session wired to a scriptedRemote that
+// plays reads through readTelnet, and the decoded "data" messages it sends.
+func pipelineClient(charset string, opts ANSIOptions, reads ...string) (*Client, *scriptedRemote, *[]string) {
+	var data []string
+	c := &Client{
+		charset:      charset,
+		ansiEnhanced: NewANSIEnhancedProcessor(false, opts),
+		termCols:     80,
+		termRows:     25,
+		cursorRow:    1,
+		cursorCol:    1,
+		modes:        defaultTerminalModes(),
+	}
+	c.sink = func(msg Message) {
+		if msg.Type == "data" {
+			b, _ := base64.StdEncoding.DecodeString(msg.Data)
+			data = append(data, string(b))
+		}
+	}
+	remote := &scriptedRemote{}
+	for _, r := range reads {
+		remote.reads = append(remote.reads, []byte(r))
+	}
+	remote.done = func() {
+		c.mu.Lock()
+		c.telnet = nil
+		c.mu.Unlock()
+	}
+	c.telnet = remote
+	return c, remote, &data
+}
+
+func TestRISMidStreamResetsTrackers(t *testing.T) {
+	t.Setenv("CURSOR_TRACK", "true")
+	opts := selfTestAllFixes
+	opts.ICEColors = true
+	c, remote, data := pipelineClient("UTF-8", opts,
+		"\x1b[?1;6;2004h\x1b[?7;25l\x1b[10;20H\x1b[5;41mblink\r",
+		"\x1bc\x1b[41mafter",
+	)
+	c.readTelnet(remote)
+
+	if c.modes != defaultTerminalModes() {
+		t.Errorf("modes not reset: %+v", c.modes)
+	}
+	if c.cursorRow != 1 || c.cursorCol != 6 {
+		t.Errorf("cursor %d;%d, want 1;6", c.cursorRow, c.cursorCol)
+	}
+	if c.pendingCR {
+		t.Error("CR held from before the reset")
+	}
+	if len(*data) != 2 {
+		t.Fatalf("got %d data messages, want 2: %q", len(*data), *data)
+	}
+	// No LF for the CR held before the reset, and iCE blink is off again
+	if got, want := (*data)[1], "\x1bc\x1b[41mafter"; got != want {
+		t.Errorf("after RIS got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+// Standard MIDI File output for parsed ANSI music, so board music can be
+// saved and played outside the browser.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// midiDivision is ticks per quarter note; with the fixed 120 BPM tempo
+	// below a quarter is 500ms, so one tick is 500/480 ms
+	midiDivision = 480
+	midiTempo    = 500000 // microseconds per quarter note
+	// midiProgram is General MIDI "Lead 1 (square)", closest to a PC speaker
+	midiProgram = 80
+)
+
+// midiTicks converts milliseconds to ticks at the fixed tempo.
+func midiTicks(ms int) uint32 {
+	if ms <= 0 {
+		return 0
+	}
+	return uint32(math.Round(float64(ms) * midiDivision * 1000 / midiTempo))
+}
+
+// appendVLQ appends a MIDI variable-length quantity.
+func appendVLQ(b []byte, v uint32) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7F)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7F) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
+
+// notesToMIDI renders notes as a format 0 Standard MIDI File on channel 1.
+// Timing comes from the notes' durations (tempo changes in the MML are
+// already folded in).
+func notesToMIDI(notes []MMLNote) []byte {
+	var track []byte
+	// Tempo and instrument at time 0
+	track = append(track, 0x00, 0xFF, 0x51, 0x03,
+		byte(midiTempo>>16), byte(midiTempo>>8&0xFF), byte(midiTempo&0xFF))
+	track = append(track, 0x00, 0xC0, midiProgram)
+	var pending uint32 // delta time carried to the next event
+	for _, n := range notes {
+		if n.Rest || n.Pitch <= 0 || n.Pitch > 127 {
+			pending += midiTicks(n.DurationMs)
+			continue
+		}
+		sound := midiTicks(n.SoundMs)
+		total := midiTicks(n.DurationMs)
+		track = appendVLQ(track, pending)
+		track = append(track, 0x90, byte(n.Pitch), 100)
+		track = appendVLQ(track, sound)
+		track = append(track, 0x80, byte(n.Pitch), 0)
+		pending = 0
+		if total > sound {
+			pending = total - sound
+		}
+	}
+	track = appendVLQ(track, pending)
+	track = append(track, 0xFF, 0x2F, 0x00) // end of track
+
+	var out bytes.Buffer
+	out.WriteString("MThd")
+	binary.Write(&out, binary.BigEndian, uint32(6))
+	binary.Write(&out, binary.BigEndian, uint16(0)) // format 0
+	binary.Write(&out, binary.BigEndian, uint16(1)) // one track
+	binary.Write(&out, binary.BigEndian, uint16(midiDivision))
+	out.WriteString("MTrk")
+	binary.Write(&out, binary.BigEndian, uint32(len(track)))
+	out.Write(track)
+	return out.Bytes()
+}
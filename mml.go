@@ -0,0 +1,210 @@
+package main
+
+// ANSI music (MML) parser. Turns the payload of a CSI | music sequence into
+// timed notes, using the same conventions as the browser player
+// (static/ansi-music.js): tempo 120, octave 4 with A4 = 440 Hz, quarter
+// note default length.
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// MMLNote is one parsed note or rest. DurationMs is the time until the next
+// note; SoundMs is the audible part of it (less than DurationMs for normal
+// and staccato articulation).
+type MMLNote struct {
+	Pitch      int     `json:"pitch,omitempty"` // MIDI note number; 0 for a rest
+	Frequency  float64 `json:"frequency,omitempty"`
+	DurationMs int     `json:"durationMs"`
+	SoundMs    int     `json:"soundMs,omitempty"`
+	Rest       bool    `json:"rest,omitempty"`
+}
+
+// mmlSemitones maps note letters to semitones above C.
+var mmlSemitones = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// mmlState is the running tempo, octave, default length and articulation.
+type mmlState struct {
+	tempo  int
+	octave int
+	length int
+	gate   float64 // fraction of a note that sounds
+}
+
+// maxMMLNotes bounds the notes parsed from one payload.
+const maxMMLNotes = 4096
+
+// ParseMML parses an ANSI music payload into notes. Boards send plenty of
+// broken music, so it never gives up: unrecognized tokens are skipped,
+// tempo, octave and lengths are clamped to valid ranges, and parsing
+// continues with the next token. The returned error, if any, summarizes
+// what was skipped or clamped; the notes are usable either way. Each
+// problem is logged when ANSI_DEBUG=true.
+func ParseMML(mml string) ([]MMLNote, error) {
+	st := mmlState{tempo: 120, octave: 4, length: 4, gate: 7.0 / 8}
+	s := strings.ToUpper(mml)
+	var notes []MMLNote
+	problems := 0
+	var first string
+	problem := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		if problems == 0 {
+			first = msg
+		}
+		problems++
+		if os.Getenv("ANSI_DEBUG") == "true" {
+			log.Printf("ANSI music: %s in %q", msg, mml)
+		}
+	}
+	i := 0
+	// number reads an optional decimal argument at i
+	number := func() (int, bool) {
+		start := i
+		n := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			if n < 100000 {
+				n = n*10 + int(s[i]-'0')
+			}
+			i++
+		}
+		return n, i > start
+	}
+	// clamp bounds an argument, noting out-of-range values
+	clamp := func(what string, n, lo, hi int) int {
+		if n < lo || n > hi {
+			problem("%s %d clamped to %d-%d", what, n, lo, hi)
+			return min(max(n, lo), hi)
+		}
+		return n
+	}
+	// noteLength reads an optional length, defaulting to the current one
+	noteLength := func() int {
+		if n, ok := number(); ok {
+			return clamp("length", n, 1, 64)
+		}
+		return st.length
+	}
+	// dots reads trailing dots, each extending the note by half again
+	dots := func() float64 {
+		f, add := 1.0, 0.5
+		for i < len(s) && s[i] == '.' {
+			if add >= 1.0/8 {
+				f += add
+			}
+			add /= 2
+			i++
+		}
+		return f
+	}
+	for i < len(s) && len(notes) < maxMMLNotes {
+		at := i
+		c := s[i]
+		i++
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case c == 'T':
+			if n, ok := number(); ok {
+				st.tempo = clamp("tempo", n, 32, 255)
+			} else {
+				problem("T without a value at offset %d", at)
+			}
+		case c == 'O':
+			if n, ok := number(); ok {
+				st.octave = clamp("octave", n, 0, 8)
+			} else {
+				problem("O without a value at offset %d", at)
+			}
+		case c == 'L':
+			if n, ok := number(); ok {
+				st.length = clamp("length", n, 1, 64)
+			} else {
+				problem("L without a value at offset %d", at)
+			}
+		case c == '>':
+			if st.octave < 8 {
+				st.octave++
+			}
+		case c == '<':
+			if st.octave > 0 {
+				st.octave--
+			}
+		case c == 'M':
+			// MF/MB (foreground/background) do not affect timing
+			if i >= len(s) {
+				problem("truncated M command at offset %d", at)
+				continue
+			}
+			switch s[i] {
+			case 'N':
+				st.gate = 7.0 / 8
+			case 'L':
+				st.gate = 1
+			case 'S':
+				st.gate = 3.0 / 4
+			case 'F', 'B':
+			default:
+				// Not an articulation; reparse the next byte on its own
+				problem("unknown M%c command at offset %d", s[i], at)
+				continue
+			}
+			i++
+		case c == 'P' || c == 'R':
+			n := noteLength()
+			notes = append(notes, MMLNote{Rest: true, DurationMs: st.ms(n, dots())})
+		case c == 'N':
+			n, ok := number()
+			if !ok {
+				problem("N without a value at offset %d", at)
+				continue
+			}
+			n = clamp("note number", n, 0, 84)
+			if n == 0 {
+				notes = append(notes, MMLNote{Rest: true, DurationMs: st.ms(st.length, dots())})
+				continue
+			}
+			// N1 is C in octave 0
+			notes = append(notes, st.note(12+n-1, st.length, dots()))
+		case c >= 'A' && c <= 'G':
+			pitch := (st.octave+1)*12 + mmlSemitones[c]
+			if i < len(s) && (s[i] == '#' || s[i] == '+') {
+				pitch++
+				i++
+			} else if i < len(s) && s[i] == '-' {
+				pitch--
+				i++
+			}
+			n := noteLength()
+			notes = append(notes, st.note(pitch, n, dots()))
+		default:
+			problem("skipped %q at offset %d", c, at)
+		}
+	}
+	if i < len(s) {
+		problem("stopped after %d notes", maxMMLNotes)
+	}
+	if problems > 0 {
+		return notes, fmt.Errorf("%d problem(s) in MML, first: %s", problems, first)
+	}
+	return notes, nil
+}
+
+// ms returns the duration of a 1/length note at the current tempo.
+func (st mmlState) ms(length int, dotted float64) int {
+	beat := 60000.0 / float64(st.tempo)
+	return int(math.Round(beat * 4 / float64(length) * dotted))
+}
+
+// note builds a sounding note for a MIDI pitch.
+func (st mmlState) note(pitch, length int, dotted float64) MMLNote {
+	d := st.ms(length, dotted)
+	return MMLNote{
+		Pitch:      pitch,
+		Frequency:  math.Round(440*math.Pow(2, float64(pitch-69)/12)*100) / 100,
+		DurationMs: d,
+		SoundMs:    int(math.Round(float64(d) * st.gate)),
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMMLValid(t *testing.T) {
+	notes, err := ParseMML("T120 O4 L4 C P8 MS E.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []MMLNote{
+		{Pitch: 60, Frequency: 261.63, DurationMs: 500, SoundMs: 438},
+		{Rest: true, DurationMs: 250},
+		{Pitch: 64, Frequency: 329.63, DurationMs: 750, SoundMs: 563},
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("got %+v, want %+v", notes, want)
+	}
+}
+
+// TestParseMMLMalformed checks that broken music yields the same notes as
+// its cleaned-up equivalent, with an error describing the problem.
+func TestParseMMLMalformed(t *testing.T) {
+	tests := []struct {
+		name      string
+		malformed string
+		clean     string
+	}{
+		{"unknown tokens skipped", "C?D!E$", "CDE"},
+		{"binary junk", "\x00\xff\x1b[C", "C"},
+		{"tempo too high", "T999C", "T255C"},
+		{"tempo too low", "T1C", "T32C"},
+		{"huge tempo", "T99999999999C", "T255C"},
+		{"octave too high", "O12C", "O8C"},
+		{"length zero", "L0C", "L1C"},
+		{"length too long", "L99C", "L64C"},
+		{"note length too long", "C99", "C64"},
+		{"rest length zero", "P0C", "P1C"},
+		{"note number too high", "N200", "N84"},
+		{"T without a value", "TCD", "CD"},
+		{"O without a value", "OC", "C"},
+		{"L without a value", "LE", "E"},
+		{"N without a value", "NC", "C"},
+		{"truncated M", "CM", "C"},
+		{"unknown M command", "MXC", "C"},
+	}
+	for _, tt := range tests {
+		got, err := ParseMML(tt.malformed)
+		if err == nil {
+			t.Errorf("%s: no error for %q", tt.name, tt.malformed)
+		}
+		want, werr := ParseMML(tt.clean)
+		if werr != nil {
+			t.Fatalf("%s: clean form %q failed: %v", tt.name, tt.clean, werr)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %q parsed as %+v, want %+v", tt.name, tt.malformed, got, want)
+		}
+	}
+}
+
+func TestParseMMLDotsBounded(t *testing.T) {
+	got, _ := ParseMML("C" + strings.Repeat(".", 1000))
+	want, _ := ParseMML("C...")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMMLNoteLimit(t *testing.T) {
+	notes, err := ParseMML(strings.Repeat("C", maxMMLNotes+100))
+	if len(notes) != maxMMLNotes {
+		t.Errorf("got %d notes, want %d", len(notes), maxMMLNotes)
+	}
+	if err == nil {
+		t.Error("no error for a truncated payload")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+// Telnet negotiation loop breaker. A few misbehaving boards repeat the
+// same request (DO TTYPE, say) forever and never send a screen. Once one
+// request repeats too often within a short window we refuse that option
+// and stop answering it for the rest of the connection.
+
+import (
+	"log"
+	"time"
+)
+
+// negotiationLoopWindow is the span over which repeats are counted.
+const negotiationLoopWindow = 5 * time.Second
+
+// negotiationLoopThreshold is how many identical requests within the window
+// mark a loop (config connection.negotiationLoopThreshold; default 10,
+// negative disables).
+func negotiationLoopThreshold() int {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Connection.NegotiationLoopThreshold == 0 {
+		return 10
+	}
+	return cfg.Connection.NegotiationLoopThreshold
+}
+
+// immediateNegotiation reports whether negotiation replies are written
+// per command (config connection.immediateNegotiation) rather than batched
+// per read. Timing-sensitive boards that blast their login screen while
+// still negotiating may decide our capabilities before a batch arrives.
+func immediateNegotiation() bool {
+	cfg := LoadAppConfig()
+	return cfg != nil && cfg.Connection.ImmediateNegotiation
+}
+
+// negotiationCount tracks repeats of one request.
+type negotiationCount struct {
+	start time.Time
+	n     int
+}
+
+// negotiationLoop records a received request (DO/DONT/WILL/WONT, or SB
+// for subnegotiations) and reports whether it should be ignored. The call
+// that trips the threshold also returns the refusal to send (WONT for DO,
+// DONT for WILL). Called only from the read loop.
+func (c *Client) negotiationLoop(cmd, option byte) (ignore bool, refuse []byte) {
+	const (
+		IAC  = 255
+		DO   = 253
+		WONT = 252
+		WILL = 251
+		DONT = 254
+	)
+	limit := negotiationLoopThreshold()
+	if limit < 0 {
+		return false, nil
+	}
+	key := uint16(cmd)<<8 | uint16(option)
+	if c.negBlocked[option] {
+		return true, nil
+	}
+	if c.negCounts == nil {
+		c.negCounts = make(map[uint16]*negotiationCount)
+	}
+	now := time.Now()
+	nc := c.negCounts[key]
+	if nc == nil || now.Sub(nc.start) > negotiationLoopWindow {
+		nc = &negotiationCount{start: now}
+		c.negCounts[key] = nc
+	}
+	nc.n++
+	if nc.n <= limit {
+		return false, nil
+	}
+	if c.negBlocked == nil {
+		c.negBlocked = make(map[byte]bool)
+	}
+	c.negBlocked[option] = true
+	log.Printf("Telnet: option %d requested %d times in %v; refusing it for this connection", option, nc.n, negotiationLoopWindow)
+	switch cmd {
+	case DO:
+		refuse = []byte{IAC, WONT, option}
+	case WILL:
+		refuse = []byte{IAC, DONT, option}
+	}
+	return true, refuse
+}
+
+// resetNegotiationLoop clears loop state for a new connection.
+func (c *Client) resetNegotiationLoop() {
+	c.negCounts = nil
+	c.negBlocked = nil
+}
@@ -0,0 +1,126 @@
+package main
+
+// Line-ending helpers for boards whose output assumes a terminal that
+// advances the line on a bare carriage return, and for the NUL padding
+// telnet puts after a bare CR.
+
+import "bytes"
+
+// telnetLineEndings applies the line-ending rules for telnet output. In NVT
+// (non-BINARY) mode RFC 854 fixes the meaning: CR LF ends a line, CR NUL is
+// a bare CR, and a CR followed by anything else is taken as a line end. In
+// BINARY mode bytes are untouched unless the board needs bare CRs expanded;
+// a CR held from before BINARY was negotiated still ends its line.
+func telnetLineEndings(data []byte, pendingCR *bool, binary, expandCR bool) []byte {
+	switch {
+	case !binary:
+		return normalizeTelnetNewlines(data, pendingCR)
+	case expandCR:
+		return expandBareCR(data, pendingCR)
+	case *pendingCR && len(data) > 0:
+		*pendingCR = false
+		if data[0] != '\n' && data[0] != 0x00 {
+			return append([]byte{'\n'}, data...)
+		}
+	}
+	return data
+}
+
+// normalizeTelnetNewlines rewrites NVT line endings: CR LF is kept, CR NUL
+// becomes CR, and any other CR becomes CR LF. pendingCR carries a CR that
+// ended the previous chunk.
+func normalizeTelnetNewlines(data []byte, pendingCR *bool) []byte {
+	out := make([]byte, 0, len(data)+8)
+	for _, b := range data {
+		if *pendingCR {
+			*pendingCR = false
+			switch b {
+			case 0x00:
+				continue
+			case '\n':
+			default:
+				out = append(out, '\n')
+			}
+		}
+		out = append(out, b)
+		if b == '\r' {
+			*pendingCR = true
+		}
+	}
+	return out
+}
+
+// NUL policies for terminal.nulPolicy.
+const (
+	nulPolicyDrop  = "drop"  // remove standalone NULs (default)
+	nulPolicyKeep  = "keep"  // pass them to the browser
+	nulPolicySpace = "space" // show them as a space
+)
+
+// nulPolicy returns how NULs outside a telnet CR NUL pair are handled.
+func nulPolicy() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Terminal.NULPolicy != "" {
+		return cfg.Terminal.NULPolicy
+	}
+	return nulPolicyDrop
+}
+
+// stripNUL handles NUL bytes in telnet output. Outside BINARY mode a NUL
+// after CR is the RFC 854 spelling of a bare CR and is always removed; any
+// other NUL follows policy. afterCR carries a CR that ended the previous
+// chunk so a split pair is still recognized.
+func stripNUL(data []byte, afterCR *bool, binary bool, policy string) []byte {
+	if bytes.IndexByte(data, 0x00) == -1 {
+		if len(data) > 0 {
+			*afterCR = data[len(data)-1] == '\r'
+		}
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	prevCR := *afterCR
+	for _, b := range data {
+		if b == 0x00 {
+			switch {
+			case prevCR && !binary, policy == nulPolicyDrop:
+			case policy == nulPolicySpace:
+				out = append(out, ' ')
+			default:
+				out = append(out, b)
+			}
+		} else {
+			out = append(out, b)
+		}
+		prevCR = b == '\r'
+	}
+	*afterCR = prevCR
+	return out
+}
+
+// expandBareCR rewrites CR not followed by LF into CR LF. pendingCR carries a
+// CR that ended the previous chunk so a split CR/LF pair is not doubled. A CR
+// followed by NUL is the telnet spelling of an explicit bare CR and is left
+// alone.
+func expandBareCR(data []byte, pendingCR *bool) []byte {
+	out := make([]byte, 0, len(data)+8)
+	if *pendingCR && len(data) > 0 {
+		*pendingCR = false
+		if data[0] != '\n' && data[0] != 0x00 {
+			out = append(out, '\n')
+		}
+	}
+	for i, b := range data {
+		out = append(out, b)
+		if b != '\r' {
+			continue
+		}
+		if i+1 == len(data) {
+			*pendingCR = true
+			continue
+		}
+		if next := data[i+1]; next != '\n' && next != 0x00 {
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
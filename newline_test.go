@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// feedChunks runs f over each chunk with shared state and joins the output.
+func feedChunks(chunks []string, f func([]byte, *bool) []byte) string {
+	var pendingCR bool
+	var out []byte
+	for _, ch := range chunks {
+		out = append(out, f([]byte(ch), &pendingCR)...)
+	}
+	return string(out)
+}
+
+func TestExpandBareCRStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"bare CR lines", []string{"Main Menu\r[M]essages\r[G]oodbye\r"}, "Main Menu\r\n[M]essages\r\n[G]oodbye\r"},
+		{"CR LF kept", []string{"one\r\ntwo\r\n"}, "one\r\ntwo\r\n"},
+		{"CR NUL left alone", []string{"50%\r\x0075%"}, "50%\r\x0075%"},
+		{"CR split before text", []string{"one\r", "two"}, "one\r\ntwo"},
+		{"CR split before LF", []string{"one\r", "\ntwo"}, "one\r\ntwo"},
+		{"CR split before NUL", []string{"one\r", "\x00two"}, "one\r\x00two"},
+		{"empty chunk keeps pending CR", []string{"one\r", "", "two"}, "one\r\ntwo"},
+	}
+	for _, tt := range tests {
+		if got := feedChunks(tt.chunks, expandBareCR); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStripNUL(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		binary bool
+		policy string
+		want   string
+	}{
+		{"CR NUL in NVT", []string{"50%\r\x0075%"}, false, nulPolicyKeep, "50%\r75%"},
+		{"CR NUL split in NVT", []string{"50%\r", "\x0075%"}, false, nulPolicyKeep, "50%\r75%"},
+		{"CR NUL in BINARY follows policy", []string{"50%\r\x0075%"}, true, nulPolicyKeep, "50%\r\x0075%"},
+		{"CR NUL in BINARY dropped", []string{"50%\r\x0075%"}, true, nulPolicyDrop, "50%\r75%"},
+		{"stray NUL dropped", []string{"a\x00b"}, false, nulPolicyDrop, "ab"},
+		{"stray NUL kept", []string{"a\x00b"}, false, nulPolicyKeep, "a\x00b"},
+		{"stray NUL as space", []string{"a\x00b"}, false, nulPolicySpace, "a b"},
+		{"NUL after a split non-CR", []string{"a", "\x00b"}, false, nulPolicySpace, "a b"},
+		{"NUL run after CR", []string{"x\r\x00\x00y"}, false, nulPolicySpace, "x\r y"},
+	}
+	for _, tt := range tests {
+		var afterCR bool
+		var out []byte
+		for _, ch := range tt.chunks {
+			out = append(out, stripNUL([]byte(ch), &afterCR, tt.binary, tt.policy)...)
+		}
+		if string(out) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, out, tt.want)
+		}
+	}
+}
+
+func TestNULPolicyConfig(t *testing.T) {
+	useConfig(t, &Config{})
+	if got := nulPolicy(); got != nulPolicyDrop {
+		t.Errorf("default policy %q, want %q", got, nulPolicyDrop)
+	}
+	cfg := &Config{}
+	cfg.Terminal.NULPolicy = nulPolicySpace
+	useConfig(t, cfg)
+	if got := nulPolicy(); got != nulPolicySpace {
+		t.Errorf("configured policy %q, want %q", got, nulPolicySpace)
+	}
+}
+
+func TestCRNULThroughReadTelnet(t *testing.T) {
+	cfg := &Config{}
+	cfg.Terminal.NULPolicy = nulPolicyKeep
+	useConfig(t, cfg)
+	for _, tt := range []struct {
+		binary bool
+		want   string
+	}{
+		{false, "50%\r75%"},
+		{true, "50%\r\x0075%"},
+	} {
+		c, remote, data := pipelineClient("UTF-8", selfTestAllFixes, "50%\r", "\x0075%")
+		c.telnetBinaryRX = tt.binary
+		c.readTelnet(remote)
+		if got := strings.Join(*data, ""); got != tt.want {
+			t.Errorf("binary=%v: browser got %q, want %q", tt.binary, got, tt.want)
+		}
+	}
+}
+
+func TestTelnetLineEndings(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		binary   bool
+		expandCR bool
+		want     string
+	}{
+		// NVT (RFC 854): CR LF ends a line, CR NUL is a bare CR, any other
+		// CR is taken as a line end
+		{"NVT CR LF", []string{"one\r\ntwo"}, false, false, "one\r\ntwo"},
+		{"NVT CR NUL", []string{"50%\r\x0075%"}, false, false, "50%\r75%"},
+		{"NVT bare CR", []string{"one\rtwo"}, false, false, "one\r\ntwo"},
+		{"NVT CR LF split", []string{"one\r", "\ntwo"}, false, false, "one\r\ntwo"},
+		{"NVT CR NUL split", []string{"50%\r", "\x0075%"}, false, false, "50%\r75%"},
+		{"NVT bare CR split", []string{"one\r", "two"}, false, false, "one\r\ntwo"},
+		{"NVT CR CR LF", []string{"one\r\r\ntwo"}, false, false, "one\r\n\r\ntwo"},
+		{"NVT LF alone", []string{"one\ntwo"}, false, false, "one\ntwo"},
+		// BINARY: untouched
+		{"BINARY CR LF", []string{"one\r\ntwo"}, true, false, "one\r\ntwo"},
+		{"BINARY CR NUL", []string{"50%\r\x0075%"}, true, false, "50%\r\x0075%"},
+		{"BINARY bare CR", []string{"one\rtwo"}, true, false, "one\rtwo"},
+		{"BINARY bare CR split", []string{"one\r", "two"}, true, false, "one\rtwo"},
+		{"BINARY CR LF split", []string{"one\r", "\ntwo"}, true, false, "one\r\ntwo"},
+		// BINARY with the board's bare-CR quirk
+		{"expandCR CR LF", []string{"one\r\ntwo"}, true, true, "one\r\ntwo"},
+		{"expandCR CR NUL", []string{"50%\r\x0075%"}, true, true, "50%\r\x0075%"},
+		{"expandCR bare CR", []string{"one\rtwo"}, true, true, "one\r\ntwo"},
+		{"expandCR CR LF split", []string{"one\r", "\ntwo"}, true, true, "one\r\ntwo"},
+		{"expandCR bare CR split", []string{"one\r", "two"}, true, true, "one\r\ntwo"},
+		// expandCR only applies in BINARY
+		{"NVT ignores expandCR", []string{"50%\r\x0075%"}, false, true, "50%\r75%"},
+	}
+	for _, tt := range tests {
+		got := feedChunks(tt.chunks, func(b []byte, pendingCR *bool) []byte {
+			return telnetLineEndings(b, pendingCR, tt.binary, tt.expandCR)
+		})
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLineEndingsFollowBinaryNegotiation(t *testing.T) {
+	// WILL BINARY mid-stream switches the rest of the read to raw CRs
+	c, remote, data := pipelineClient("UTF-8", selfTestAllFixes, "a\rb\r", "\xff\xfb\x00c\rd")
+	c.readTelnet(remote)
+	if got, want := strings.Join(*data, ""), "a\r\nb\r\nc\rd"; got != want {
+		t.Errorf("browser got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+// Commodore PETSCII translation. C64/C128 boards drive the screen with
+// single-byte control codes (colors, reverse, cursor moves) rather than ANSI
+// and use their own graphics glyphs; this file rewrites both into ANSI and
+// UTF-8 so xterm.js can render them.
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// petsciiColors maps PETSCII color control codes to ANSI SGR foreground
+// values (closest match from the 16-color palette).
+var petsciiColors = map[byte]int{
+	0x05: 97, // white
+	0x1C: 31, // red
+	0x1E: 32, // green
+	0x1F: 34, // blue
+	0x81: 33, // orange
+	0x90: 30, // black
+	0x95: 33, // brown
+	0x96: 91, // light red
+	0x97: 90, // dark grey
+	0x98: 37, // grey
+	0x99: 92, // light green
+	0x9A: 94, // light blue
+	0x9B: 37, // light grey
+	0x9C: 35, // purple
+	0x9E: 93, // yellow
+	0x9F: 36, // cyan
+}
+
+// petsciiGraphicsUpper holds the uppercase/graphics set glyphs for
+// 0x60-0x7F (mirrored at 0xC0-0xDF). Glyphs without a BMP equivalent use
+// the closest box-drawing or block character.
+var petsciiGraphicsUpper = [32]rune{
+	0x2500, 0x2660, 0x2502, 0x2500, 0x2500, 0x2500, 0x2500, 0x2502,
+	0x2502, 0x256E, 0x2570, 0x256F, 0x2514, 0x2572, 0x2571, 0x250C,
+	0x2510, 0x25CF, 0x2581, 0x2665, 0x258E, 0x256D, 0x2573, 0x25CB,
+	0x2663, 0x2595, 0x2666, 0x253C, 0x2592, 0x2502, 0x03C0, 0x25E5,
+}
+
+// petsciiGraphicsLower holds the lowercase/uppercase set glyphs for
+// 0x60-0x7F (mirrored at 0xC0-0xDF): shifted letters plus a few graphics.
+var petsciiGraphicsLower = [32]rune{
+	0x2500, 'A', 'B', 'C', 'D', 'E', 'F', 'G',
+	'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W',
+	'X', 'Y', 'Z', 0x253C, 0x2592, 0x2502, 0x2592, 0x2592,
+}
+
+// petsciiBlocks holds the block graphics at 0xA0-0xBF (mirrored at
+// 0xE0-0xFF), shared by both character sets.
+var petsciiBlocks = [32]rune{
+	0x00A0, 0x258C, 0x2584, 0x2594, 0x2581, 0x258F, 0x2592, 0x2595,
+	0x2592, 0x25E4, 0x2590, 0x251C, 0x2597, 0x2514, 0x2510, 0x2582,
+	0x250C, 0x2534, 0x252C, 0x2524, 0x258E, 0x258D, 0x2590, 0x2594,
+	0x2580, 0x2583, 0x2518, 0x2596, 0x259D, 0x2518, 0x2598, 0x259A,
+}
+
+// petsciiToUnicodeUpper and petsciiToUnicodeLower map printable PETSCII
+// bytes to Unicode for the two Commodore character sets. Zero entries are
+// control codes handled by translatePETSCIIToANSI.
+var (
+	petsciiToUnicodeUpper [256]rune
+	petsciiToUnicodeLower [256]rune
+)
+
+func init() {
+	for b := 0x20; b < 0x40; b++ {
+		petsciiToUnicodeUpper[b] = rune(b)
+		petsciiToUnicodeLower[b] = rune(b)
+	}
+	petsciiToUnicodeUpper[0x40] = '@'
+	petsciiToUnicodeLower[0x40] = '@'
+	for b := 0x41; b <= 0x5A; b++ {
+		petsciiToUnicodeUpper[b] = rune(b)
+		petsciiToUnicodeLower[b] = rune(b + 0x20)
+	}
+	for b, r := range map[int]rune{0x5B: '[', 0x5C: 0x00A3, 0x5D: ']', 0x5E: 0x2191, 0x5F: 0x2190} {
+		petsciiToUnicodeUpper[b] = r
+		petsciiToUnicodeLower[b] = r
+	}
+	for i := 0; i < 32; i++ {
+		petsciiToUnicodeUpper[0x60+i] = petsciiGraphicsUpper[i]
+		petsciiToUnicodeUpper[0xC0+i] = petsciiGraphicsUpper[i]
+		petsciiToUnicodeLower[0x60+i] = petsciiGraphicsLower[i]
+		petsciiToUnicodeLower[0xC0+i] = petsciiGraphicsLower[i]
+		petsciiToUnicodeUpper[0xA0+i] = petsciiBlocks[i]
+		petsciiToUnicodeUpper[0xE0+i] = petsciiBlocks[i]
+		petsciiToUnicodeLower[0xA0+i] = petsciiBlocks[i]
+		petsciiToUnicodeLower[0xE0+i] = petsciiBlocks[i]
+	}
+	// The lowercase set swaps a couple of block glyphs for a checkmark and fill
+	petsciiToUnicodeLower[0xA9] = 0x2592
+	petsciiToUnicodeLower[0xE9] = 0x2592
+	petsciiToUnicodeLower[0xBA] = 0x2713
+	petsciiToUnicodeLower[0xFA] = 0x2713
+	// 0xFF is the PI glyph in the uppercase set
+	petsciiToUnicodeUpper[0xFF] = 0x03C0
+	petsciiToUnicodeLower[0xFF] = 0x2592
+}
+
+// petsciiState tracks the C64 screen editor state that outlives a single
+// byte: reverse and color compose (a color change keeps reverse on), and
+// RETURN implicitly turns reverse off.
+type petsciiState struct {
+	reverse   bool   // RVS ON (0x12) active
+	color     int    // current ANSI foreground, 0 if never set
+	lowercase bool   // lowercase/uppercase set selected (0x0E)
+	lastCR    bool   // previous byte was CR; swallow a following LF
+	charset   string // charset the state was initialized for
+}
+
+// isPETSCIICharset reports whether the charset selects PETSCII translation.
+func isPETSCIICharset(charset string) bool {
+	return charset == "PETSCIIU" || charset == "PETSCIIL"
+}
+
+// sgr renders the current reverse+color state as a single SGR sequence so
+// the two attributes can never drift apart in the browser terminal.
+func (s *petsciiState) sgr() []byte {
+	out := []byte{0x1B, '['}
+	if s.reverse {
+		out = append(out, '7')
+	} else {
+		out = append(out, '2', '7')
+	}
+	if s.color != 0 {
+		out = append(out, ';')
+		out = strconv.AppendInt(out, int64(s.color), 10)
+	}
+	return append(out, 'm')
+}
+
+// translatePETSCIIToANSI rewrites PETSCII control codes in data to ANSI and
+// printable bytes to UTF-8 using the active character set, keeping
+// reverse/color/set state across calls. The output needs no further ANSI
+// normalization or charset conversion.
+func (c *Client) translatePETSCIIToANSI(data []byte) []byte {
+	s := &c.petscii
+	if charset := c.sessionCharset(); s.charset != charset {
+		// New session or charset switch: start from power-on state
+		*s = petsciiState{charset: charset, lowercase: charset == "PETSCIIL"}
+	}
+	out := make([]byte, 0, len(data)*3)
+	for _, b := range data {
+		prevCR := s.lastCR
+		s.lastCR = false
+		if fg, ok := petsciiColors[b]; ok {
+			s.color = fg
+			out = append(out, s.sgr()...)
+			continue
+		}
+		switch b {
+		case 0x0D, 0x8D: // RETURN / shifted RETURN: newline, reverse off
+			out = append(out, '\r', '\n')
+			if s.reverse {
+				s.reverse = false
+				out = append(out, s.sgr()...)
+			}
+			s.lastCR = true
+		case 0x0A:
+			// Boards that send CR LF would otherwise double-space
+			if !prevCR {
+				out = append(out, '\n')
+			}
+		case 0x12: // RVS ON
+			s.reverse = true
+			out = append(out, s.sgr()...)
+		case 0x92: // RVS OFF
+			s.reverse = false
+			out = append(out, s.sgr()...)
+		case 0x13: // HOME
+			out = append(out, 0x1B, '[', 'H')
+		case 0x93: // CLR
+			out = append(out, 0x1B, '[', '2', 'J', 0x1B, '[', 'H')
+		case 0x11: // cursor down
+			out = append(out, 0x1B, '[', 'B')
+		case 0x91: // cursor up
+			out = append(out, 0x1B, '[', 'A')
+		case 0x1D: // cursor right
+			out = append(out, 0x1B, '[', 'C')
+		case 0x9D: // cursor left
+			out = append(out, 0x1B, '[', 'D')
+		case 0x14: // DEL: destructive backspace
+			out = append(out, 0x08, 0x1B, '[', 'P')
+		case 0x94: // INST: insert a blank at the cursor
+			out = append(out, 0x1B, '[', '@')
+		case 0x0E: // switch to lowercase/uppercase set
+			s.lowercase = true
+		case 0x8E: // switch to uppercase/graphics set
+			s.lowercase = false
+		case 0x07: // bell
+			out = append(out, b)
+		default:
+			glyphs := &petsciiToUnicodeUpper
+			if s.lowercase {
+				glyphs = &petsciiToUnicodeLower
+			}
+			if r := glyphs[b]; r != 0 {
+				out = utf8.AppendRune(out, r)
+			}
+			// Remaining control codes have no terminal equivalent
+		}
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+package main
+
+import "testing"
+
+func TestPETSCIIColorThenReverse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"red then reverse", []byte{0x1C, 'A', 0x12, 'B'}, "\x1b[27;31mA\x1b[7;31mB"},
+		{"color change keeps reverse", []byte{0x12, 0x1C, 'A', 0x1E, 'B'}, "\x1b[7m\x1b[7;31mA\x1b[7;32mB"},
+		{"reverse off keeps color", []byte{0x1C, 0x12, 'A', 0x92, 'B'}, "\x1b[27;31m\x1b[7;31mA\x1b[27;31mB"},
+		{"RETURN ends reverse", []byte{0x9E, 0x12, 'A', 0x0D, 'B'}, "\x1b[27;93m\x1b[7;93mA\r\n\x1b[27;93mB"},
+	}
+	for _, tt := range tests {
+		c := &Client{charset: "PETSCIIU"}
+		if got := string(c.translatePETSCIIToANSI(tt.in)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPETSCIIStateAcrossCalls(t *testing.T) {
+	c := &Client{charset: "PETSCIIU"}
+	c.translatePETSCIIToANSI([]byte{0x1C, 0x12})
+	if got, want := string(c.translatePETSCIIToANSI([]byte{0x1F, 'X'})), "\x1b[7;34mX"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPETSCIIGlyphTables(t *testing.T) {
+	tests := []struct {
+		charset string
+		in      byte
+		want    rune
+	}{
+		{"PETSCIIU", 'A', 'A'},
+		{"PETSCIIL", 'A', 'a'},
+		{"PETSCIIU", 0x5C, '£'},
+		{"PETSCIIU", 0x5E, '↑'},
+		{"PETSCIIU", 0x61, '♠'},
+		{"PETSCIIU", 0x73, '♥'},
+		{"PETSCIIU", 0x78, '♣'},
+		{"PETSCIIU", 0x7A, '♦'},
+		{"PETSCIIU", 0x71, '●'},
+		{"PETSCIIU", 0xC1, '♠'}, // 0xC0-0xDF mirror 0x60-0x7F
+		{"PETSCIIL", 0x61, 'A'},
+		{"PETSCIIL", 0xDA, 'Z'},
+		{"PETSCIIU", 0xA0, ' '},
+		{"PETSCIIU", 0xA1, '▌'},
+		{"PETSCIIU", 0xE2, '▄'}, // 0xE0-0xFF mirror 0xA0-0xBF
+		{"PETSCIIL", 0xBA, '✓'},
+		{"PETSCIIU", 0xFF, 'π'},
+	}
+	for _, tt := range tests {
+		c := &Client{charset: tt.charset}
+		if got := string(c.translatePETSCIIToANSI([]byte{tt.in})); got != string(tt.want) {
+			t.Errorf("%s 0x%02X: got %q, want %q", tt.charset, tt.in, got, string(tt.want))
+		}
+	}
+	// Every printable byte maps to a glyph in both sets
+	for b := 0x20; b < 0x100; b++ {
+		if b >= 0x80 && b < 0xA0 {
+			continue
+		}
+		if petsciiToUnicodeUpper[b] == 0 || petsciiToUnicodeLower[b] == 0 {
+			t.Errorf("0x%02X has no glyph", b)
+		}
+	}
+}
+
+func TestPETSCIISetSwitch(t *testing.T) {
+	c := &Client{charset: "PETSCIIU"}
+	if got, want := string(c.translatePETSCIIToANSI([]byte{'A', 0x0E, 'A', 0x8E, 'A'})), "AaA"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// petsciiClient returns a session with a PETSCII charset selected.
+func petsciiClient(charset string) *Client {
+	return &Client{charset: charset}
+}
+
+func TestTranslatePETSCIIToANSI(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		in      []byte
+		want    string
+	}{
+		// Color codes to SGR
+		{"white", "PETSCIIU", []byte{0x05}, "\x1b[27;97m"},
+		{"red", "PETSCIIU", []byte{0x1C}, "\x1b[27;31m"},
+		{"black", "PETSCIIU", []byte{0x90}, "\x1b[27;30m"},
+		{"light blue", "PETSCIIU", []byte{0x9A}, "\x1b[27;94m"},
+		{"cyan", "PETSCIIU", []byte{0x9F}, "\x1b[27;36m"},
+		// Cursor moves
+		{"cursor down", "PETSCIIU", []byte{0x11}, "\x1b[B"},
+		{"cursor up", "PETSCIIU", []byte{0x91}, "\x1b[A"},
+		{"cursor right", "PETSCIIU", []byte{0x1D}, "\x1b[C"},
+		{"cursor left", "PETSCIIU", []byte{0x9D}, "\x1b[D"},
+		{"delete", "PETSCIIU", []byte{0x14}, "\x08\x1b[P"},
+		{"insert", "PETSCIIU", []byte{0x94}, "\x1b[@"},
+		// Clear and home
+		{"home", "PETSCIIU", []byte{0x13}, "\x1b[H"},
+		{"clear", "PETSCIIU", []byte{0x93}, "\x1b[2J\x1b[H"},
+		// Reverse on/off
+		{"reverse on", "PETSCIIU", []byte{0x12, 'A'}, "\x1b[7mA"},
+		{"reverse off", "PETSCIIU", []byte{0x12, 'A', 0x92, 'B'}, "\x1b[7mA\x1b[27mB"},
+		// RETURN and line feeds
+		{"RETURN", "PETSCIIU", []byte{'A', 0x0D, 'B'}, "A\r\nB"},
+		{"shifted RETURN", "PETSCIIU", []byte{'A', 0x8D, 'B'}, "A\r\nB"},
+		{"CR LF collapses", "PETSCIIU", []byte{'A', 0x0D, 0x0A, 'B'}, "A\r\nB"},
+		{"consecutive CRs", "PETSCIIU", []byte{0x0D, 0x0D, 0x0A}, "\r\n\r\n"},
+		{"bare LF", "PETSCIIU", []byte{'A', 0x0A, 'B'}, "A\nB"},
+		{"RETURN ends reverse", "PETSCIIU", []byte{0x12, 0x0D}, "\x1b[7m\r\n\x1b[27m"},
+		// Character set switch
+		{"shift to lowercase", "PETSCIIU", []byte{'A', 0x0E, 'A', 0x61}, "AaA"},
+		{"shift to uppercase", "PETSCIIL", []byte{'A', 0x8E, 'A', 0x61}, "aA♠"},
+		// Bell passes through; unmapped controls are dropped
+		{"bell", "PETSCIIU", []byte{0x07}, "\x07"},
+		{"unmapped control", "PETSCIIU", []byte{'A', 0x01, 0x82, 'B'}, "AB"},
+	}
+	for _, tt := range tests {
+		if got := string(petsciiClient(tt.charset).translatePETSCIIToANSI(tt.in)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPETSCIIStateResetOnCharsetChange(t *testing.T) {
+	c := petsciiClient("PETSCIIU")
+	c.translatePETSCIIToANSI([]byte{0x12, 0x1C})
+	c.setCharsetLocked("PETSCIIL", charsetSourceUser)
+	// Power-on state for the new set: no reverse, no color, lowercase
+	if got, want := string(c.translatePETSCIIToANSI([]byte{'A', 0x92})), "a\x1b[27m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/base64"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedRemote is a RemoteConn that returns one scripted read per call
+// and records what the session writes back. Once the script is used up it
+// calls done, which should detach it so readTelnet returns without a
+// teardown.
+type scriptedRemote struct {
+	mu      sync.Mutex
+	reads   [][]byte
+	written []byte
+	done    func()
+}
+
+func (s *scriptedRemote) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.reads) == 0 {
+		s.done()
+		return 0, nil
+	}
+	n := copy(p, s.reads[0])
+	s.reads = s.reads[1:]
+	return n, nil
+}
+
+func (s *scriptedRemote) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, p...)
+	return len(p), nil
+}
+
+func (s *scriptedRemote) Close() error                    { return nil }
+func (s *scriptedRemote) SetReadDeadline(time.Time) error { return nil }
+func (s *scriptedRemote) Protocol() string                { return "telnet" }
+func (s *scriptedRemote) Address() string                 { return "scripted:23" }
+
+// scriptMsg is a "data" (decoded) or "music" message seen by the browser.
+type scriptMsg struct {
+	typ, payload string
+}
+
+// runScript drives a fresh CP437 session with every ANSI fix and ANSI
+// music on through readTelnet, returning the browser messages in order
+// and what the session sent to the board.
+func runScript(reads ...string) ([]scriptMsg, string) {
+	var msgs []scriptMsg
+	c := &Client{
+		charset:      "CP437",
+		ansiEnhanced: NewANSIEnhancedProcessor(false, selfTestAllFixes),
+		termCols:     80,
+		termRows:     25,
+		modes:        defaultTerminalModes(),
+	}
+	c.sink = func(msg Message) {
+		switch msg.Type {
+		case "data":
+			data, _ := base64.StdEncoding.DecodeString(msg.Data)
+			msgs = append(msgs, scriptMsg{"data", string(data)})
+		case "music":
+			msgs = append(msgs, scriptMsg{"music", msg.Message})
+		}
+	}
+	c.music = NewAnsiMusicProcessor(func(payload string) {
+		c.sendJSON(musicMessage(payload, musicFormatRaw))
+	})
+	remote := &scriptedRemote{}
+	for _, r := range reads {
+		remote.reads = append(remote.reads, []byte(r))
+	}
+	remote.done = func() {
+		c.mu.Lock()
+		c.telnet = nil
+		c.mu.Unlock()
+	}
+	c.telnet = remote
+	c.readTelnet(remote)
+	return msgs, string(remote.written)
+}
+
+// TestReadTelnetScripted drives readTelnet over a scripted RemoteConn with
+// input split in the places a real board's reads tend to split it. Music
+// found in a read is sent before that read's data.
+func TestReadTelnetScripted(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+		want  []scriptMsg
+		sent  string
+	}{
+		{
+			"negotiation, art, CP437, music and a split sequence",
+			[]string{
+				"\xff\xfd\x18\x1b[2J\x1b[1;31mHi",
+				"\xc9\xcd\xbb\r\n\x1b[MFT120L8CDE\x0e",
+				"ok\x1b[3",
+				"2mX\r\n",
+			},
+			[]scriptMsg{
+				{"data", "\x1b[2J\x1b[H\x1b[1;31mHi"},
+				{"music", "FT120L8CDE"},
+				{"data", "╔═╗\r\n"},
+				{"data", "ok"},
+				{"data", "\x1b[32mX\r\n"},
+			},
+			"\xff\xfb\x18",
+		},
+		{
+			"plain text",
+			[]string{"Hello\r\n"},
+			[]scriptMsg{{"data", "Hello\r\n"}},
+			"",
+		},
+		{
+			"command split across reads",
+			[]string{"A\xff", "\xfd\x18B"},
+			[]scriptMsg{{"data", "A"}, {"data", "B"}},
+			"\xff\xfb\x18",
+		},
+		{
+			"escaped IAC is data",
+			[]string{"\xff\xff"},
+			[]scriptMsg{{"data", "\u00a0"}},
+			"",
+		},
+		{
+			"subnegotiation split across reads",
+			[]string{"X\xff\xfa\x18", "\x01\xff", "\xf0Y"},
+			[]scriptMsg{{"data", "X"}, {"data", "Y"}},
+			"\xff\xfa\x18\x00ansi\xff\xf0",
+		},
+		{
+			"CP437 split from its sequence",
+			[]string{"\x1b[1", ";34m\xb0\xb1\xb2"},
+			[]scriptMsg{{"data", "\x1b[1;34m░▒▓"}},
+			"",
+		},
+		{
+			"read with only negotiation",
+			[]string{"\xff\xfb\x01", "ok"},
+			[]scriptMsg{{"data", "ok"}},
+			"\xff\xfe\x01",
+		},
+	}
+	for _, tt := range tests {
+		got, sent := runScript(tt.reads...)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: messages %q, want %q", tt.name, got, tt.want)
+		}
+		if sent != tt.sent {
+			t.Errorf("%s: sent %q, want %q", tt.name, sent, tt.sent)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+// Connection profiles bundle the terminal settings a family of boards needs
+// (charset, ANSI fixes, screen size, CPR policy, newline handling) under a
+// name, so bbs.csv can say "Profile=Mystic-UTF8-iCE" instead of repeating
+// each quirk per row.
+
+import (
+	"log"
+	"strings"
+)
+
+// ConnectionProfile is a named set of per-session terminal settings. Zero
+// fields leave the session default in place.
+type ConnectionProfile struct {
+	Charset string              `json:"charset,omitempty"`
+	ANSI    *ProfileANSIOptions `json:"ansi,omitempty"`
+	Cols    int                 `json:"cols,omitempty"`
+	Rows    int                 `json:"rows,omitempty"`
+	// AnswerCPR replies to cursor position requests for boards that wait
+	// on them during terminal detection
+	AnswerCPR bool `json:"answerCPR,omitempty"`
+	// ExpandCR turns bare CR into CR LF in telnet BINARY mode (see
+	// BBSEntry.ExpandCR)
+	ExpandCR bool `json:"expandCR,omitempty"`
+}
+
+// ProfileANSIOptions overrides individual ANSI fixes (see ANSIOptions);
+// omitted fields keep the session default.
+type ProfileANSIOptions struct {
+	Enabled       *bool `json:"enabled,omitempty"`
+	FormFeedClear *bool `json:"formFeedClear,omitempty"`
+	HomeOnClear   *bool `json:"homeOnClear,omitempty"`
+	EraseDefault  *bool `json:"eraseDefault,omitempty"`
+	NormalizeC1   *bool `json:"normalizeC1,omitempty"`
+	ICEColors     *bool `json:"iceColors,omitempty"`
+}
+
+// apply returns opts with the fields set in o replaced.
+func (o *ProfileANSIOptions) apply(opts ANSIOptions) ANSIOptions {
+	if o == nil {
+		return opts
+	}
+	for _, f := range []struct {
+		set *bool
+		dst *bool
+	}{
+		{o.Enabled, &opts.Enabled},
+		{o.FormFeedClear, &opts.FormFeedClear},
+		{o.HomeOnClear, &opts.HomeOnClear},
+		{o.EraseDefault, &opts.EraseDefault},
+		{o.NormalizeC1, &opts.NormalizeC1},
+		{o.ICEColors, &opts.ICEColors},
+	} {
+		if f.set != nil {
+			*f.dst = *f.set
+		}
+	}
+	return opts
+}
+
+// optBool returns a pointer to b for optional fields.
+func optBool(b bool) *bool { return &b }
+
+// builtinProfiles are available without any config; entries in
+// config.json "profiles" with the same name replace them.
+var builtinProfiles = map[string]ConnectionProfile{
+	"PCBoard-CP437-80x25": {
+		Charset: "CP437",
+		Cols:    80,
+		Rows:    25,
+	},
+	"Mystic-UTF8-iCE": {
+		Charset: "UTF-8",
+		ANSI: &ProfileANSIOptions{
+			Enabled:     optBool(true),
+			NormalizeC1: optBool(false), // C1 bytes are UTF-8 continuation bytes here
+			ICEColors:   optBool(true),
+		},
+		Cols: 80,
+		Rows: 25,
+	},
+	"Synchronet-CP437-CPR": {
+		Charset:   "CP437",
+		Cols:      80,
+		Rows:      25,
+		AnswerCPR: true,
+	},
+	"C64-PETSCII-40x25": {
+		Charset: "PETSCIIU",
+		Cols:    40,
+		Rows:    25,
+	},
+	"ASCII-ExpandCR": {
+		ExpandCR: true,
+	},
+}
+
+// lookupProfile finds a profile by name, case-insensitively, preferring
+// config.json profiles over the built-ins.
+func lookupProfile(name string) (ConnectionProfile, bool) {
+	cfg := LoadAppConfig()
+	if name == "" {
+		return ConnectionProfile{}, false
+	}
+	if cfg != nil {
+		for n, p := range cfg.Profiles {
+			if strings.EqualFold(n, name) {
+				return p, true
+			}
+		}
+	}
+	for n, p := range builtinProfiles {
+		if strings.EqualFold(n, name) {
+			return p, true
+		}
+	}
+	return ConnectionProfile{}, false
+}
+
+// applyProfile resets the session's terminal settings to the protocol
+// defaults and applies the board's profile, if any. Settings on the entry
+// itself win over the profile, so it is called before the entry's own
+// encoding is applied. Returns the entry with profile defaults merged in.
+func (c *Client) applyProfile(bbs BBSInfo) BBSInfo {
+	proto := protocolDefaults(bbs.Protocol)
+	opts := DefaultANSIOptions()
+	if proto.ANSINormalize != nil {
+		opts.Enabled = *proto.ANSINormalize
+	}
+	p, ok := lookupProfile(bbs.Profile)
+	if bbs.Profile != "" && !ok {
+		log.Printf("Unknown connection profile %q for %s; using defaults", bbs.Profile, bbs.ID)
+	}
+	opts = p.ANSI.apply(opts)
+	if c.ansiEnhanced != nil {
+		c.ansiEnhanced.SetOptions(opts)
+	}
+	if !bbs.ExpandCR {
+		bbs.ExpandCR = p.ExpandCR
+	}
+
+	c.mu.Lock()
+	charset := proto.Charset
+	if p.Charset != "" {
+		charset = p.Charset
+	}
+	if id := normalizeCharset(charset); id != "" {
+		charset = id
+	} else {
+		log.Printf("Profile %q: unsupported charset %q, using CP437", bbs.Profile, charset)
+		charset = "CP437"
+	}
+	charsetChanged := c.setCharsetLocked(charset, charsetSourceConfigured)
+	c.answerCPR = p.AnswerCPR || bbs.RequiresCPR
+	resize := p.Cols > 0 && p.Rows > 0
+	if resize {
+		c.termCols = p.Cols
+		c.termRows = p.Rows
+		c.screen.Resize(p.Cols, p.Rows)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		log.Printf("Applying connection profile %q to %s", bbs.Profile, bbs.ID)
+	}
+	if resize {
+		c.sendJSON(Message{Type: "terminalSize", Cols: p.Cols, Rows: p.Rows})
+	}
+	if charsetChanged {
+		c.reportCharset()
+	}
+	return bbs
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestProfileANSIMergesOverDefaults(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{
+		"protocolDefaults": {"telnet": {"ansiNormalize": false}},
+		"profiles": {
+			"ice": {"ansi": {"iceColors": true}},
+			"no-ff": {"ansi": {"enabled": true, "formFeedClear": false}}
+		}
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useConfig(t, &cfg)
+
+	withDefaults := func(change func(*ANSIOptions)) ANSIOptions {
+		o := DefaultANSIOptions()
+		change(&o)
+		return o
+	}
+	tests := []struct {
+		profile, protocol string
+		want              ANSIOptions
+	}{
+		{"ice", "ssh", withDefaults(func(o *ANSIOptions) { o.ICEColors = true })},
+		// The protocol's ansiNormalize survives a profile that leaves it unset
+		{"ice", "telnet", withDefaults(func(o *ANSIOptions) { o.ICEColors, o.Enabled = true, false })},
+		{"no-ff", "telnet", withDefaults(func(o *ANSIOptions) { o.Enabled, o.FormFeedClear = true, false })},
+		{"Mystic-UTF8-iCE", "ssh", withDefaults(func(o *ANSIOptions) {
+			o.Enabled, o.NormalizeC1, o.ICEColors = true, false, true
+		})},
+		{"", "ssh", DefaultANSIOptions()},
+	}
+	for _, tt := range tests {
+		c := charsetTestClient()
+		c.applyProfile(BBSInfo{ID: "board", Protocol: tt.protocol, Profile: tt.profile})
+		if got := c.ansiEnhanced.Options(); got != tt.want {
+			t.Errorf("profile %q over %s: got %+v, want %+v", tt.profile, tt.protocol, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strings"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -13,27 +14,26 @@ import (
 // on configuration. When type is "tor", timeouts are extended to accommodate
 // typical Tor circuit setup delays.
 func CreateProxyDialer() (proxy.Dialer, error) {
-	if AppConfig == nil || !AppConfig.Proxy.Enabled {
+	cfg := LoadAppConfig()
+	if cfg == nil || !cfg.Proxy.Enabled {
 		// No proxy, use direct connection
-		return &net.Dialer{
-			Timeout: 10 * time.Second,
-		}, nil
+		return directDialer(), nil
 	}
 
 	// Create SOCKS5 proxy dialer
-	proxyAddr := fmt.Sprintf("%s:%d", AppConfig.Proxy.Host, AppConfig.Proxy.Port)
+	proxyAddr := fmt.Sprintf("%s:%d", cfg.Proxy.Host, cfg.Proxy.Port)
 
 	var auth *proxy.Auth
-	if AppConfig.Proxy.Username != "" {
+	if cfg.Proxy.Username != "" {
 		auth = &proxy.Auth{
-			User:     AppConfig.Proxy.Username,
-			Password: AppConfig.Proxy.Password,
+			User:     cfg.Proxy.Username,
+			Password: cfg.Proxy.Password,
 		}
 	}
 
 	// Increase timeout for Tor connections (they're slower)
 	timeout := 10 * time.Second
-	if AppConfig.Proxy.Type == "tor" {
+	if cfg.Proxy.Type == "tor" {
 		timeout = 30 * time.Second
 		log.Printf("PROXY: Using Tor SOCKS5 proxy at %s (extended timeout)", proxyAddr)
 	}
@@ -46,22 +46,135 @@ func CreateProxyDialer() (proxy.Dialer, error) {
 		return nil, fmt.Errorf("failed to create SOCKS5 dialer: %v", err)
 	}
 
-	if AppConfig.Proxy.Type != "tor" {
+	if cfg.Proxy.Type != "tor" {
 		log.Printf("PROXY: Using SOCKS5 proxy at %s", proxyAddr)
 	}
 	return dialer, nil
 }
 
+// directDialer dials boards directly, from config connection.bindAddress
+// when set so board traffic leaves by a chosen interface or VPN. Proxied
+// connections ignore it; the proxy picks its own egress.
+func directDialer() *net.Dialer {
+	cfg := LoadAppConfig()
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	if cfg != nil && cfg.Connection.BindAddress != "" {
+		if ip := net.ParseIP(cfg.Connection.BindAddress); ip != nil {
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+	return d
+}
+
+// checkBindAddress verifies that addr is an IP this host can bind.
+func checkBindAddress(addr string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("%q is not an IP address", addr)
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return fmt.Errorf("%s is not a local address: %v", addr, err)
+	}
+	l.Close()
+	return nil
+}
+
+// NamedProxy is an entry in config.json "proxies" that users can select
+// per connection with the "setProxy" WebSocket message.
+type NamedProxy struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // "socks5" or "tor"
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// proxyDirect selects a direct connection regardless of the global proxy.
+const proxyDirect = "direct"
+
+// findNamedProxy looks up a configured proxy by name (case-insensitive).
+func findNamedProxy(name string) (NamedProxy, bool) {
+	cfg := LoadAppConfig()
+	if cfg == nil {
+		return NamedProxy{}, false
+	}
+	for _, p := range cfg.Proxies {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return NamedProxy{}, false
+}
+
+// validProxyName reports whether name can be passed to DialVia: empty
+// (server default), "direct", or a configured proxy.
+func validProxyName(name string) bool {
+	if name == "" || strings.EqualFold(name, proxyDirect) {
+		return true
+	}
+	_, ok := findNamedProxy(name)
+	return ok
+}
+
+// proxyNames lists the selectable proxies, "direct" first.
+func proxyNames() []string {
+	cfg := LoadAppConfig()
+	names := []string{proxyDirect}
+	if cfg != nil {
+		for _, p := range cfg.Proxies {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// DialVia connects through the named proxy; an empty name uses the
+// server-wide proxy setting (DialWithProxy).
+func DialVia(proxyName, network, address string) (net.Conn, error) {
+	if proxyName == "" {
+		return DialWithProxy(network, address)
+	}
+	if strings.EqualFold(proxyName, proxyDirect) {
+		return directDialer().Dial(network, address)
+	}
+	p, ok := findNamedProxy(proxyName)
+	if !ok {
+		return nil, fmt.Errorf("unknown proxy %q", proxyName)
+	}
+	var auth *proxy.Auth
+	if p.Username != "" {
+		auth = &proxy.Auth{User: p.Username, Password: p.Password}
+	}
+	timeout := 10 * time.Second
+	if p.Type == "tor" {
+		timeout = 30 * time.Second
+	}
+	proxyAddr := fmt.Sprintf("%s:%d", p.Host, p.Port)
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, &net.Dialer{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOCKS5 dialer: %v", err)
+	}
+	log.Printf("PROXY: Connecting to %s via %q (%s)", address, p.Name, proxyAddr)
+	conn, err := dialer.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("proxy dial failed: %v", err)
+	}
+	return conn, nil
+}
+
 // DialWithProxy establishes a network connection, routing through a SOCKS5
 // proxy if enabled in the config. Errors are wrapped with context.
 func DialWithProxy(network, address string) (net.Conn, error) {
+	cfg := LoadAppConfig()
 	dialer, err := CreateProxyDialer()
 	if err != nil {
 		return nil, err
 	}
 
-	if AppConfig != nil && AppConfig.Proxy.Enabled {
-		log.Printf("PROXY: Connecting to %s via proxy %s:%d", address, AppConfig.Proxy.Host, AppConfig.Proxy.Port)
+	if cfg != nil && cfg.Proxy.Enabled {
+		log.Printf("PROXY: Connecting to %s via proxy %s:%d", address, cfg.Proxy.Host, cfg.Proxy.Port)
 	}
 
 	conn, err := dialer.Dial(network, address)
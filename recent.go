@@ -0,0 +1,102 @@
+package main
+
+// Recently connected boards, kept per client (keyed by the same client
+// token as favorites) so users can jump back in. Never shared across
+// clients and bounded to the last few boards.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// RecentConnection is one entry of a client's connection history.
+type RecentConnection struct {
+	BoardID  string    `json:"boardId,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Address  string    `json:"address"`
+	Protocol string    `json:"protocol"`
+	Time     time.Time `json:"time"`
+}
+
+// recentStore holds each client's history, newest first.
+var recentStore = &clientStore[[]RecentConnection]{defaultPath: recentPath}
+
+// recentPath returns the history file (default "recent.json").
+func recentPath() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Recent.Path != "" {
+		return cfg.Recent.Path
+	}
+	return "recent.json"
+}
+
+// recentLimit is how many boards each client's history keeps (default 10;
+// negative disables history).
+func recentLimit() int {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Recent.Max == 0 {
+		return 10
+	}
+	return cfg.Recent.Max
+}
+
+// recordRecentLocked adds the current remote to the client's history,
+// replacing an older entry for the same board; the caller holds c.mu.
+func (c *Client) recordRecentLocked() {
+	limit := recentLimit()
+	if c.clientToken == "" || limit < 0 {
+		return
+	}
+	entry := RecentConnection{
+		BoardID:  c.board.ID,
+		Name:     c.board.Name,
+		Address:  c.remoteAddr,
+		Protocol: c.remoteProtocol,
+		Time:     time.Now().UTC(),
+	}
+	_, err := recentStore.update(c.clientToken, func(cur []RecentConnection) []RecentConnection {
+		out := []RecentConnection{entry}
+		for _, r := range cur {
+			if len(out) >= limit {
+				break
+			}
+			if r.Address == entry.Address && r.BoardID == entry.BoardID {
+				continue
+			}
+			out = append(out, r)
+		}
+		return out
+	})
+	if err != nil {
+		log.Printf("Recent connections: %v", err)
+	}
+}
+
+// handleRecent returns (GET) or clears (DELETE) the caller's history.
+func handleRecent(w http.ResponseWriter, r *http.Request) {
+	token := clientToken(w, r, false)
+	switch r.Method {
+	case http.MethodGet:
+		list := []RecentConnection{}
+		if token != "" {
+			if got, err := recentStore.get(token); err == nil && got != nil {
+				list = got
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case http.MethodDelete:
+		if token != "" {
+			if _, err := recentStore.update(token, func([]RecentConnection) []RecentConnection { return nil }); err != nil {
+				http.Error(w, "Could not clear history", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+// RemoteConn abstracts the byte stream to a remote board so the read and
+// write paths can be driven by a scripted fake instead of a real socket.
+
+import (
+	"net"
+	"time"
+)
+
+// RemoteConn is the minimal surface the session needs from a remote
+// connection: a byte stream with a read deadline plus descriptive metadata.
+type RemoteConn interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+	SetReadDeadline(t time.Time) error
+	// Protocol reports the transport, e.g. "telnet".
+	Protocol() string
+	// Address reports the dialed host:port.
+	Address() string
+}
+
+// netRemoteConn adapts a dialed net.Conn to RemoteConn.
+type netRemoteConn struct {
+	net.Conn
+	protocol string
+	address  string
+}
+
+// NewNetRemoteConn wraps conn as a RemoteConn for the given protocol and
+// dialed address.
+func NewNetRemoteConn(conn net.Conn, protocol, address string) RemoteConn {
+	return &netRemoteConn{Conn: conn, protocol: protocol, address: address}
+}
+
+func (n *netRemoteConn) Protocol() string { return n.protocol }
+
+func (n *netRemoteConn) Address() string { return n.address }
@@ -0,0 +1,142 @@
+package main
+
+// Session resume. When the browser's WebSocket drops while a board is
+// connected, the session is parked for connection.resumeSeconds instead of
+// being torn down. The browser reconnects to /ws?resume=<token> with the
+// token it was given after connecting and picks up the same board
+// connection, with the last screen redrawn from the virtual terminal.
+
+import (
+	"encoding/base64"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// resumeWindow returns how long a dropped session waits for the browser to
+// come back (config connection.resumeSeconds, default 30s; negative disables).
+func resumeWindow() time.Duration {
+	cfg := LoadAppConfig()
+	secs := 30
+	if cfg != nil && cfg.Connection.ResumeSeconds != 0 {
+		secs = cfg.Connection.ResumeSeconds
+	}
+	if secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// parkedSession is a client waiting for its browser to resume.
+type parkedSession struct {
+	client *Client
+	timer  *time.Timer
+}
+
+var (
+	parkedMu sync.Mutex
+	parked   = map[string]*parkedSession{}
+)
+
+// issueResumeToken gives the browser a fresh token for the current board
+// connection.
+func (c *Client) issueResumeToken() {
+	if resumeWindow() <= 0 {
+		return
+	}
+	token := newSessionID() + newSessionID()
+	c.mu.Lock()
+	c.resumeToken = token
+	c.mu.Unlock()
+	c.sendJSON(Message{Type: "resumeToken", Token: token})
+}
+
+// park detaches the client from its dropped WebSocket and keeps the board
+// connection open for the resume window. It reports false when there is
+// nothing to keep, and the caller tears the session down as before.
+// Parking again from the same WebSocket (the read loop after a failed
+// ping parked it) reports true.
+func (c *Client) park(conn *websocket.Conn) bool {
+	window := resumeWindow()
+	c.mu.Lock()
+	if conn != nil && c.ws == nil && c.parkedFrom == conn {
+		c.mu.Unlock()
+		return true
+	}
+	token := c.resumeToken
+	live := c.telnet != nil || c.ssh != nil
+	if window <= 0 || token == "" || !live || c.ws != conn {
+		c.mu.Unlock()
+		return false
+	}
+	c.ws = nil
+	c.parkedFrom = conn
+	c.mu.Unlock()
+
+	p := &parkedSession{client: c}
+	parkedMu.Lock()
+	parked[token] = p
+	p.timer = time.AfterFunc(window, func() {
+		parkedMu.Lock()
+		expired := parked[token] == p
+		if expired {
+			delete(parked, token)
+		}
+		parkedMu.Unlock()
+		if expired {
+			log.Printf("Session %s: resume window expired", c.sessionID)
+			c.endSession("resume window expired")
+		}
+	})
+	parkedMu.Unlock()
+	log.Printf("Session %s: WebSocket dropped, holding board connection for %s", c.sessionID, window)
+	return true
+}
+
+// takeParked claims the session parked under token if it belongs to the
+// same browser (client token) and its board connection is still open.
+func takeParked(token, clientToken string) *Client {
+	parkedMu.Lock()
+	p := parked[token]
+	if p == nil || p.client.clientToken != clientToken {
+		parkedMu.Unlock()
+		return nil
+	}
+	delete(parked, token)
+	p.timer.Stop()
+	parkedMu.Unlock()
+
+	c := p.client
+	c.mu.Lock()
+	live := c.telnet != nil || c.ssh != nil
+	c.mu.Unlock()
+	if !live {
+		return nil
+	}
+	return c
+}
+
+// resume attaches a parked client to a new WebSocket, redraws the last
+// screen and hands out a new token.
+func (c *Client) resume(conn *websocket.Conn) {
+	c.mu.Lock()
+	c.ws = conn
+	c.parkedFrom = nil
+	addr := c.remoteAddr
+	screen := c.screen
+	c.mu.Unlock()
+	log.Printf("Session %s: resumed", c.sessionID)
+
+	c.sendMessage("resumed", "Resumed session with "+addr)
+	if data := screen.ANSI(); len(data) > 0 {
+		c.sendJSON(Message{
+			Type:     "data",
+			Data:     base64.StdEncoding.EncodeToString(data),
+			Encoding: "base64",
+		})
+	}
+	c.reportCharset()
+	c.issueResumeToken()
+}
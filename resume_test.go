@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestScreenModelFollowsResume(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name          string
+		resumeSeconds int
+		virtualScreen *bool
+		want          bool
+	}{
+		{"defaults (resume on)", 0, nil, true},
+		{"resume off", -1, nil, false},
+		{"both off", -1, &off, false},
+		{"virtual screen only", -1, &on, true},
+		{"resume only", 10, &off, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		cfg.Connection.ResumeSeconds = tt.resumeSeconds
+		cfg.Terminal.VirtualScreen = tt.virtualScreen
+		useConfig(t, cfg)
+		if got := screenModelEnabled(); got != tt.want {
+			t.Errorf("%s: screen model %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+// Pipeline self-test. Runs known telnet/ANSI/CP437 inputs through the same
+// processing stages a live session uses and compares the output with what
+// the current code is expected to produce, so operators can confirm
+// rendering behavior after a config change without connecting to a board.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// selfTestCase is one input/expected pair for a single pipeline stage.
+type selfTestCase struct {
+	name   string
+	stage  string // "telnet", "telnet-out", "ansi", "cp437", "nul"/"nul-binary", "newline"/"newline-binary", "zmodem-cancel" or "zmodem-suppress"/"zmodem-suppress-late"
+	input  []byte
+	expect []byte
+}
+
+// SelfTestResult reports one case in the /api/admin/selftest response.
+type SelfTestResult struct {
+	Name   string `json:"name"`
+	Stage  string `json:"stage"`
+	Pass   bool   `json:"pass"`
+	Expect string `json:"expect,omitempty"`
+	Got    string `json:"got,omitempty"`
+}
+
+// selfTestAllFixes enables every default normalization regardless of the
+// environment so results do not depend on ANSI_NORMALIZE.
+var selfTestAllFixes = ANSIOptions{
+	Enabled:       true,
+	FormFeedClear: true,
+	HomeOnClear:   true,
+	EraseDefault:  true,
+	NormalizeC1:   true,
+}
+
+var selfTestCases = []selfTestCase{
+	{"escaped IAC", "telnet", []byte{'a', 255, 255, 'b'}, []byte{'a', 255, 'b'}},
+	{"negotiation stripped", "telnet", []byte{'a', 255, 251, 1, 'b'}, []byte("ab")},
+	{"outgoing IAC doubled", "telnet-out", []byte{'a', 255, 'b'}, []byte{'a', 255, 255, 'b'}},
+	{"outgoing IAC run doubled", "telnet-out", []byte{255, 255, 0x18}, []byte{255, 255, 255, 255, 0x18}},
+	{"outgoing text untouched", "telnet-out", []byte("hi\r\n"), []byte("hi\r\n")},
+	{"clear screen homes", "ansi", []byte("\x1b[2J"), []byte("\x1b[2J\x1b[H")},
+	{"form feed clears", "ansi", []byte{0x0C}, []byte("\x1b[2J\x1b[H")},
+	{"SGR reset gets parameter", "ansi", []byte("\x1b[m"), []byte("\x1b[0m")},
+	{"erase display gets parameter", "ansi", []byte("\x1b[J"), []byte("\x1b[0J")},
+	{"erase line gets parameter", "ansi", []byte("\x1b[K"), []byte("\x1b[0K")},
+	{"C1 CSI normalized", "ansi", []byte{0x9B, '1', 'm'}, []byte("\x1b[1m")},
+	{"split sequence held", "ansi", []byte("x\x1b[3"), []byte("x")},
+	{"CP437 box drawing", "cp437", []byte{0xC9, 0xCD, 0xBB}, []byte("╔═╗")},
+	{"CP437 shading", "cp437", []byte{0xB0, 0xB1, 0xB2, 0xDB}, []byte("░▒▓█")},
+	{"CP437 keeps ANSI", "cp437", []byte("\x1b[1;31m\xFE"), []byte("\x1b[1;31m■")},
+	{"CR NUL is bare CR", "nul", []byte("a\r\x00b"), []byte("a\rb")},
+	{"NUL without CR kept", "nul", []byte("a\x00b"), []byte("a\x00b")},
+	{"CR NUL kept in binary", "nul-binary", []byte("a\r\x00b"), []byte("a\r\x00b")},
+	{"CR LF kept", "newline", []byte("a\r\nb"), []byte("a\r\nb")},
+	{"CR NUL becomes CR", "newline", []byte("a\r\x00b"), []byte("a\rb")},
+	{"bare CR advances", "newline", []byte("a\rb"), []byte("a\r\nb")},
+	{"LF alone kept", "newline", []byte("a\nb"), []byte("a\nb")},
+	{"binary CR untouched", "newline-binary", []byte("a\rb\r\x00c"), []byte("a\rb\r\x00c")},
+	{"output forwarded after cancel", "zmodem-cancel", []byte("Main menu\r\n"), []byte("Main menu\r\n")},
+	{"trailing frame dropped after cancel", "zmodem-cancel", []byte("**\x18B0800000000022d\r\n"), nil},
+	{"trailing CANs dropped after cancel", "zmodem-cancel", []byte{0x18, 0x18, 0x18}, nil},
+	{"plain output not suppressed", "zmodem-suppress", []byte("rz is a command\r\n"), []byte("ok")},
+	{"bare rz released by output", "zmodem-suppress", []byte("rz\r"), []byte("ok")},
+	{"ZRQINIT suppresses output", "zmodem-suppress", []byte("rz\r**\x18B00000000000000\r\n"), nil},
+	{"suppression window ends", "zmodem-suppress-late", []byte("**\x18B00000000000000\r\n"), []byte("ok")},
+}
+
+// runSelfTest executes every case against fresh pipeline state.
+func runSelfTest() []SelfTestResult {
+	results := make([]SelfTestResult, 0, len(selfTestCases))
+	for _, tc := range selfTestCases {
+		var got []byte
+		switch tc.stage {
+		case "telnet":
+			got = (&Client{}).processTelnetData(tc.input)
+		case "telnet-out":
+			got = escapeIAC(tc.input)
+		case "ansi":
+			got = NewANSIEnhancedProcessor(false, selfTestAllFixes).ProcessANSIData(tc.input)
+		case "cp437":
+			got = []byte(ConvertCP437ToUTF8Enhanced(tc.input))
+		case "newline", "newline-binary":
+			var pendingCR bool
+			got = telnetLineEndings(tc.input, &pendingCR, tc.stage == "newline-binary", false)
+		case "nul", "nul-binary":
+			// Policy "keep" so only the CR NUL rule applies
+			var afterCR bool
+			got = stripNUL(tc.input, &afterCR, tc.stage == "nul-binary", nulPolicyKeep)
+		case "zmodem-suppress", "zmodem-suppress-late":
+			// The input, then "ok" shortly after (or after the 2s window)
+			var s zmodemSuppress
+			start := time.Unix(0, 0)
+			later := start.Add(100 * time.Millisecond)
+			if tc.stage == "zmodem-suppress-late" {
+				later = start.Add(3 * time.Second)
+			}
+			s.observe(tc.input, start, 2*time.Second)
+			s.observe([]byte("ok"), later, 2*time.Second)
+			if !s.suppressing(later) {
+				got = []byte("ok")
+			}
+		case "zmodem-cancel":
+			// A receiver cancelled mid-transfer (no rz or connection to
+			// touch); whatever it passes through reaches the terminal
+			r := &LrzszReceiver{active: true}
+			r.Cancel()
+			if remaining, consumed := r.ProcessData(tc.input); !consumed && !r.Active() {
+				got = remaining
+			}
+		}
+		r := SelfTestResult{Name: tc.name, Stage: tc.stage, Pass: bytes.Equal(got, tc.expect)}
+		if !r.Pass {
+			r.Expect = fmt.Sprintf("%q", tc.expect)
+			r.Got = fmt.Sprintf("%q", got)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// handleSelfTest runs the pipeline self-test and reports pass/fail as JSON
+// (admin only).
+func handleSelfTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminAuthorized(w, r) {
+		return
+	}
+	results := runSelfTest()
+	failed := 0
+	for _, res := range results {
+		if !res.Pass {
+			failed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if failed > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Success bool             `json:"success"`
+		Passed  int              `json:"passed"`
+		Failed  int              `json:"failed"`
+		Results []SelfTestResult `json:"results"`
+	}{failed == 0, len(results) - failed, failed, results})
+}
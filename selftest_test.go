@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelfTestPasses(t *testing.T) {
+	for _, r := range runSelfTest() {
+		if !r.Pass {
+			t.Errorf("%s (%s): got %s, want %s", r.Name, r.Stage, r.Got, r.Expect)
+		}
+	}
+}
+
+func TestSelfTestNeedsAdminToken(t *testing.T) {
+	cfg := &Config{}
+	useConfig(t, cfg)
+	tests := []struct {
+		token  string // configured admin.token
+		bearer string
+		want   int
+	}{
+		{"", "", http.StatusNotFound},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "wrong", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		cfg.Admin.Token = tt.token
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/selftest", nil)
+		if tt.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+		rec := httptest.NewRecorder()
+		handleSelfTest(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("token %q, bearer %q: status %d, want %d", tt.token, tt.bearer, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+// The session charset has several sources: the directory entry or profile
+// at connect, telnet CHARSET negotiation, content detection, and the user's
+// override. They all go through setCharset so the browser always knows the
+// active encoding and why via "charsetChanged".
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Charset sources reported with "charsetChanged".
+const (
+	charsetSourceConfigured = "configured" // directory entry, profile or connect request
+	charsetSourceNegotiated = "negotiated" // telnet CHARSET (RFC 2066)
+	charsetSourceDetected   = "detected"   // content auto-detection
+	charsetSourceUser       = "user"       // "setCharset" from the browser
+)
+
+// CharsetInfo describes a session charset the server implements.
+type CharsetInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// supportedCharsets lists the charsets offered to the browser, served by
+// "getCharsets" and /api/charsets so the picker matches the server.
+var supportedCharsets = []CharsetInfo{
+	{ID: "CP437", Name: "MS-DOS CP437"},
+	{ID: "UTF-8", Name: "UTF-8"},
+	{ID: "PETSCIIU", Name: "Commodore PETSCII (upper/graphics)"},
+	{ID: "PETSCIIL", Name: "Commodore PETSCII (lower/upper)"},
+}
+
+// normalizeCharset returns the supported charset ID matching name
+// (case-insensitive, "UTF8" accepted for UTF-8), or "" if unsupported.
+func normalizeCharset(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, "UTF8") {
+		return "UTF-8"
+	}
+	for _, cs := range supportedCharsets {
+		if strings.EqualFold(cs.ID, name) {
+			return cs.ID
+		}
+	}
+	return ""
+}
+
+// sessionCharset returns the active charset. The read loops use it rather
+// than c.charset, which the WebSocket goroutine may be changing.
+func (c *Client) sessionCharset() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.charset
+}
+
+// setCharsetLocked records the session charset and its source and reports
+// whether either changed. It also tells the ANSI processor whether input
+// is UTF-8, so C1 normalization never applies to UTF-8 sessions. Caller
+// holds c.mu.
+func (c *Client) setCharsetLocked(charset, source string) bool {
+	if charset == "" {
+		return false
+	}
+	changed := c.charset != charset || c.charsetSource != source
+	c.charset = charset
+	c.charsetSource = source
+	if c.ansiEnhanced != nil {
+		c.ansiEnhanced.SetUTF8(charset == "UTF-8")
+	}
+	return changed
+}
+
+// setCharset switches the session charset and tells the browser. An
+// unsupported charset is reported with "charsetError": a user request is
+// ignored, anything else falls back to CP437.
+func (c *Client) setCharset(charset, source string) {
+	if charset == "" {
+		return
+	}
+	if id := normalizeCharset(charset); id != "" {
+		charset = id
+	} else if source == charsetSourceUser {
+		log.Printf("Charset: rejected unsupported %q", charset)
+		c.sendMessage("charsetError", fmt.Sprintf("Unsupported character encoding %q; keeping the current one", charset))
+		c.reportCharset()
+		return
+	} else {
+		log.Printf("Charset: unsupported %q (%s), using CP437", charset, source)
+		c.sendMessage("charsetError", fmt.Sprintf("Unsupported character encoding %q; using CP437", charset))
+		charset = "CP437"
+	}
+	c.mu.Lock()
+	changed := c.setCharsetLocked(charset, source)
+	c.mu.Unlock()
+	if changed {
+		c.reportCharset()
+	}
+}
+
+// reportCharset sends the active charset and its source to the browser.
+func (c *Client) reportCharset() {
+	c.mu.Lock()
+	charset, source := c.charset, c.charsetSource
+	c.mu.Unlock()
+	log.Printf("Charset: %s (%s)", charset, source)
+	c.sendJSON(Message{Type: "charsetChanged", Charset: charset, Source: source})
+	c.emitEvent(eventCharset, charset+" ("+source+")")
+}
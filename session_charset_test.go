@@ -0,0 +1,117 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const utf8Art = "╔══╗ Über"
+
+func charsetTestClient() *Client {
+	return &Client{
+		charset:      "CP437",
+		ansiEnhanced: NewANSIEnhancedProcessor(false, DefaultANSIOptions()),
+		sink:         func(Message) {},
+	}
+}
+
+func TestUTF8SessionSkipsC1Normalization(t *testing.T) {
+	sources := []string{charsetSourceConfigured, charsetSourceNegotiated, charsetSourceUser}
+	for _, source := range sources {
+		c := charsetTestClient()
+		c.setCharset("utf8", source)
+		if got := string(c.ansiEnhanced.ProcessANSIData([]byte(utf8Art))); got != utf8Art {
+			t.Errorf("%s: got %q, want %q", source, got, utf8Art)
+		}
+		// Back on CP437, 8-bit CSI is normalized again
+		c.setCharset("CP437", source)
+		if got := string(c.ansiEnhanced.ProcessANSIData([]byte{0x9B, '1', 'm'})); got != "\x1b[1m" {
+			t.Errorf("%s: CP437 C1 CSI got %q", source, got)
+		}
+	}
+}
+
+func TestSSHProtocolDefaultSkipsC1Normalization(t *testing.T) {
+	useConfig(t, &Config{})
+	c := charsetTestClient()
+	c.setBoard(c.applyProfile(BBSInfo{ID: "ssh-board", Protocol: "ssh"}))
+	if c.sessionCharset() != "UTF-8" {
+		t.Fatalf("charset = %s", c.sessionCharset())
+	}
+	if got := string(c.ansiEnhanced.ProcessANSIData([]byte(utf8Art))); got != utf8Art {
+		t.Errorf("got %q, want %q", got, utf8Art)
+	}
+}
+
+func TestCharsetAutoSwitchSkipsC1Normalization(t *testing.T) {
+	cfg := &Config{}
+	cfg.Terminal.CharsetAutoSwitch = true
+	useConfig(t, cfg)
+	c := charsetTestClient()
+	c.checkCharsetMismatch([]byte(strings.Repeat(utf8Art, 3)))
+	if c.sessionCharset() != "UTF-8" {
+		t.Fatalf("charset = %s after mismatch", c.sessionCharset())
+	}
+	if got := string(c.ansiEnhanced.ProcessANSIData([]byte(utf8Art))); got != utf8Art {
+		t.Errorf("got %q, want %q", got, utf8Art)
+	}
+}
+
+// yieldingRemote lets other goroutines run before each read, so a test
+// interleaves with the read loop even on a single CPU.
+type yieldingRemote struct {
+	*scriptedRemote
+}
+
+func (r *yieldingRemote) Read(p []byte) (int, error) {
+	runtime.Gosched()
+	return r.scriptedRemote.Read(p)
+}
+
+// TestCharsetChangeDuringRead switches the charset from the WebSocket side
+// while the read loop converts board output and negotiates; run with -race.
+func TestCharsetChangeDuringRead(t *testing.T) {
+	useConfig(t, &Config{})
+	// Several Ps so the two sides really overlap, even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(max(4, runtime.GOMAXPROCS(0))))
+	var reads []string
+	for i := 0; i < 3000; i++ {
+		reads = append(reads, "\x1b[1;31m\xc9\xcd\xbb Hello\r\n")
+		if i%100 == 0 {
+			// WILL/DO BINARY, DO NAWS and DO TTYPE keep the negotiation
+			// flags changing under the writer
+			reads = append(reads, "\xff\xfb\x00\xff\xfd\x00\xff\xfd\x1f\xff\xfd\x18")
+		}
+	}
+	c, remote, _ := pipelineClient("CP437", selfTestAllFixes, reads...)
+	yielding := &yieldingRemote{remote}
+	c.telnet = yielding
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		defer close(done)
+		charsets := []string{"UTF-8", "CP437", "PETSCIIU", "ISO-8859-1"}
+		for i := 0; ; i++ {
+			c.setCharset(charsets[i%len(charsets)], charsetSourceUser)
+			c.sendToRemote("hi\x1b[A")
+			if i == 0 {
+				close(started)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	<-started
+	c.readTelnet(yielding)
+	close(stop)
+	<-done
+
+	if c.sessionCharset() == "" {
+		t.Error("charset lost")
+	}
+}
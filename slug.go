@@ -25,12 +25,42 @@ func GenerateSlug(name string) string {
 	return slug
 }
 
-// FindBBSBySlug searches for a BBS entry by its slug
+// normalizeSlug makes an incoming slug comparable with GenerateSlug output:
+// lowercased, with surrounding slashes and hyphens trimmed.
+func normalizeSlug(slug string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(slug)), "/-")
+}
+
+// FindBBSBySlug searches for a BBS entry by its slug, ignoring case and
+// stray leading/trailing slashes or hyphens
 func FindBBSBySlug(slug string, bbsList []BBSEntry) *BBSEntry {
+	slug = normalizeSlug(slug)
+	if slug == "" {
+		return nil
+	}
 	for _, bbs := range bbsList {
 		if GenerateSlug(bbs.Name) == slug {
 			return &bbs
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// isSlugRoute decides whether a request path is a BBS quick link such as
+// "/my-board": a single path segment with no "." (paths with a dot are
+// always static files) naming a board in the directory. entries is only
+// called for candidate paths; a directory error means "not a slug".
+func isSlugRoute(path string, entries func() ([]BBSEntry, error)) bool {
+	if strings.Contains(path, ".") {
+		return false
+	}
+	parts := strings.Split(normalizeSlug(path), "/")
+	if len(parts) != 1 || parts[0] == "" {
+		return false
+	}
+	list, err := entries()
+	if err != nil {
+		return false
+	}
+	return FindBBSBySlug(parts[0], list) != nil
+}
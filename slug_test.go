@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+var slugTestBoards = []BBSEntry{
+	{Name: "Realm of Serion"},
+	{Name: "The Keep v2.0"},
+	{Name: "index"},
+}
+
+func TestIsSlugRoute(t *testing.T) {
+	directory := func() ([]BBSEntry, error) { return slugTestBoards, nil }
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/realm-of-serion", true},
+		{"/the-keep-v20", true},
+		{"/no-such-board", false},     // slug miss falls through to the file server
+		{"/", false},                  // root serves index.html from the file server
+		{"/style.css", false},         // static file
+		{"/app.js", false},            // static file
+		{"/index.html", false},        // a board named "index" does not shadow index.html
+		{"/the-keep-v2.0", false},     // paths with a dot are always files
+		{"/realm-of-serion/x", false}, // more than one segment
+		{"/static/realm-of-serion", false},
+	}
+	for _, tt := range tests {
+		if got := isSlugRoute(tt.path, directory); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsSlugRouteDirectoryOnlyForCandidates(t *testing.T) {
+	called := false
+	directory := func() ([]BBSEntry, error) {
+		called = true
+		return slugTestBoards, nil
+	}
+	for _, path := range []string{"/style.css", "/", "/a/b"} {
+		isSlugRoute(path, directory)
+	}
+	if called {
+		t.Error("directory loaded for a path that cannot be a slug")
+	}
+	failing := func() ([]BBSEntry, error) { return nil, errors.New("bbs.csv missing") }
+	if isSlugRoute("/realm-of-serion", failing) {
+		t.Error("directory error treated as a slug match")
+	}
+}
+
+func TestFindBBSBySlugForgiving(t *testing.T) {
+	tests := []struct {
+		slug string
+		want string
+	}{
+		{"realm-of-serion", "Realm of Serion"},
+		{"Realm-Of-Serion", "Realm of Serion"},
+		{"REALM-OF-SERION", "Realm of Serion"},
+		{"realm-of-serion/", "Realm of Serion"},
+		{"/Realm-Of-Serion/", "Realm of Serion"},
+		{"-realm-of-serion-", "Realm of Serion"},
+		{" realm-of-serion ", "Realm of Serion"},
+		{"realm-of", ""},
+		{"", ""},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if e := FindBBSBySlug(tt.slug, slugTestBoards); e != nil {
+			got = e.Name
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.slug, got, tt.want)
+		}
+	}
+}
+
+func TestIsSlugRouteMixedCaseAndTrailingSlash(t *testing.T) {
+	directory := func() ([]BBSEntry, error) { return slugTestBoards, nil }
+	for _, path := range []string{"/Realm-Of-Serion", "/realm-of-serion/", "/REALM-OF-SERION/"} {
+		if !isSlugRoute(path, directory) {
+			t.Errorf("%q not routed to the board", path)
+		}
+	}
+}
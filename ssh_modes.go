@@ -0,0 +1,64 @@
+package main
+
+// SSH PTY terminal modes. Boards expect a raw terminal; a PTY left in
+// cooked mode line-buffers and echoes input, which shows up as doubled
+// characters or keys that only arrive after Enter.
+
+import (
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshModeNames maps the RFC 4254 mode names accepted in config to opcodes.
+var sshModeNames = map[string]uint8{
+	"VINTR": ssh.VINTR, "VQUIT": ssh.VQUIT, "VERASE": ssh.VERASE, "VKILL": ssh.VKILL,
+	"VEOF": ssh.VEOF, "VEOL": ssh.VEOL, "VEOL2": ssh.VEOL2, "VSTART": ssh.VSTART,
+	"VSTOP": ssh.VSTOP, "VSUSP": ssh.VSUSP, "VLNEXT": ssh.VLNEXT, "VWERASE": ssh.VWERASE,
+	"IGNPAR": ssh.IGNPAR, "PARMRK": ssh.PARMRK, "INPCK": ssh.INPCK, "ISTRIP": ssh.ISTRIP,
+	"INLCR": ssh.INLCR, "IGNCR": ssh.IGNCR, "ICRNL": ssh.ICRNL, "IXON": ssh.IXON,
+	"IXANY": ssh.IXANY, "IXOFF": ssh.IXOFF, "IMAXBEL": ssh.IMAXBEL, "IUTF8": ssh.IUTF8,
+	"ISIG": ssh.ISIG, "ICANON": ssh.ICANON, "ECHO": ssh.ECHO, "ECHOE": ssh.ECHOE,
+	"ECHOK": ssh.ECHOK, "ECHONL": ssh.ECHONL, "NOFLSH": ssh.NOFLSH, "IEXTEN": ssh.IEXTEN,
+	"ECHOCTL": ssh.ECHOCTL, "ECHOKE": ssh.ECHOKE, "OPOST": ssh.OPOST, "ONLCR": ssh.ONLCR,
+	"OCRNL": ssh.OCRNL, "ONOCR": ssh.ONOCR, "ONLRET": ssh.ONLRET, "CS7": ssh.CS7,
+	"CS8": ssh.CS8, "PARENB": ssh.PARENB, "PARODD": ssh.PARODD,
+	"TTY_OP_ISPEED": ssh.TTY_OP_ISPEED, "TTY_OP_OSPEED": ssh.TTY_OP_OSPEED,
+}
+
+// defaultSSHModes puts the PTY in raw mode: no local echo or line editing,
+// control characters passed through to the board, 8-bit clean.
+func defaultSSHModes() ssh.TerminalModes {
+	return ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.ICANON:        0,
+		ssh.ISIG:          0,
+		ssh.IEXTEN:        0,
+		ssh.IXON:          0,
+		ssh.ICRNL:         0,
+		ssh.CS8:           1,
+		ssh.TTY_OP_ISPEED: 38400,
+		ssh.TTY_OP_OSPEED: 38400,
+	}
+}
+
+// sshTerminalModes returns the modes sent with RequestPty: the raw
+// defaults, with config ssh.terminalModes entries (by name, e.g. "ECHO")
+// added or overriding. Unknown names are logged and ignored.
+func sshTerminalModes() ssh.TerminalModes {
+	cfg := LoadAppConfig()
+	modes := defaultSSHModes()
+	if cfg == nil {
+		return modes
+	}
+	for name, v := range cfg.SSH.TerminalModes {
+		op, ok := sshModeNames[strings.ToUpper(name)]
+		if !ok {
+			log.Printf("SSH: ignoring unknown terminal mode %q", name)
+			continue
+		}
+		modes[op] = v
+	}
+	return modes
+}
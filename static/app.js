@@ -17,9 +17,11 @@ class BBSTerminal {
         this.currentBBS = null;
         this.lastConnection = null;
         this.music = null;
+        this.resumeToken = null; // lets a dropped session pick up where it left off
         // fullscreen state removed
         
         this.loadConfig();
+        this.loadCharsets();
         this.initTerminal();
         this.initEventListeners();
         this.loadSettings();
@@ -33,12 +35,59 @@ class BBSTerminal {
         try {
             const response = await fetch('/api/config');
             const config = await response.json();
-            this.allowManualConnection = false; // Always false now, no manual connections
+            this.allowManualConnection = !!config.allowManualConnect;
+            this.serverFeatures = config.features || {};
+            this.applyTerminalSizes(config.terminalSizes);
         } catch (error) {
             console.error('Failed to load config:', error);
         }
     }
 
+    // Populate the charset picker from the server's supported list
+    async loadCharsets() {
+        try {
+            const response = await fetch('/api/charsets');
+            const data = await response.json();
+            this.applyCharsetList(data.charsets);
+        } catch (error) {
+            console.error('Failed to load charsets:', error);
+        }
+    }
+
+    // Offer only the terminal sizes the server reports over NAWS
+    applyTerminalSizes(sizes) {
+        const sizeEl = document.getElementById('terminal-size');
+        if (!sizeEl || !Array.isArray(sizes) || sizes.length === 0) return;
+        const wanted = sizes.map(s => `${s.cols}x${s.rows}`);
+        for (const opt of Array.from(sizeEl.options)) {
+            if (!wanted.includes(opt.value)) opt.remove();
+        }
+        for (const value of wanted) {
+            if (!Array.from(sizeEl.options).some(o => o.value === value)) {
+                const opt = document.createElement('option');
+                opt.value = value;
+                opt.textContent = value.replace('x', '×');
+                sizeEl.appendChild(opt);
+            }
+        }
+    }
+
+    applyCharsetList(charsets) {
+        const charsetEl = document.getElementById('charset');
+        if (!charsetEl || !Array.isArray(charsets) || charsets.length === 0) return;
+        const current = charsetEl.value;
+        charsetEl.innerHTML = '';
+        for (const cs of charsets) {
+            const opt = document.createElement('option');
+            opt.value = cs.id;
+            opt.textContent = cs.name || cs.id;
+            charsetEl.appendChild(opt);
+        }
+        if (charsets.some(cs => cs.id === current)) {
+            charsetEl.value = current;
+        }
+    }
+
     // Debug: install console-callable helpers to hexdump on-screen cells
     installDebugDumpHelpers() {
         const self = this;
@@ -377,13 +426,37 @@ class BBSTerminal {
                 port: port,
                 username: '',
                 password: '',
-                charset: charset
+                charset: charset,
+                termTypes: this.termTypes
             }));
         };
 
         this.setupWebSocketHandlers();
     }
 
+    // Reopen the WebSocket and reattach to the server-side session, which
+    // keeps the board connection open briefly after a drop
+    resumeSession() {
+        const token = this.resumeToken;
+        this.resumeToken = null;
+        this.updateStatus('Reconnecting...', 'warning');
+        this.terminal.writeln('\r\n\x1b[33mConnection lost, resuming...\x1b[0m');
+        setTimeout(() => {
+            const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+            this.ws = new WebSocket(`${wsProtocol}//${window.location.host}/ws?resume=${encodeURIComponent(token)}`);
+            this.ws.onopen = () => {
+                if (typeof ZmodemIntegration !== 'undefined') {
+                    try {
+                        this.zmodem = new ZmodemIntegration(this.terminal, this.ws);
+                    } catch (e) {
+                        console.error('Zmodem init failed:', e);
+                    }
+                }
+            };
+            this.setupWebSocketHandlers();
+        }, 1000);
+    }
+
     // Deprecated - kept for compatibility
     connect(isDirectoryConnection = false) {
         this.terminal.writeln('\x1b[31mError: Please use the BBS directory to connect.\x1b[0m');
@@ -439,18 +512,74 @@ class BBSTerminal {
                     }
                     break;
 
+                case 'terminalSize':
+                    // Board's connection profile asks for a specific size
+                    if (msg.cols && msg.rows) {
+                        this.resizeTerminal(msg.cols, msg.rows);
+                    }
+                    break;
+
+                case 'bell':
+                    this.ringBell(msg.count || 1);
+                    break;
+
                 case 'music':
                     if (this.music && msg.message) {
                         this.music.parseAndQueue(msg.message);
                     }
                     break;
                     
+                case 'charsets':
+                    this.applyCharsetList(msg.charsets);
+                    break;
+
+                case 'charsetChanged': {
+                    // Authoritative session charset; keep the selector in sync
+                    const charsetEl = document.getElementById('charset');
+                    if (charsetEl && msg.charset && charsetEl.value !== msg.charset) {
+                        charsetEl.value = msg.charset;
+                    }
+                    if (msg.source !== 'user' && msg.source !== 'configured') {
+                        this.terminal.writeln(`\r\n\x1b[36mCharacter encoding: ${msg.charset} (${msg.source})\x1b[0m`);
+                    }
+                    break;
+                }
+
+                case 'binaryDataWarning':
+                    // Likely a transfer the server did not recognise
+                    this.terminal.writeln(`\r\n\x1b[33m${msg.message}\x1b[0m`);
+                    if ((this.serverFeatures || {}).manualDownload !== false &&
+                        window.confirm(`${msg.message}\n\nStart a ZMODEM download?`)) {
+                        this.startDownload();
+                    }
+                    break;
+
+                case 'charsetMismatch':
+                case 'charsetError':
+                    this.terminal.writeln(`\r\n\x1b[33m${msg.message}\x1b[0m`);
+                    break;
+
+                case 'floodDetected':
+                    // Output is paused server-side until the user chooses
+                    this.terminal.writeln(`\r\n\x1b[33m${msg.message}\x1b[0m`);
+                    if (window.confirm(`${msg.message}\n\nOK to continue, Cancel to disconnect.`)) {
+                        this.ws.send(JSON.stringify({ type: 'floodContinue' }));
+                    } else {
+                        this.disconnect();
+                    }
+                    break;
+
                 case 'error':
                     this.terminal.writeln(`\x1b[31mError: ${msg.message}\x1b[0m`);
                     this.updateStatus('Disconnected', 'disconnected');
                     this.resetButtons();
                     break;
                 
+                case 'fallback':
+                    this.terminal.writeln(`\x1b[33m${msg.message}\x1b[0m`);
+                    this.updateStatus('Connecting (telnet)...', 'warning');
+                    break;
+                
                 case 'downloadStart':
                     this.showDownloadNotification('File transfer starting...');
                     break;
@@ -467,14 +596,41 @@ class BBSTerminal {
                     this.completeDownload(msg.message, msg.data);
                     break;
                 
+                case 'downloadBlocked':
+                    this.hideDownloadNotification();
+                    this.terminal.writeln(`\r\n\x1b[33mDownload blocked: ${msg.name} (${msg.message})\x1b[0m`);
+                    break;
+
                 case 'downloadCancelled':
                     this.hideDownloadNotification();
                     this.terminal.writeln(`\x1b[33mDownload cancelled\x1b[0m`);
                     break;
                 
+                case 'fileDownloadStart':
+                    // Large file split by the server; collect chunks in order
+                    this.chunkedDownload = { name: msg.name, parts: [] };
+                    this.updateDownloadMessage(`Receiving: ${msg.name}`);
+                    break;
+
+                case 'fileDownloadChunk':
+                    if (this.chunkedDownload && this.chunkedDownload.name === msg.name) {
+                        this.chunkedDownload.parts[msg.seq || 0] = msg.data;
+                    }
+                    break;
+
+                case 'fileDownloadEnd':
+                    this.warnPartialDownload(msg);
+                    if (this.chunkedDownload && this.chunkedDownload.name === msg.name) {
+                        const parts = this.chunkedDownload.parts;
+                        this.chunkedDownload = null;
+                        this.completeDownloadParts(msg.name, parts);
+                    }
+                    break;
+
                 case 'fileDownload':
                     // Complete file download from server
                     if (window.DEBUG) console.log('Received fileDownload message for:', msg.message);
+                    this.warnPartialDownload(msg);
                     this.completeDownload(msg.message, msg.data);
                     break;
                     
@@ -488,10 +644,30 @@ class BBSTerminal {
                     this.updateDownloadMessage(msg.message);
                     break;
                     
+                case 'unsupportedMessage':
+                    // Server is older than this page (server.strictMessages)
+                    console.warn(msg.message);
+                    break;
+
+                case 'resumeToken':
+                    this.resumeToken = msg.token || null;
+                    break;
+
+                case 'resumed':
+                    this.isConnected = true;
+                    this.updateStatus('Connected', 'connected');
+                    document.getElementById('disconnect-btn-header').style.display = 'inline-block';
+                    if (typeof directoryManager !== 'undefined') {
+                        directoryManager.setConnectionStatus(true);
+                    }
+                    break;
+
+                case 'resumeFailed':
                 case 'disconnected':
+                    this.resumeToken = null;
                     this.isConnected = false;
                     this.updateStatus('Disconnected', 'disconnected');
-                    this.terminal.writeln('\x1b[33mConnection closed\x1b[0m');
+                    this.terminal.writeln(`\x1b[33mConnection closed${msg.message ? ` (${msg.message})` : ''}\x1b[0m`);
                     this.resetButtons();
                     document.getElementById('disconnect-btn-header').style.display = 'none';
                     {
@@ -520,6 +696,11 @@ class BBSTerminal {
         };
 
         this.ws.onclose = () => {
+            // Try once to resume a session that dropped unexpectedly
+            if (this.isConnected && this.resumeToken) {
+                this.resumeSession();
+                return;
+            }
             if (this.isConnected) {
                 this.terminal.writeln('\x1b[33mConnection lost\x1b[0m');
             }
@@ -616,7 +797,8 @@ class BBSTerminal {
                 port: port,
                 username: username,
                 password: password,
-                charset: charset
+                charset: charset,
+                termTypes: this.termTypes
             }));
         };
         
@@ -715,7 +897,8 @@ class BBSTerminal {
             fontSize: this.fontSize,
             size: `${this.currentSize.cols}x${this.currentSize.rows}`,
             charset: charset,
-            mobileMode: this.mobileMode
+            mobileMode: this.mobileMode,
+            termTypes: this.termTypes
         }));
     }
 
@@ -723,6 +906,10 @@ class BBSTerminal {
         const settings = localStorage.getItem('terminalSettings');
         if (settings) {
             const parsed = JSON.parse(settings);
+            // Optional terminal types reported to boards (TTYPE / SSH $TERM)
+            if (Array.isArray(parsed.termTypes)) {
+                this.termTypes = parsed.termTypes;
+            }
             if (parsed.fontSize) {
                 this.fontSize = parsed.fontSize;
                 const fontSizeEl = document.getElementById('font-size');
@@ -898,15 +1085,22 @@ class BBSTerminal {
     }
     
     completeDownload(filename, base64Data) {
-        // Convert base64 to blob and trigger download
+        this.completeDownloadParts(filename, [base64Data]);
+    }
+
+    // completeDownloadParts decodes independently-encoded base64 parts
+    // into one file and triggers the browser download
+    completeDownloadParts(filename, base64Parts) {
         try {
-            const byteCharacters = atob(base64Data);
-            const byteNumbers = new Array(byteCharacters.length);
-            for (let i = 0; i < byteCharacters.length; i++) {
-                byteNumbers[i] = byteCharacters.charCodeAt(i);
-            }
-            const byteArray = new Uint8Array(byteNumbers);
-            const blob = new Blob([byteArray], { type: 'application/octet-stream' });
+            const arrays = base64Parts.map((part) => {
+                const byteCharacters = atob(part || '');
+                const bytes = new Uint8Array(byteCharacters.length);
+                for (let i = 0; i < byteCharacters.length; i++) {
+                    bytes[i] = byteCharacters.charCodeAt(i);
+                }
+                return bytes;
+            });
+            const blob = new Blob(arrays, { type: 'application/octet-stream' });
             
             // Create download link
             const url = window.URL.createObjectURL(blob);
@@ -937,6 +1131,24 @@ class BBSTerminal {
         }
     }
     
+    ringBell(count) {
+        // Visual bell; xterm.js still handles the BEL itself
+        this.bellCount = (this.bellCount || 0) + count;
+        const container = document.getElementById('terminal-container');
+        if (container) {
+            container.classList.add('bell-flash');
+            clearTimeout(this.bellTimer);
+            this.bellTimer = setTimeout(() => container.classList.remove('bell-flash'), 150);
+        }
+    }
+
+    warnPartialDownload(msg) {
+        // The server flags files smaller than the size the board declared
+        if (msg.partial) {
+            this.terminal.writeln(`\r\n\x1b[33mWarning: ${msg.message} is incomplete (${msg.declared} bytes expected)\x1b[0m`);
+        }
+    }
+
     hideDownloadNotification() {
         const notification = document.getElementById('download-notification');
         if (notification) {
@@ -945,6 +1157,13 @@ class BBSTerminal {
         }
     }
     
+    startDownload() {
+        if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+            this.showDownloadNotification('Waiting for the board to send...');
+            this.ws.send(JSON.stringify({ type: 'startDownload' }));
+        }
+    }
+
     cancelDownload() {
         if (this.ws && this.ws.readyState === WebSocket.OPEN) {
             this.ws.send(JSON.stringify({
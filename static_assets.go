@@ -0,0 +1,88 @@
+package main
+
+// Static asset serving helpers. The UI lives in ./static, or is compiled
+// into the binary when built with -tags embedstatic. When it is missing
+// (e.g. a source build without the frontend) the server still answers "/"
+// with a short explanation instead of a bare 404.
+
+import (
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const staticDir = "./static"
+
+// embeddedStatic holds the UI assets when built with -tags embedstatic;
+// nil means assets are served from staticDir on disk.
+var embeddedStatic fs.FS
+
+// missingStaticPage is served for "/" and quick links when index.html is absent.
+const missingStaticPage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>RetroTerm</title></head>
+<body style="font-family: monospace; background: #000; color: #aaa; padding: 2em;">
+<h1 style="color: #5ff;">RetroTerm</h1>
+<p>The server is running, but the web interface assets were not found.</p>
+<p>Expected <code>static/index.html</code> next to the binary's working directory.
+Copy the <code>static/</code> directory from the source tree and reload this page,
+or rebuild with <code>go build -tags embedstatic</code> to include it in the binary.</p>
+</body>
+</html>
+`
+
+// staticFileSystem returns the filesystem UI assets are served from.
+func staticFileSystem() http.FileSystem {
+	if embeddedStatic != nil {
+		return http.FS(embeddedStatic)
+	}
+	return http.Dir(staticDir)
+}
+
+// staticIndexExists reports whether the UI entry point is available.
+func staticIndexExists() bool {
+	if embeddedStatic != nil {
+		_, err := fs.Stat(embeddedStatic, "index.html")
+		return err == nil
+	}
+	_, err := os.Stat(filepath.Join(staticDir, "index.html"))
+	return err == nil
+}
+
+// checkStaticAssets logs where assets come from, and a clear warning at
+// startup if the UI is missing.
+func checkStaticAssets() {
+	if embeddedStatic != nil {
+		log.Printf("Serving embedded static assets")
+		return
+	}
+	if _, err := os.Stat(staticDir); err != nil {
+		log.Printf("Warning: static directory %s not found; serving a placeholder page at /", staticDir)
+		return
+	}
+	if !staticIndexExists() {
+		log.Printf("Warning: %s/index.html not found; serving a placeholder page at /", staticDir)
+	}
+}
+
+// serveStatic serves a request from the static asset filesystem.
+func serveStatic(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(staticFileSystem()).ServeHTTP(w, r)
+}
+
+// serveIndex serves the UI entry point, or the placeholder if it is missing.
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if staticIndexExists() {
+		if embeddedStatic != nil {
+			http.ServeFileFS(w, r, embeddedStatic, "index.html")
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(missingStaticPage))
+}
@@ -0,0 +1,22 @@
+//go:build embedstatic
+
+package main
+
+// Single-binary builds: go build -tags embedstatic compiles ./static into
+// the executable so the server does not depend on its working directory.
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var staticEmbedFS embed.FS
+
+func init() {
+	sub, err := fs.Sub(staticEmbedFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	embeddedStatic = sub
+}
@@ -0,0 +1,101 @@
+package main
+
+// Telnet CHARSET option (RFC 2066). Lets capable boards agree on UTF-8 or
+// CP437 with us instead of relying on the directory's static encoding.
+
+import (
+	"bytes"
+	"log"
+	"strings"
+)
+
+const (
+	TELOPT_CHARSET = 42
+
+	charsetRequest  = 1
+	charsetAccepted = 2
+	charsetRejected = 3
+)
+
+// telnetCharsetOffer lists the charsets we offer, in preference order.
+var telnetCharsetOffer = []string{"UTF-8", "CP437"}
+
+// normalizeTelnetCharset maps a CHARSET name from the wire to the session
+// charset value, or "" if we do not support it.
+func normalizeTelnetCharset(name string) string {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "UTF-8", "UTF8":
+		return "UTF-8"
+	case "CP437", "IBM437", "IBM-437", "CP-437", "437":
+		return "CP437"
+	}
+	return ""
+}
+
+// buildCharsetRequest constructs IAC SB CHARSET REQUEST ;UTF-8;CP437 IAC SE.
+func buildCharsetRequest() []byte {
+	const (
+		IAC = 255
+		SB  = 250
+		SE  = 240
+	)
+	out := []byte{IAC, SB, TELOPT_CHARSET, charsetRequest}
+	for _, name := range telnetCharsetOffer {
+		out = append(out, ';')
+		out = append(out, name...)
+	}
+	return append(out, IAC, SE)
+}
+
+// handleCharsetSB processes a CHARSET subnegotiation payload (without the
+// option byte) and returns any reply to send. Accepted charsets switch the
+// session and are reported to the browser as "charsetChanged".
+func (c *Client) handleCharsetSB(sb []byte) []byte {
+	const (
+		IAC = 255
+		SB  = 250
+		SE  = 240
+	)
+	if len(sb) == 0 {
+		return nil
+	}
+	switch sb[0] {
+	case charsetRequest:
+		// Board offers a list: <sep>name<sep>name...; pick our preferred one
+		list := sb[1:]
+		if bytes.HasPrefix(list, []byte("[TTABLE]")) {
+			// Translation tables are not supported
+			return []byte{IAC, SB, TELOPT_CHARSET, charsetRejected, IAC, SE}
+		}
+		if len(list) < 2 {
+			return []byte{IAC, SB, TELOPT_CHARSET, charsetRejected, IAC, SE}
+		}
+		sep := string(list[:1])
+		offered := strings.Split(string(list[1:]), sep)
+		for _, want := range telnetCharsetOffer {
+			for _, name := range offered {
+				if normalizeTelnetCharset(name) == want {
+					c.applyNegotiatedCharset(want)
+					resp := []byte{IAC, SB, TELOPT_CHARSET, charsetAccepted}
+					resp = append(resp, name...)
+					return append(resp, IAC, SE)
+				}
+			}
+		}
+		log.Printf("Telnet CHARSET: no supported charset in offer %q", offered)
+		return []byte{IAC, SB, TELOPT_CHARSET, charsetRejected, IAC, SE}
+	case charsetAccepted:
+		if cs := normalizeTelnetCharset(string(sb[1:])); cs != "" {
+			c.applyNegotiatedCharset(cs)
+		}
+	case charsetRejected:
+		log.Printf("Telnet CHARSET: board rejected our offer; keeping %s", c.sessionCharset())
+	}
+	return nil
+}
+
+// applyNegotiatedCharset switches the session charset and tells the client.
+func (c *Client) applyNegotiatedCharset(charset string) {
+	log.Printf("Telnet CHARSET: negotiated %s", charset)
+	c.setCharset(charset, charsetSourceNegotiated)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRepeatedDoNAWSResendsSize(t *testing.T) {
+	remote := &scriptedRemote{}
+	c := &Client{telnet: remote, termCols: 80, termRows: 25}
+	doNAWS := []byte{255, 253, 31}
+
+	c.processTelnetData(doNAWS)
+	want := []byte{255, 251, 31, 255, 250, 31, 0, 80, 0, 25, 255, 240}
+	if !bytes.Equal(remote.written, want) {
+		t.Fatalf("first DO NAWS: sent % x, want % x", remote.written, want)
+	}
+	if !c.telnetNAWS {
+		t.Fatal("NAWS not marked on")
+	}
+
+	// Mid-session the board asks again after the size changed: a fresh SB
+	// without a second WILL
+	remote.written = nil
+	c.termCols, c.termRows = 132, 50
+	c.processTelnetData(append([]byte("menu"), doNAWS...))
+	want = []byte{255, 250, 31, 0, 132, 0, 50, 255, 240}
+	if !bytes.Equal(remote.written, want) {
+		t.Errorf("repeated DO NAWS: sent % x, want % x", remote.written, want)
+	}
+}
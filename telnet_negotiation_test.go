@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// writeLogRemote is a RemoteConn that keeps each Write separately.
+type writeLogRemote struct {
+	scriptedRemote
+	writes [][]byte
+}
+
+func (r *writeLogRemote) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestImmediateNegotiation(t *testing.T) {
+	// DO TTYPE, an escaped IAC in the login screen, DO NAWS (255 columns,
+	// so the SB must double it) and TTYPE SEND in one read
+	read := []byte("\xff\xfd\x18Hi \xff\xff!\xff\xfd\x1f\xff\xfa\x18\x01\xff\xf0")
+	wantClean := []byte("Hi \xff!")
+	replies := [][]byte{
+		[]byte("\xff\xfb\x18"),
+		[]byte("\xff\xfb\x1f\xff\xfa\x1f\x00\xff\xff\x00\x19\xff\xf0"),
+		[]byte("\xff\xfa\x18\x00ANSI\xff\xf0"),
+	}
+	for _, immediate := range []bool{false, true} {
+		cfg := &Config{}
+		cfg.Connection.ImmediateNegotiation = immediate
+		useConfig(t, cfg)
+
+		remote := &writeLogRemote{}
+		c := &Client{telnet: remote, termCols: 255, termRows: 25, termTypes: []string{"ANSI"}}
+		if clean := c.processTelnetData(read); !bytes.Equal(clean, wantClean) {
+			t.Errorf("immediate=%v: clean % x, want % x", immediate, clean, wantClean)
+		}
+		want := replies
+		if !immediate {
+			want = [][]byte{bytes.Join(replies, nil)}
+		}
+		if len(remote.writes) != len(want) {
+			t.Fatalf("immediate=%v: %d writes % x, want %d", immediate, len(remote.writes), remote.writes, len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(remote.writes[i], want[i]) {
+				t.Errorf("immediate=%v: write %d is % x, want % x", immediate, i, remote.writes[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+// Per-session telnet negotiation trace. When TELNET_TRACE=true every
+// DO/DONT/WILL/WONT and subnegotiation in both directions is kept in a small
+// ring buffer that the browser can fetch with "getNegotiationTrace".
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// NegotiationEvent is one traced telnet command.
+type NegotiationEvent struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"dir"` // "recv" from the board, "sent" by us
+	Command   string    `json:"cmd"`
+	Option    string    `json:"option"`
+	Data      string    `json:"data,omitempty"` // SB payload, hex
+}
+
+// negotiationTrace is a fixed-size ring of the most recent events.
+type negotiationTrace struct {
+	mu     sync.Mutex
+	events []NegotiationEvent
+	next   int
+	full   bool
+}
+
+func newNegotiationTrace(size int) *negotiationTrace {
+	return &negotiationTrace{events: make([]NegotiationEvent, size)}
+}
+
+func (t *negotiationTrace) add(ev NegotiationEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events[t.next] = ev
+	t.next = (t.next + 1) % len(t.events)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// snapshot returns the recorded events oldest first.
+func (t *negotiationTrace) snapshot() []NegotiationEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full {
+		return append([]NegotiationEvent(nil), t.events[:t.next]...)
+	}
+	out := make([]NegotiationEvent, 0, len(t.events))
+	out = append(out, t.events[t.next:]...)
+	return append(out, t.events[:t.next]...)
+}
+
+var telnetOptionNames = map[byte]string{
+	0:  "BINARY",
+	1:  "ECHO",
+	3:  "SGA",
+	5:  "STATUS",
+	6:  "TIMING-MARK",
+	24: "TTYPE",
+	25: "EOR",
+	31: "NAWS",
+	32: "TSPEED",
+	33: "LFLOW",
+	34: "LINEMODE",
+	35: "XDISPLOC",
+	36: "ENVIRON",
+	39: "NEW-ENVIRON",
+	42: "CHARSET",
+}
+
+var telnetCommandNames = map[byte]string{
+	240: "SE",
+	250: "SB",
+	251: "WILL",
+	252: "WONT",
+	253: "DO",
+	254: "DONT",
+}
+
+// telnetOptionName returns a readable option name, e.g. "NAWS" or "OPT-70".
+func telnetOptionName(opt byte) string {
+	if name, ok := telnetOptionNames[opt]; ok {
+		return name
+	}
+	return fmt.Sprintf("OPT-%d", opt)
+}
+
+// traceNegotiation records one command if tracing is enabled.
+func (c *Client) traceNegotiation(dir string, cmd, opt byte, data []byte) {
+	if c.trace == nil {
+		return
+	}
+	ev := NegotiationEvent{
+		Time:      time.Now(),
+		Direction: dir,
+		Command:   telnetCommandNames[cmd],
+		Option:    telnetOptionName(opt),
+	}
+	if len(data) > 0 {
+		ev.Data = fmt.Sprintf("% x", data)
+	}
+	c.trace.add(ev)
+}
+
+// traceNegotiationBytes records every command in an outgoing negotiation
+// buffer (IAC cmd opt and IAC SB opt ... IAC SE runs).
+func (c *Client) traceNegotiationBytes(dir string, b []byte) {
+	const (
+		IAC = 255
+		SB  = 250
+		SE  = 240
+	)
+	if c.trace == nil {
+		return
+	}
+	for i := 0; i+2 < len(b); {
+		if b[i] != IAC {
+			i++
+			continue
+		}
+		cmd, opt := b[i+1], b[i+2]
+		if cmd == SB {
+			j := i + 3
+			for j+1 < len(b) && !(b[j] == IAC && b[j+1] == SE) {
+				j++
+			}
+			c.traceNegotiation(dir, cmd, opt, b[i+3:j])
+			i = j + 2
+			continue
+		}
+		if _, ok := telnetCommandNames[cmd]; ok {
+			c.traceNegotiation(dir, cmd, opt, nil)
+		}
+		i += 3
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// Telnet TERMINAL-SPEED option (RFC 1079). A few boards ask for the line
+// speed and pace or simplify their ANSI to match, so reporting a slow speed
+// brings back throttled, modem-era output and a fast one keeps it snappy.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const TELOPT_TSPEED = 32
+
+// defaultTelnetSpeed is reported when terminal.telnetSpeed is unset.
+const defaultTelnetSpeed = "38400,38400"
+
+// telnetSpeed returns the "transmit,receive" speed to report, or "" when
+// TSPEED is refused (terminal.telnetSpeed "off").
+func telnetSpeed() string {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Terminal.TelnetSpeed == "" {
+		return defaultTelnetSpeed
+	}
+	if strings.EqualFold(cfg.Terminal.TelnetSpeed, "off") {
+		return ""
+	}
+	return normalizeTelnetSpeed(cfg.Terminal.TelnetSpeed)
+}
+
+// normalizeTelnetSpeed accepts "N" or "N,N" (bits per second) and returns
+// the "transmit,receive" form.
+func normalizeTelnetSpeed(s string) string {
+	tx, rx, ok := strings.Cut(strings.TrimSpace(s), ",")
+	if !ok {
+		rx = tx
+	}
+	return strings.TrimSpace(tx) + "," + strings.TrimSpace(rx)
+}
+
+// validateTelnetSpeed checks a terminal.telnetSpeed value.
+func validateTelnetSpeed(s string) error {
+	if s == "" || strings.EqualFold(s, "off") {
+		return nil
+	}
+	for _, part := range strings.Split(normalizeTelnetSpeed(s), ",") {
+		if n, err := strconv.Atoi(part); err != nil || n <= 0 {
+			return fmt.Errorf("must be \"off\", a speed or \"transmit,receive\" speeds, got %q", s)
+		}
+	}
+	return nil
+}
+
+// buildTSPEEDIs constructs IAC SB TSPEED IS <tx>,<rx> IAC SE.
+func buildTSPEEDIs(speed string) []byte {
+	const (
+		IAC        = 255
+		SB         = 250
+		SE         = 240
+		TELQUAL_IS = 0
+	)
+	sb := []byte{IAC, SB, TELOPT_TSPEED, TELQUAL_IS}
+	sb = append(sb, speed...)
+	return append(sb, IAC, SE)
+}
@@ -0,0 +1,60 @@
+package main
+
+// Telnet output. Everything sent to a telnet board goes through
+// writeTelnetData, which doubles IAC (0xFF) as RFC 854 requires of data in
+// every mode, including BINARY, or writeTelnetCommand for bytes that are
+// already telnet commands (negotiation, subnegotiation, raw handshakes) and
+// must go out untouched.
+
+import (
+	"bytes"
+	"errors"
+)
+
+// errTelnetClosed is returned when there is no telnet connection to write to.
+var errTelnetClosed = errors.New("telnet connection closed")
+
+// escapeIAC doubles each IAC byte in b, returning b itself when it has none.
+func escapeIAC(b []byte) []byte {
+	n := bytes.Count(b, []byte{0xFF})
+	if n == 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b)+n)
+	for _, x := range b {
+		out = append(out, x)
+		if x == 0xFF {
+			out = append(out, 0xFF)
+		}
+	}
+	return out
+}
+
+// writeTelnetData sends data to the board with IAC escaped.
+func (c *Client) writeTelnetData(b []byte) error {
+	return c.writeTelnet(b, false)
+}
+
+// writeTelnetCommand sends bytes that are already telnet commands as-is.
+func (c *Client) writeTelnetCommand(b []byte) error {
+	return c.writeTelnet(b, true)
+}
+
+// writeTelnet writes b to the current telnet connection; raw skips IAC
+// escaping. Callers must not hold c.mu.
+func (c *Client) writeTelnet(b []byte, raw bool) error {
+	c.mu.Lock()
+	conn := c.telnet
+	c.mu.Unlock()
+	if conn == nil {
+		return errTelnetClosed
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if !raw {
+		b = escapeIAC(b)
+	}
+	_, err := conn.Write(b)
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEscapeIAC(t *testing.T) {
+	tests := []struct {
+		in, want []byte
+	}{
+		{[]byte("plain"), []byte("plain")},
+		{[]byte{0xFF}, []byte{0xFF, 0xFF}},
+		{[]byte{'a', 0xFF, 'b'}, []byte{'a', 0xFF, 0xFF, 'b'}},
+		{[]byte{0xFF, 0xFF}, []byte{0xFF, 0xFF, 0xFF, 0xFF}},
+		{[]byte{0xFF, 0xFB, 0x18}, []byte{0xFF, 0xFF, 0xFB, 0x18}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := escapeIAC(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("escapeIAC(% x) = % x, want % x", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTelnetDataAndCommand(t *testing.T) {
+	remote := &scriptedRemote{}
+	c := &Client{telnet: remote}
+	payload := []byte{'x', 0xFF, 0xFA, 'y'}
+	if err := c.writeTelnetData(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.writeTelnetCommand([]byte{0xFF, 0xFB, 0x1F}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{'x', 0xFF, 0xFF, 0xFA, 'y', 0xFF, 0xFB, 0x1F}
+	if !bytes.Equal(remote.written, want) {
+		t.Errorf("sent % x, want % x", remote.written, want)
+	}
+	// The caller's buffer is not modified
+	if !bytes.Equal(payload, []byte{'x', 0xFF, 0xFA, 'y'}) {
+		t.Errorf("payload changed to % x", payload)
+	}
+}
+
+func TestWriteTelnetWithoutConnection(t *testing.T) {
+	c := &Client{}
+	if err := c.writeTelnetData([]byte{0xFF}); !errors.Is(err, errTelnetClosed) {
+		t.Errorf("got %v, want errTelnetClosed", err)
+	}
+}
+
+func TestSendToRemoteEscapesIAC(t *testing.T) {
+	remote := &scriptedRemote{}
+	// A no-break space is 0xFF in CP437, so it must reach the board as IAC IAC
+	c := &Client{charset: "CP437", telnet: remote, modes: defaultTerminalModes()}
+	c.sendToRemote("a\u00a0b")
+	if want := []byte{'a', 0xFF, 0xFF, 'b'}; !bytes.Equal(remote.written, want) {
+		t.Errorf("sent % x, want % x", remote.written, want)
+	}
+}
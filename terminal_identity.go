@@ -0,0 +1,73 @@
+package main
+
+// Terminal identity reported in Device Attributes (DA / DECID) replies.
+// Some boards unlock color or transfer features only for a VT220 or xterm
+// DA; the default stays VT102.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// terminalIdentities are the named DA replies users and boards can pick.
+var terminalIdentities = map[string]string{
+	"vt100": "\x1b[?1;2c",
+	"vt102": "\x1b[?6c",
+	"vt220": "\x1b[?62;1;6c",
+	"vt320": "\x1b[?63;1;6c",
+	"xterm": "\x1b[?64;1;2;6;9;15;18;21;22c",
+}
+
+// defaultTerminalIdentity is used when nothing else is configured.
+const defaultTerminalIdentity = "vt102"
+
+// resolveTerminalIdentity maps a name (case-insensitive) or a literal
+// reply starting with ESC[ (escapes allowed) to DA reply bytes.
+func resolveTerminalIdentity(id string) (string, error) {
+	if id == "" {
+		return terminalIdentities[defaultTerminalIdentity], nil
+	}
+	if rsp, ok := terminalIdentities[strings.ToLower(id)]; ok {
+		return rsp, nil
+	}
+	raw := boardEscapes.Replace(id)
+	if strings.HasPrefix(raw, "\x1b[") && strings.HasSuffix(raw, "c") {
+		return raw, nil
+	}
+	return "", fmt.Errorf("unknown terminal identity %q", id)
+}
+
+// daResponse returns the DA reply for the session: the identity chosen
+// with "setTerminalIdentity", else the board's, else config
+// terminal.identity, else VT102.
+func (c *Client) daResponse() []byte {
+	cfg := LoadAppConfig()
+	c.mu.Lock()
+	id := c.terminalIdentity
+	if id == "" {
+		id = c.board.Identity
+	}
+	c.mu.Unlock()
+	if id == "" && cfg != nil {
+		id = cfg.Terminal.Identity
+	}
+	rsp, err := resolveTerminalIdentity(id)
+	if err != nil {
+		rsp = terminalIdentities[defaultTerminalIdentity]
+	}
+	return []byte(rsp)
+}
+
+// setTerminalIdentity picks the identity for this session; "" restores
+// the board/config default.
+func (c *Client) setTerminalIdentity(id string) error {
+	if id != "" {
+		if _, err := resolveTerminalIdentity(id); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.terminalIdentity = id
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestResolveTerminalIdentity(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"", "\x1b[?6c", false},
+		{"vt100", "\x1b[?1;2c", false},
+		{"VT220", "\x1b[?62;1;6c", false},
+		{"vt320", "\x1b[?63;1;6c", false},
+		{"xterm", "\x1b[?64;1;2;6;9;15;18;21;22c", false},
+		{`\e[?62;22c`, "\x1b[?62;22c", false},
+		{"vt52", "", true},
+		{`\e[?62;22`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveTerminalIdentity(tt.id)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%q: got %q, %v", tt.id, got, err)
+		}
+	}
+}
+
+func TestDAResponsePrecedence(t *testing.T) {
+	cfg := &Config{}
+	useConfig(t, cfg)
+	c := &Client{}
+	if got := string(c.daResponse()); got != "\x1b[?6c" {
+		t.Errorf("default: %q", got)
+	}
+	cfg.Terminal.Identity = "vt100"
+	if got := string(c.daResponse()); got != "\x1b[?1;2c" {
+		t.Errorf("config: %q", got)
+	}
+	c.board.Identity = "vt220"
+	if got := string(c.daResponse()); got != "\x1b[?62;1;6c" {
+		t.Errorf("board: %q", got)
+	}
+	if err := c.setTerminalIdentity("xterm"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(c.daResponse()); got != "\x1b[?64;1;2;6;9;15;18;21;22c" {
+		t.Errorf("session: %q", got)
+	}
+	if err := c.setTerminalIdentity("bogus"); err == nil {
+		t.Error("unknown identity accepted")
+	}
+	c.setTerminalIdentity("")
+	if got := string(c.daResponse()); got != "\x1b[?62;1;6c" {
+		t.Errorf("after reset: %q", got)
+	}
+	// A bad configured identity falls back to VT102
+	c.board.Identity = ""
+	cfg.Terminal.Identity = "bogus"
+	if got := string(c.daResponse()); got != "\x1b[?6c" {
+		t.Errorf("bad config: %q", got)
+	}
+}
+
+func TestDAQueriesAnsweredWithIdentity(t *testing.T) {
+	useConfig(t, &Config{})
+	for _, query := range []string{"\x1b[c", "\x1b[0c", "\x1bZ"} {
+		remote := &scriptedRemote{}
+		c := &Client{telnet: remote, board: BBSInfo{Identity: "vt220"}}
+		c.handleTerminalQueries([]byte("menu" + query))
+		if got := string(remote.written); got != "\x1b[?62;1;6c" {
+			t.Errorf("%q: board got %q", query, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+// DEC private modes set by the board. The output path feeds every chunk
+// through update so input translation (cursor keys, paste markers) and
+// output processing see one consistent view instead of each feature
+// scanning for its own ESC[?Nh/l.
+
+import "strconv"
+
+// TerminalModes holds the DEC private modes the session cares about.
+type TerminalModes struct {
+	CursorKeysApp  bool // ?1    DECCKM application cursor keys
+	OriginMode     bool // ?6    DECOM origin relative to the scroll region
+	AutoWrap       bool // ?7    DECAWM wrap at the right margin
+	CursorVisible  bool // ?25   DECTCEM
+	BracketedPaste bool // ?2004 paste wrapped in ESC[200~ / ESC[201~
+}
+
+// defaultTerminalModes is the power-on state (also restored by RIS).
+func defaultTerminalModes() TerminalModes {
+	return TerminalModes{AutoWrap: true, CursorVisible: true}
+}
+
+// set applies one DEC private mode number; unknown modes are ignored.
+func (m *TerminalModes) set(mode int, on bool) {
+	switch mode {
+	case 1:
+		m.CursorKeysApp = on
+	case 6:
+		m.OriginMode = on
+	case 7:
+		m.AutoWrap = on
+	case 25:
+		m.CursorVisible = on
+	case 2004:
+		m.BracketedPaste = on
+	}
+}
+
+// update applies the mode changes in data in order: ESC[?N;...h sets,
+// ESC[?N;...l resets and ESC c (RIS) restores the defaults. Sequences split
+// across reads are not reassembled; boards send these as one write.
+func (m *TerminalModes) update(data []byte) {
+	for i := 0; i+1 < len(data); i++ {
+		if data[i] != 0x1B {
+			continue
+		}
+		if data[i+1] == 'c' {
+			*m = defaultTerminalModes()
+			continue
+		}
+		if data[i+1] != '[' || i+2 >= len(data) || data[i+2] != '?' {
+			continue
+		}
+		j := i + 3
+		for j < len(data) && (data[j] >= '0' && data[j] <= '9' || data[j] == ';') {
+			j++
+		}
+		if j >= len(data) || (data[j] != 'h' && data[j] != 'l') {
+			continue
+		}
+		on := data[j] == 'h'
+		start := i + 3
+		for k := start; k <= j; k++ {
+			if k == j || data[k] == ';' {
+				if n, err := strconv.Atoi(string(data[start:k])); err == nil {
+					m.set(n, on)
+				}
+				start = k + 1
+			}
+		}
+		i = j
+	}
+}
+
+// trackTerminalModes updates the session's modes from board output.
+func (c *Client) trackTerminalModes(data []byte) {
+	c.mu.Lock()
+	c.modes.update(data)
+	c.mu.Unlock()
+}
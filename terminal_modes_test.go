@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func TestBracketedPasteMarkers(t *testing.T) {
+	const paste = "\x1b[200~line one\rline two\x1b[201~"
+	tests := []struct {
+		name  string
+		board string // board output before the paste
+		want  string
+	}{
+		{"board enabled bracketed paste", "\x1b[?2004h", paste},
+		{"board never enabled it", "", "line one\rline two"},
+		{"board enabled then disabled it", "\x1b[?2004h menu \x1b[?2004l", "line one\rline two"},
+		{"RIS resets it", "\x1b[?2004h\x1bc", "line one\rline two"},
+	}
+	for _, tt := range tests {
+		remote := &scriptedRemote{}
+		c := &Client{charset: "UTF-8", telnet: remote, modes: defaultTerminalModes()}
+		c.trackTerminalModes([]byte(tt.board))
+		c.sendToRemote(paste)
+		if got := string(remote.written); got != tt.want {
+			t.Errorf("%s: board got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTerminalModesUpdate(t *testing.T) {
+	m := defaultTerminalModes()
+	m.update([]byte("\x1b[?1;2004h"))
+	if !m.CursorKeysApp || !m.BracketedPaste {
+		t.Errorf("combined set not applied: %+v", m)
+	}
+	m.update([]byte("\x1b[?2004l"))
+	if m.BracketedPaste || !m.CursorKeysApp {
+		t.Errorf("reset applied to the wrong mode: %+v", m)
+	}
+}
+
+func TestTerminalModesSetAndClearEach(t *testing.T) {
+	tests := []struct {
+		mode  string
+		field func(*TerminalModes) *bool
+	}{
+		{"1", func(m *TerminalModes) *bool { return &m.CursorKeysApp }},
+		{"6", func(m *TerminalModes) *bool { return &m.OriginMode }},
+		{"7", func(m *TerminalModes) *bool { return &m.AutoWrap }},
+		{"25", func(m *TerminalModes) *bool { return &m.CursorVisible }},
+		{"2004", func(m *TerminalModes) *bool { return &m.BracketedPaste }},
+	}
+	for _, tt := range tests {
+		m := defaultTerminalModes()
+		m.update([]byte("\x1b[?" + tt.mode + "h"))
+		if !*tt.field(&m) {
+			t.Errorf("?%sh did not set the mode", tt.mode)
+		}
+		// Only the named mode changes
+		want := defaultTerminalModes()
+		*tt.field(&want) = true
+		if m != want {
+			t.Errorf("?%sh: got %+v, want %+v", tt.mode, m, want)
+		}
+		m.update([]byte("\x1b[?" + tt.mode + "l"))
+		if *tt.field(&m) {
+			t.Errorf("?%sl did not clear the mode", tt.mode)
+		}
+		*tt.field(&want) = false
+		if m != want {
+			t.Errorf("?%sl: got %+v, want %+v", tt.mode, m, want)
+		}
+	}
+}
+
+func TestTerminalModesIgnoresOthers(t *testing.T) {
+	m := defaultTerminalModes()
+	// Untracked and non-private modes, and incomplete sequences
+	m.update([]byte("\x1b[?1049h\x1b[4h\x1b[?25\x1b[?7x\x1b[?"))
+	if m != defaultTerminalModes() {
+		t.Errorf("modes changed: %+v", m)
+	}
+}
+
+func TestTrackTerminalModesFromPipeline(t *testing.T) {
+	c, remote, _ := pipelineClient("UTF-8", selfTestAllFixes, "\x1b[?25l\x1b[?6h", "text\x1b[?7l")
+	c.readTelnet(remote)
+	want := TerminalModes{OriginMode: true}
+	if c.modes != want {
+		t.Errorf("got %+v, want %+v", c.modes, want)
+	}
+}
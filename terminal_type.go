@@ -0,0 +1,76 @@
+package main
+
+// Client-supplied terminal types. The browser may list the terminal types
+// it emulates in its connect message (e.g. ["xterm-256color", "ansi"]);
+// telnet TTYPE replies walk that list per RFC 1091 and an SSH PTY requests
+// the first one when the board sets none. Without a list boards see "ansi".
+
+import "log"
+
+const (
+	// defaultTelnetTermType is reported over TTYPE when the browser sends none
+	defaultTelnetTermType = "ansi"
+	// maxTermTypes bounds the list accepted from the browser
+	maxTermTypes = 8
+)
+
+// validTermType accepts RFC 1091 style names: 1-40 ASCII letters, digits
+// and '-', '+', '.', '_' or '/'. Anything else could smuggle control bytes
+// into the negotiation.
+func validTermType(s string) bool {
+	if len(s) == 0 || len(s) > 40 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		case b == '-', b == '+', b == '.', b == '_', b == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// setTermTypes records the browser's terminal types for the next
+// connection, dropping invalid names.
+func (c *Client) setTermTypes(types []string) {
+	var valid []string
+	for _, t := range types {
+		if !validTermType(t) {
+			log.Printf("Ignoring invalid terminal type %q", t)
+			continue
+		}
+		if len(valid) < maxTermTypes {
+			valid = append(valid, t)
+		}
+	}
+	c.mu.Lock()
+	c.termTypes = valid
+	c.ttypeIndex = 0
+	c.mu.Unlock()
+}
+
+// nextTTYPE returns the terminal type for the next TTYPE SEND: each
+// request gets the next type and the last one repeats to mark the end of
+// the list.
+func (c *Client) nextTTYPE() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.termTypes) == 0 {
+		return defaultTelnetTermType
+	}
+	t := c.termTypes[min(c.ttypeIndex, len(c.termTypes)-1)]
+	c.ttypeIndex++
+	return t
+}
+
+// preferredTermType returns the browser's first terminal type, or "";
+// caller holds c.mu.
+func (c *Client) preferredTermType() string {
+	if len(c.termTypes) == 0 {
+		return ""
+	}
+	return c.termTypes[0]
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestConnectToBBSOffersTermTypes connects to a curated board by ID and
+// checks its TTYPE SEND is answered with the browser's first type.
+func TestConnectToBBSOffersTermTypes(t *testing.T) {
+	cfg := &Config{}
+	cfg.Recent.Max = -1
+	useConfig(t, cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	replies := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// DO TTYPE, then TTYPE SEND
+		conn.Write([]byte("\xff\xfd\x18\xff\xfa\x18\x01\xff\xf0"))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var got []byte
+		buf := make([]byte, 256)
+		for !bytes.Contains(got, []byte("\xff\xfa\x18\x00")) || !bytes.HasSuffix(got, []byte("\xff\xf0")) {
+			n, err := conn.Read(buf)
+			got = append(got, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		replies <- got
+	}()
+
+	saved := ApprovedBBSList
+	t.Cleanup(func() { ApprovedBBSList = saved })
+	ApprovedBBSList = []BBSInfo{{
+		ID:       "board",
+		Protocol: "telnet",
+		Host:     "127.0.0.1",
+		Port:     ln.Addr().(*net.TCPAddr).Port,
+	}}
+	c := fallbackClient()
+	c.sink = func(Message) {}
+	c.connectToBBS("board", []string{"VT100", "ansi"})
+
+	select {
+	case got := <-replies:
+		if want := []byte("\xff\xfa\x18\x00VT100\xff\xf0"); !bytes.Contains(got, want) {
+			t.Errorf("board got % x, want TTYPE IS VT100", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no reply from the session")
+	}
+}
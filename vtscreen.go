@@ -0,0 +1,578 @@
+package main
+
+// Minimal server-side virtual terminal. Applies the common subset of ANSI
+// (cursor movement, SGR attributes, erase, insert/delete, wrap, scroll
+// regions) to a cell grid. Screen text, CPR replies and future rendering or
+// export features read from this one model instead of each parsing the
+// stream on their own.
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// VTAttr holds the SGR state of a cell. Colors are ANSI palette indexes
+// 0-15, or -1 for the terminal default.
+type VTAttr struct {
+	FG        int  `json:"fg"`
+	BG        int  `json:"bg"`
+	Bold      bool `json:"bold,omitempty"`
+	Underline bool `json:"underline,omitempty"`
+	Blink     bool `json:"blink,omitempty"`
+	Reverse   bool `json:"reverse,omitempty"`
+}
+
+// defaultVTAttr is the attribute set after SGR 0.
+var defaultVTAttr = VTAttr{FG: -1, BG: -1}
+
+// VTCell is one character position on the screen.
+type VTCell struct {
+	Ch   rune   `json:"ch"`
+	Attr VTAttr `json:"attr"`
+}
+
+// VTScreen is a cell grid with a cursor, fed the UTF-8 output sent to the
+// browser. Safe for concurrent use.
+type VTScreen struct {
+	mu       sync.Mutex
+	cols     int
+	rows     int
+	cells    [][]VTCell
+	row, col int    // 0-based cursor
+	attr     VTAttr // current SGR state
+	top      int    // scroll region, 0-based inclusive
+	bottom   int
+	pending  []byte // incomplete escape sequence or UTF-8 rune
+	savedRow int
+	savedCol int
+	// scrollback, if set, receives each line that leaves the screen
+	scrollback func(line []VTCell)
+}
+
+// NewVTScreen creates a blank screen of the given size.
+func NewVTScreen(cols, rows int) *VTScreen {
+	s := &VTScreen{attr: defaultVTAttr}
+	s.Resize(cols, rows)
+	return s
+}
+
+// Resize changes the screen size, keeping the top-left content. The
+// scroll region resets to the full screen.
+func (s *VTScreen) Resize(cols, rows int) {
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 25
+	}
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cells := make([][]VTCell, rows)
+	for r := range cells {
+		cells[r] = blankLine(cols, defaultVTAttr)
+		if r < len(s.cells) {
+			copy(cells[r], s.cells[r])
+		}
+	}
+	s.cells, s.cols, s.rows = cells, cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.clampCursor()
+}
+
+// blankLine returns a line of spaces; erased cells keep the background
+// of attr, as on a real terminal.
+func blankLine(cols int, attr VTAttr) []VTCell {
+	line := make([]VTCell, cols)
+	blank := VTCell{Ch: ' ', Attr: VTAttr{FG: -1, BG: attr.BG}}
+	for i := range line {
+		line[i] = blank
+	}
+	return line
+}
+
+// Size returns the screen dimensions.
+func (s *VTScreen) Size() (cols, rows int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cols, s.rows
+}
+
+// Cursor returns the 1-based cursor position, as reported by CPR.
+func (s *VTScreen) Cursor() (row, col int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	col = s.col + 1
+	if col > s.cols {
+		col = s.cols
+	}
+	return s.row + 1, col
+}
+
+// Cells returns a copy of the grid.
+func (s *VTScreen) Cells() [][]VTCell {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([][]VTCell, len(s.cells))
+	for r, line := range s.cells {
+		out[r] = append([]VTCell(nil), line...)
+	}
+	return out
+}
+
+// SetScrollback registers fn to receive lines as they leave the screen:
+// scrolled off the top of a full-height region or wiped by a full clear.
+// fn is called with the screen locked, must not use s, and must copy
+// anything it keeps from line.
+func (s *VTScreen) SetScrollback(fn func(line []VTCell)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scrollback = fn
+}
+
+// vtLineText returns a line's characters with trailing blanks trimmed.
+func vtLineText(line []VTCell) string {
+	runes := make([]rune, len(line))
+	for i, cell := range line {
+		runes[i] = cell.Ch
+	}
+	return strings.TrimRight(string(runes), " ")
+}
+
+// Text returns the visible screen with trailing blanks trimmed per line and
+// trailing empty lines dropped.
+func (s *VTScreen) Text() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := make([]string, len(s.cells))
+	last := -1
+	for r, line := range s.cells {
+		lines[r] = vtLineText(line)
+		if lines[r] != "" {
+			last = r
+		}
+	}
+	return strings.Join(lines[:last+1], "\n")
+}
+
+// ANSI renders the screen as a sequence that redraws it on a terminal of
+// the same size: clear, each line with its attributes, then the cursor and
+// current attributes restored.
+func (s *VTScreen) ANSI() []byte {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("\x1b[0m\x1b[2J")
+	for r, line := range s.cells {
+		b.WriteString("\x1b[" + strconv.Itoa(r+1) + ";1H\x1b[0m")
+		cur := defaultVTAttr
+		for _, cell := range line {
+			if cell.Attr != cur {
+				b.WriteString(vtSGR(cell.Attr))
+				cur = cell.Attr
+			}
+			ch := cell.Ch
+			if ch == 0 {
+				ch = ' '
+			}
+			b.WriteRune(ch)
+		}
+	}
+	b.WriteString(vtSGR(s.attr))
+	b.WriteString("\x1b[" + strconv.Itoa(s.row+1) + ";" + strconv.Itoa(min(s.col, s.cols-1)+1) + "H")
+	return []byte(b.String())
+}
+
+// vtSGR returns the SGR sequence selecting attr from a reset state.
+func vtSGR(attr VTAttr) string {
+	p := []string{"0"}
+	if attr.Bold {
+		p = append(p, "1")
+	}
+	if attr.Underline {
+		p = append(p, "4")
+	}
+	if attr.Blink {
+		p = append(p, "5")
+	}
+	if attr.Reverse {
+		p = append(p, "7")
+	}
+	switch {
+	case attr.FG >= 8:
+		p = append(p, strconv.Itoa(90+attr.FG-8))
+	case attr.FG >= 0:
+		p = append(p, strconv.Itoa(30+attr.FG))
+	}
+	switch {
+	case attr.BG >= 8:
+		p = append(p, strconv.Itoa(100+attr.BG-8))
+	case attr.BG >= 0:
+		p = append(p, strconv.Itoa(40+attr.BG))
+	}
+	return "\x1b[" + strings.Join(p, ";") + "m"
+}
+
+// Write applies UTF-8 text with ANSI control sequences to the screen.
+// Sequences split across calls are held until complete.
+func (s *VTScreen) Write(data []byte) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf := data
+	if len(s.pending) > 0 {
+		buf = append(s.pending, data...)
+		s.pending = nil
+	}
+	for i := 0; i < len(buf); {
+		b := buf[i]
+		switch {
+		case b == 0x1B:
+			n, ok := s.escape(buf[i:])
+			if !ok {
+				s.pending = append([]byte(nil), buf[i:]...)
+				return
+			}
+			i += n
+			continue
+		case b == '\r':
+			s.col = 0
+		case b == '\n':
+			s.lineFeed()
+		case b == 0x08:
+			if s.col > 0 {
+				s.col--
+			}
+		case b == '\t':
+			s.col = (s.col/8 + 1) * 8
+			if s.col >= s.cols {
+				s.col = s.cols - 1
+			}
+		case b < 0x20 || b == 0x7F:
+			// Other controls do not affect the grid
+		default:
+			if !utf8.FullRune(buf[i:]) {
+				s.pending = append([]byte(nil), buf[i:]...)
+				return
+			}
+			r, size := utf8.DecodeRune(buf[i:])
+			s.put(r)
+			i += size
+			continue
+		}
+		i++
+	}
+}
+
+// put writes a rune at the cursor, wrapping at the right margin.
+func (s *VTScreen) put(r rune) {
+	if s.col >= s.cols {
+		s.col = 0
+		s.lineFeed()
+	}
+	s.cells[s.row][s.col] = VTCell{Ch: r, Attr: s.attr}
+	s.col++
+}
+
+// lineFeed moves down a line, scrolling the region at its bottom margin.
+func (s *VTScreen) lineFeed() {
+	switch {
+	case s.row == s.bottom:
+		s.scrollUp(s.top, s.bottom, 1)
+	case s.row < s.rows-1:
+		s.row++
+	}
+}
+
+// reverseIndex moves up a line, scrolling the region down at its top margin.
+func (s *VTScreen) reverseIndex() {
+	switch {
+	case s.row == s.top:
+		s.scrollDown(s.top, s.bottom, 1)
+	case s.row > 0:
+		s.row--
+	}
+}
+
+// scrollUp shifts lines top..bottom up n lines, blanking at the bottom.
+func (s *VTScreen) scrollUp(top, bottom, n int) {
+	for ; n > 0; n-- {
+		if top == 0 && s.scrollback != nil {
+			s.scrollback(s.cells[0])
+		}
+		copy(s.cells[top:bottom+1], s.cells[top+1:bottom+1])
+		s.cells[bottom] = blankLine(s.cols, s.attr)
+	}
+}
+
+// scrollDown shifts lines top..bottom down n lines, blanking at the top.
+func (s *VTScreen) scrollDown(top, bottom, n int) {
+	for ; n > 0; n-- {
+		copy(s.cells[top+1:bottom+1], s.cells[top:bottom])
+		s.cells[top] = blankLine(s.cols, s.attr)
+	}
+}
+
+func (s *VTScreen) clampCursor() {
+	if s.row < 0 {
+		s.row = 0
+	}
+	if s.row >= s.rows {
+		s.row = s.rows - 1
+	}
+	if s.col < 0 {
+		s.col = 0
+	}
+	// col == cols is the pending-wrap position after the last column
+	if s.col > s.cols {
+		s.col = s.cols
+	}
+}
+
+// escape applies one escape sequence at the start of seq and returns its
+// length, or false if the sequence is incomplete.
+func (s *VTScreen) escape(seq []byte) (int, bool) {
+	if len(seq) < 2 {
+		return 0, false
+	}
+	switch seq[1] {
+	case '[':
+		for j := 2; j < len(seq); j++ {
+			if seq[j] >= 0x40 && seq[j] <= 0x7E {
+				s.csi(string(seq[2:j]), seq[j])
+				return j + 1, true
+			}
+		}
+		return 0, false
+	case ']':
+		// OSC: skip to BEL or ST
+		for j := 2; j < len(seq); j++ {
+			if seq[j] == 0x07 {
+				return j + 1, true
+			}
+			if seq[j] == '\\' && seq[j-1] == 0x1B {
+				return j + 1, true
+			}
+		}
+		return 0, false
+	case '(', ')', '*', '+':
+		if len(seq) < 3 {
+			return 0, false
+		}
+		return 3, true
+	case '7':
+		s.savedRow, s.savedCol = s.row, s.col
+	case '8':
+		s.row, s.col = s.savedRow, s.savedCol
+		s.clampCursor()
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.attr = defaultVTAttr
+		s.top, s.bottom = 0, s.rows-1
+		s.clearRange(0, 0, s.rows-1, s.cols-1)
+		s.row, s.col = 0, 0
+	}
+	return 2, true
+}
+
+// csi applies a CSI sequence with the given parameter string and final byte.
+func (s *VTScreen) csi(params string, final byte) {
+	if strings.HasPrefix(params, "?") {
+		return // private modes do not affect the grid
+	}
+	var p []int
+	for _, f := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(f)
+		p = append(p, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(p) && p[i] > 0 {
+			return p[i]
+		}
+		return def
+	}
+	switch final {
+	case 'A':
+		s.row -= arg(0, 1)
+	case 'B':
+		s.row += arg(0, 1)
+	case 'C':
+		s.col += arg(0, 1)
+		if s.col >= s.cols {
+			s.col = s.cols - 1
+		}
+	case 'D':
+		if s.col >= s.cols {
+			s.col = s.cols - 1
+		}
+		s.col -= arg(0, 1)
+	case 'G':
+		s.col = arg(0, 1) - 1
+	case 'd':
+		s.row = arg(0, 1) - 1
+	case 'H', 'f':
+		s.row, s.col = arg(0, 1)-1, arg(1, 1)-1
+		if s.col >= s.cols {
+			s.col = s.cols - 1
+		}
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.clearRange(s.row, s.col, s.rows-1, s.cols-1)
+		case 1:
+			s.clearRange(0, 0, s.row, s.col)
+		case 2, 3:
+			if s.scrollback != nil {
+				last := -1
+				for r, line := range s.cells {
+					if vtLineText(line) != "" {
+						last = r
+					}
+				}
+				for _, line := range s.cells[:last+1] {
+					s.scrollback(line)
+				}
+			}
+			s.clearRange(0, 0, s.rows-1, s.cols-1)
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.clearRange(s.row, s.col, s.row, s.cols-1)
+		case 1:
+			s.clearRange(s.row, 0, s.row, s.col)
+		case 2:
+			s.clearRange(s.row, 0, s.row, s.cols-1)
+		}
+	case 'L', 'M': // IL/DL within the scroll region
+		if s.row >= s.top && s.row <= s.bottom {
+			n := min(arg(0, 1), s.bottom-s.row+1)
+			if final == 'L' {
+				s.scrollDown(s.row, s.bottom, n)
+			} else {
+				s.scrollUp(s.row, s.bottom, n)
+			}
+			s.col = 0
+		}
+	case 'S':
+		s.scrollUp(s.top, s.bottom, min(arg(0, 1), s.rows))
+	case 'T':
+		s.scrollDown(s.top, s.bottom, min(arg(0, 1), s.rows))
+	case '@', 'P': // ICH/DCH within the line
+		if s.col < s.cols {
+			n := min(arg(0, 1), s.cols-s.col)
+			line := s.cells[s.row]
+			blank := VTCell{Ch: ' ', Attr: VTAttr{FG: -1, BG: s.attr.BG}}
+			if final == '@' {
+				copy(line[s.col+n:], line[s.col:])
+				for c := s.col; c < s.col+n; c++ {
+					line[c] = blank
+				}
+			} else {
+				copy(line[s.col:], line[s.col+n:])
+				for c := s.cols - n; c < s.cols; c++ {
+					line[c] = blank
+				}
+			}
+		}
+	case 'X': // ECH
+		if s.col < s.cols {
+			s.clearRange(s.row, s.col, s.row, min(s.col+arg(0, 1), s.cols)-1)
+		}
+	case 'r': // DECSTBM
+		top, bottom := arg(0, 1)-1, arg(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.row, s.col = 0, 0
+		}
+	case 'm':
+		s.sgr(p)
+	case 's':
+		s.savedRow, s.savedCol = s.row, s.col
+	case 'u':
+		s.row, s.col = s.savedRow, s.savedCol
+	}
+	s.clampCursor()
+}
+
+// sgr applies SGR parameters to the current attributes. Extended colors
+// (38/48) are skipped over, as the grid only tracks the 16-color palette.
+func (s *VTScreen) sgr(p []int) {
+	if len(p) == 0 {
+		p = []int{0}
+	}
+	for i := 0; i < len(p); i++ {
+		switch n := p[i]; {
+		case n == 0:
+			s.attr = defaultVTAttr
+		case n == 1:
+			s.attr.Bold = true
+		case n == 4:
+			s.attr.Underline = true
+		case n == 5 || n == 6:
+			s.attr.Blink = true
+		case n == 7:
+			s.attr.Reverse = true
+		case n == 22:
+			s.attr.Bold = false
+		case n == 24:
+			s.attr.Underline = false
+		case n == 25:
+			s.attr.Blink = false
+		case n == 27:
+			s.attr.Reverse = false
+		case n >= 30 && n <= 37:
+			s.attr.FG = n - 30
+		case n == 39:
+			s.attr.FG = -1
+		case n >= 40 && n <= 47:
+			s.attr.BG = n - 40
+		case n == 49:
+			s.attr.BG = -1
+		case n >= 90 && n <= 97:
+			s.attr.FG = n - 90 + 8
+		case n >= 100 && n <= 107:
+			s.attr.BG = n - 100 + 8
+		case n == 38 || n == 48:
+			if i+1 < len(p) && p[i+1] == 5 {
+				i += 2
+			} else if i+1 < len(p) && p[i+1] == 2 {
+				i += 4
+			}
+		}
+	}
+}
+
+// clearRange blanks cells from (r1,c1) through (r2,c2) in reading order.
+func (s *VTScreen) clearRange(r1, c1, r2, c2 int) {
+	for r := r1; r <= r2 && r < s.rows; r++ {
+		from, to := 0, s.cols-1
+		if r == r1 {
+			from = c1
+		}
+		if r == r2 {
+			to = c2
+		}
+		for c := from; c <= to && c < s.cols; c++ {
+			s.cells[r][c] = VTCell{Ch: ' ', Attr: VTAttr{FG: -1, BG: s.attr.BG}}
+		}
+	}
+}
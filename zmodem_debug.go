@@ -0,0 +1,152 @@
+package main
+
+// rz diagnostics. With ZMODEM_DEBUG=true each rz run records its command
+// line, working directory, relevant environment, exit status and the tails
+// of its stdout and stderr. The details are logged and returned by
+// "getTransferDebug"; they stay off by default because they include local
+// paths.
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rzTailBytes bounds the stdout/stderr kept per run.
+const rzTailBytes = 2048
+
+// rzDebugEnv lists the environment variables that affect rz.
+var rzDebugEnv = []string{"PATH", "TMPDIR", "HOME", "LANG", "LC_ALL", "LC_CTYPE"}
+
+// zmodemDebug reports whether rz diagnostics are recorded.
+func zmodemDebug() bool {
+	return os.Getenv("ZMODEM_DEBUG") == "true"
+}
+
+// RzRunInfo describes one rz run for "getTransferDebug".
+type RzRunInfo struct {
+	Command    []string  `json:"command"`
+	Dir        string    `json:"dir"`
+	Env        []string  `json:"env,omitempty"`
+	Started    time.Time `json:"started"`
+	Exited     time.Time `json:"exited,omitzero"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StderrTail string    `json:"stderrTail,omitempty"`
+	StdoutTail string    `json:"stdoutTail,omitempty"` // hex
+}
+
+// rzDebug collects RzRunInfo for the current run; nil when disabled.
+type rzDebug struct {
+	mu     sync.Mutex
+	info   RzRunInfo
+	stderr []byte
+	stdout []byte
+}
+
+// newRzDebug records the start of cmd, or returns nil when ZMODEM_DEBUG is off.
+func newRzDebug(cmd *exec.Cmd) *rzDebug {
+	if !zmodemDebug() {
+		return nil
+	}
+	d := &rzDebug{info: RzRunInfo{Command: cmd.Args, Dir: cmd.Dir, Started: time.Now()}}
+	if cmd.Path != "" {
+		d.info.Command = append([]string{cmd.Path}, cmd.Args[1:]...)
+	}
+	for _, name := range rzDebugEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			d.info.Env = append(d.info.Env, name+"="+v)
+		}
+	}
+	log.Printf("LRZSZ debug: starting %s in %s (%s)", strings.Join(d.info.Command, " "), d.info.Dir, strings.Join(d.info.Env, " "))
+	return d
+}
+
+// appendTail appends p to tail, keeping the last rzTailBytes.
+func appendTail(tail, p []byte) []byte {
+	tail = append(tail, p...)
+	if len(tail) > rzTailBytes {
+		tail = append(tail[:0], tail[len(tail)-rzTailBytes:]...)
+	}
+	return tail
+}
+
+func (d *rzDebug) addStderr(p []byte) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.stderr = appendTail(d.stderr, p)
+	d.mu.Unlock()
+}
+
+func (d *rzDebug) addStdout(p []byte) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.stdout = appendTail(d.stdout, p)
+	d.mu.Unlock()
+}
+
+// exited records how rz ended and logs it with the output tails.
+func (d *rzDebug) exited(err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.info.Exited = time.Now()
+	code := rzExitCode(err)
+	d.info.ExitCode = &code
+	if err != nil {
+		d.info.Error = err.Error()
+	}
+	stderr := string(d.stderr)
+	d.mu.Unlock()
+	log.Printf("LRZSZ debug: rz exited with code %d after %v; stderr tail: %q", code, d.info.Exited.Sub(d.info.Started).Round(time.Millisecond), stderr)
+}
+
+// snapshot returns the run details with the current output tails.
+func (d *rzDebug) snapshot() RzRunInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	info := d.info
+	info.StderrTail = string(d.stderr)
+	info.StdoutTail = hex.EncodeToString(d.stdout)
+	return info
+}
+
+// rzExitCode returns the process exit code for a Wait error: 0 on success,
+// -1 if rz did not exit normally (killed, or never started).
+func rzExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// transferDebug returns the diagnostics of the session's last rz run.
+func (c *Client) transferDebug() (RzRunInfo, bool) {
+	c.mu.Lock()
+	r, ok := c.zmodemReceiver.(*LrzszReceiver)
+	c.mu.Unlock()
+	if !ok {
+		return RzRunInfo{}, false
+	}
+	r.debugMu.Lock()
+	d := r.debug
+	r.debugMu.Unlock()
+	if d == nil {
+		return RzRunInfo{}, false
+	}
+	return d.snapshot(), true
+}
@@ -17,7 +17,9 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -27,22 +29,64 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// zmodemHeaderPatterns are the byte sequences that start a transfer.
+var zmodemHeaderPatterns = [][]byte{
+	{0x2A, 0x2A, 0x18, 0x42, 0x30, 0x30}, // **\x18B00 (ZRQINIT hex)
+	{0x2A, 0x2A, 0x18, 0x41},             // **\x18A (ZBIN)
+	{0x2A, 0x2A, 0x18, 0x43},             // **\x18C (ZBIN32)
+	{0x18, 0x42, 0x30, 0x30},             // \x18B00 fragment
+	{0x18, 0x43, 0x04},                   // \x18C ... (approx)
+}
+
+const (
+	// zmodemBufferMax bounds the pre-transfer detection buffer
+	zmodemBufferMax = 1024
+	// zmodemBufferKeep is the tail kept on trim; it must be at least the
+	// longest header pattern minus one so a straddling header survives
+	zmodemBufferKeep = 512
+)
+
 // LrzszReceiver handles Zmodem transfers using the external 'rz' command.
 // It manages the lifecycle of a Zmodem file transfer session including:
 // process management, data routing, and file delivery.
 type LrzszReceiver struct {
 	client       *Client        // WebSocket client connection
+	rzMu         sync.Mutex     // Guards active through lastActivity; monitorRz replaces rz on a retry
 	active       bool           // Whether a transfer is currently active
 	tempDir      string         // Temporary directory for received files
 	rzCmd        *exec.Cmd      // The rz process handle
 	rzStdin      io.WriteCloser // Pipe to send data to rz
-	rzStdout     io.ReadCloser  // Pipe to read responses from rz
-	buffer       []byte         // Buffer for detecting Zmodem signatures
 	startTime    time.Time      // When the transfer started
 	lastActivity time.Time      // Last time we saw activity
+	buffer       []byte         // Buffer for detecting Zmodem signatures (read loop)
+	escaped      bool           // Current rz runs with -e
+	forceEscape  bool           // Next rz start uses -e regardless of the board setting
+	retried      bool           // Transfer already retried with -e
+	debugMu      sync.Mutex     // Guards debug, read by "getTransferDebug"
+	debug        *rzDebug       // Last rz run details (ZMODEM_DEBUG=true only)
+	manualStart  atomic.Bool    // "startDownload" requested; ProcessData starts rz
+	cancelledAt  atomic.Int64   // UnixNano of the last Cancel (see zmodemCancelGrace)
+	sizes        *rzSizeTracker // Declared file sizes from the current rz run
+}
+
+// zmodemFastFailure is how soon an rz failure with nothing received counts
+// as a link problem worth one retry with control characters escaped.
+const zmodemFastFailure = 10 * time.Second
+
+// zmodemCancelGrace is how long after a cancel the board's trailing frames
+// and CANs are dropped instead of restarting rz or reaching the screen.
+const zmodemCancelGrace = 5 * time.Second
+
+// zmodemAbort is the lrzsz abort sequence: CANs to end the session, then
+// backspaces to erase them should the board echo them as text.
+var zmodemAbort = []byte{
+	0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18,
+	0x08, 0x08, 0x08, 0x08, 0x08, 0x08, 0x08, 0x08, 0x08, 0x08,
 }
 
 // NewLrzszReceiver creates a new Zmodem receiver instance for the given client connection.
@@ -63,34 +107,63 @@ func NewLrzszReceiver(client *Client) *LrzszReceiver {
 // During a transfer, all raw data is piped directly to the rz process.
 func (l *LrzszReceiver) ProcessData(data []byte) ([]byte, bool) {
 	// Check for Zmodem start if not active
-	if !l.active {
+	if !l.Active() {
+		if l.inCancelGrace() && !l.manualStart.Load() {
+			// The board may not have seen the abort yet
+			if _, ok := l.findZmodemStartIndex(data); ok || bytes.IndexByte(data, 0x18) >= 0 {
+				return nil, true
+			}
+			return data, false
+		}
 		// Buffer data to look for patterns
 		l.buffer = append(l.buffer, data...)
 
-		if startIdx, ok := l.findZmodemStartIndex(l.buffer); ok {
+		startIdx, ok := l.findZmodemStartIndex(l.buffer)
+		manual := l.manualStart.Swap(false)
+		if !ok && manual {
+			// Detection missed this transfer: hand rz everything buffered
+			// and let it find the frames
+			startIdx, ok = 0, true
+		}
+		if ok {
+			l.retried = false
+			// Active before rz starts, so monitorRz sees the transfer
+			// even if rz exits at once
+			l.rzMu.Lock()
+			l.active = true
+			l.startTime = time.Now()
+			l.lastActivity = l.startTime
+			l.rzMu.Unlock()
 			if err := l.startRz(); err != nil {
 				// Failed to start rz
+				l.rzMu.Lock()
+				l.active = false
+				l.rzMu.Unlock()
 				l.buffer = make([]byte, 0)
 				return data, false
 			}
-			l.active = true
-			l.startTime = time.Now()
-			l.lastActivity = time.Now()
+			l.rzMu.Lock()
+			stdin := l.rzStdin
+			l.rzMu.Unlock()
 			// Started rz for file reception
 
 			// Send notification to client
+			status := "File transfer started (using rz)..."
+			if manual {
+				status = "File transfer started manually (using rz)..."
+			}
 			l.client.sendJSON(Message{
 				Type:    "zmodemStatus",
-				Message: "File transfer started (using rz)...",
+				Message: status,
 			})
 
 			// Write ALL data from the ZMODEM start to rz (important!)
-			if l.rzStdin != nil && len(l.buffer) > startIdx {
+			if stdin != nil && len(l.buffer) > startIdx {
 				// Clean the stream of Telnet IAC negotiations before feeding rz
 				initial := l.buffer[startIdx:]
 				clean := l.client.processTelnetData(initial)
 				if len(clean) > 0 {
-					if _, err := l.rzStdin.Write(clean); err != nil {
+					if _, err := stdin.Write(clean); err != nil {
 						// Error writing initial buffer
 					}
 				}
@@ -101,29 +174,36 @@ func (l *LrzszReceiver) ProcessData(data []byte) ([]byte, bool) {
 			return nil, true // Consume ALL data
 		}
 
-		// Clear buffer if it gets too large
-		if len(l.buffer) > 1024 {
-			l.buffer = l.buffer[512:] // Keep last 512 bytes
+		// Bound the buffer, keeping a tail long enough that a header split
+		// across reads is still found whole on the next call
+		if len(l.buffer) > zmodemBufferMax {
+			l.buffer = append(l.buffer[:0], l.buffer[len(l.buffer)-zmodemBufferKeep:]...)
 		}
 
 		return data, false // Pass through if no zmodem detected
 	}
 
 	// If rz is active, pipe telnet data (with IAC stripped) directly to it
-	if l.active && l.rzStdin != nil {
-		// Strip Telnet negotiations and unescape IAC if needed
-		clean := l.client.processTelnetData(data)
-
-		// Writing to rz stdin
-
+	l.rzMu.Lock()
+	active, stdin := l.active, l.rzStdin
+	if active {
 		// Update activity time
 		l.lastActivity = time.Now()
+	}
+	l.rzMu.Unlock()
+	if active && stdin == nil {
+		// rz is being restarted for the escaped retry; these frames were
+		// meant for it, not the screen
+		return nil, true
+	}
+	if active {
+		// Strip Telnet negotiations and unescape IAC if needed
+		clean := l.client.processTelnetData(data)
 
-		// Write cleaned data to rz immediately
-		if _, err := l.rzStdin.Write(clean); err != nil {
-			// Error writing to rz
-			l.completeTransfer()
-			return nil, true // Consume data but end transfer
+		// Write cleaned data to rz immediately. A failed write means rz
+		// has exited: monitorRz retries or completes the transfer
+		if _, err := stdin.Write(clean); err != nil {
+			return nil, true
 		}
 
 		// Don't check for end markers - let rz handle protocol
@@ -135,40 +215,97 @@ func (l *LrzszReceiver) ProcessData(data []byte) ([]byte, bool) {
 	return data, false // Pass through
 }
 
+// startDownload arms the session's receiver for a manual "startDownload".
+func (c *Client) startDownload() {
+	c.mu.Lock()
+	connected := c.telnet != nil
+	r, _ := c.zmodemReceiver.(*LrzszReceiver)
+	c.mu.Unlock()
+	switch {
+	case !connected || r == nil:
+		c.sendMessage("error", "Downloads require an active telnet connection")
+	case r.Active():
+		c.sendMessage("zmodemStatus", "A download is already in progress")
+	case c.activeSender() != nil:
+		c.sendMessage("zmodemStatus", "Cannot download while an upload is in progress")
+	default:
+		r.RequestStart()
+		log.Printf("Manual ZMODEM download requested")
+		c.sendMessage("zmodemStatus", "Waiting for the board to send (rz starts on its next output)...")
+	}
+}
+
+// RequestStart asks for rz to start on the next board output even if no
+// ZMODEM header is seen, for transfers the detector misses. It is safe to
+// call from outside the read loop.
+func (l *LrzszReceiver) RequestStart() {
+	l.manualStart.Store(true)
+}
+
 // Cancel aborts any active Zmodem transfer and performs cleanup.
 // It sends cancel sequences to the remote, terminates the rz process,
 // and removes temporary files.
 func (l *LrzszReceiver) Cancel() {
-	if !l.active {
+	l.manualStart.Store(false)
+	if !l.Active() {
 		return
 	}
-	// Cancelling Zmodem transfer
-	l.active = false
+	l.cancelledAt.Store(time.Now().UnixNano())
 	// Attempt to signal cancel to remote
 	if l.client != nil {
-		cancel := []byte{0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18}
-		l.client.sendToRemote(string(cancel))
+		l.client.writeTelnetData(zmodemAbort)
+	}
+	l.stop()
+	// Put the browser terminal back into a known state; the read loop
+	// resumes forwarding once it sees inCancelGrace
+	if l.client != nil {
+		l.client.resetTerminal()
+		l.client.sendMessage("downloadCancelled", "")
+		l.client.emitEvent(eventTransfer, "download cancelled")
+	}
+}
+
+// inCancelGrace reports whether a transfer was cancelled within
+// zmodemCancelGrace.
+func (l *LrzszReceiver) inCancelGrace() bool {
+	at := l.cancelledAt.Load()
+	return at != 0 && time.Since(time.Unix(0, at)) < zmodemCancelGrace
+}
+
+// stop tears the transfer down without telling the remote. Unlike Cancel
+// it never takes the client lock, so disconnect (which holds it while
+// closing the remote) can call it; killing rz also ends
+// forwardRzStdoutToRemote.
+func (l *LrzszReceiver) stop() {
+	l.manualStart.Store(false)
+	l.rzMu.Lock()
+	if !l.active {
+		l.rzMu.Unlock()
+		return
 	}
+	l.active = false
+	stdin, cmd, tempDir := l.rzStdin, l.rzCmd, l.tempDir
+	l.rzStdin, l.rzCmd, l.tempDir = nil, nil, ""
+	l.buffer = make([]byte, 0)
+	l.rzMu.Unlock()
 	// Close stdin to rz to make it exit
-	if l.rzStdin != nil {
-		_ = l.rzStdin.Close()
-		l.rzStdin = nil
+	if stdin != nil {
+		_ = stdin.Close()
 	}
 	// Kill rz process if running
-	if l.rzCmd != nil && l.rzCmd.Process != nil {
-		_ = l.rzCmd.Process.Kill()
-		l.rzCmd = nil
+	if cmd != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
 	}
 	// Cleanup temp directory
-	if l.tempDir != "" {
-		_ = os.RemoveAll(l.tempDir)
-		l.tempDir = ""
+	if tempDir != "" {
+		_ = os.RemoveAll(tempDir)
 	}
-	l.buffer = make([]byte, 0)
 }
 
 // Active returns true if a Zmodem transfer is currently in progress
 func (l *LrzszReceiver) Active() bool {
+	l.rzMu.Lock()
+	defer l.rzMu.Unlock()
 	return l.active
 }
 
@@ -198,15 +335,8 @@ func (l *LrzszReceiver) detectZmodemStart(data []byte) bool {
 // This is important for correctly aligning the data stream with the rz process.
 func (l *LrzszReceiver) findZmodemStartIndex(data []byte) (int, bool) {
 	// Prefer the first true ZMODEM header; avoid triggering solely on "rz\r"
-	headerPatterns := [][]byte{
-		{0x2A, 0x2A, 0x18, 0x42, 0x30, 0x30}, // **\x18B00 (ZRQINIT hex)
-		{0x2A, 0x2A, 0x18, 0x41},             // **\x18A (ZBIN)
-		{0x2A, 0x2A, 0x18, 0x43},             // **\x18C (ZBIN32)
-		{0x18, 0x42, 0x30, 0x30},             // \x18B00 fragment
-		{0x18, 0x43, 0x04},                   // \x18C ... (approx)
-	}
 	first := -1
-	for _, p := range headerPatterns {
+	for _, p := range zmodemHeaderPatterns {
 		if idx := bytes.Index(data, p); idx != -1 {
 			if first == -1 || idx < first {
 				first = idx
@@ -252,62 +382,75 @@ func (l *LrzszReceiver) startRz() error {
 	if err != nil {
 		return fmt.Errorf("failed to create temp dir: %w", err)
 	}
-	l.tempDir = tempDir
 	// Created temp directory
 
+	// Proactively request Telnet BINARY both ways for 8-bit clean stream
+	l.requestTelnetBinary()
+
+	// Give telnet negotiation a moment to complete
+	time.Sleep(100 * time.Millisecond)
+
 	// Start rz command with appropriate options:
 	// -v: verbose mode for progress reporting
 	// -b: binary mode (8-bit clean)
-	// Note: Removed -e flag as it can interfere with Zmodem protocol
-	l.rzCmd = exec.Command("rz", "-v", "-b")
-	l.rzCmd.Dir = tempDir
+	// -e: escape control characters, only when the board asks for it (it
+	//     can interfere with ZMODEM on clean links) or the link is not binary
+	args := []string{"-v", "-b"}
+	l.escaped = l.forceEscape || l.useEscapeControl()
+	if l.escaped {
+		args = append(args, "-e")
+	}
+	cmd := exec.Command("rz", args...)
+	cmd.Dir = tempDir
 	// Starting rz command
 
 	// Get stdin pipe
-	stdin, err := l.rzCmd.StdinPipe()
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		os.RemoveAll(tempDir)
 		return fmt.Errorf("failed to get stdin pipe: %w", err)
 	}
-	l.rzStdin = stdin
 
 	// Get stdout pipe
-	stdout, err := l.rzCmd.StdoutPipe()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		os.RemoveAll(tempDir)
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
-	l.rzStdout = stdout
 
 	// Get stderr pipe for progress information
-	stderr, err := l.rzCmd.StderrPipe()
+	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		os.RemoveAll(tempDir)
 		return fmt.Errorf("failed to get stderr pipe: %w", err)
 	}
 
-	// Proactively request Telnet BINARY both ways for 8-bit clean stream
-	l.requestTelnetBinary()
-
-	// Give telnet negotiation a moment to complete
-	time.Sleep(100 * time.Millisecond)
+	l.sizes = &rzSizeTracker{}
+	debug := newRzDebug(cmd)
+	l.debugMu.Lock()
+	l.debug = debug
+	l.debugMu.Unlock()
 
 	// Start the command
-	if err := l.rzCmd.Start(); err != nil {
+	if err := cmd.Start(); err != nil {
+		debug.exited(err)
 		os.RemoveAll(tempDir)
 		log.Printf("Failed to start rz command: %v", err)
 		return fmt.Errorf("failed to start rz: %w", err)
 	}
 	// Started rz process
+	l.rzMu.Lock()
+	l.rzCmd, l.rzStdin, l.tempDir = cmd, stdin, tempDir
+	l.rzMu.Unlock()
 
 	// Monitor rz in background
-	go l.monitorRz()
+	go l.monitorRz(cmd)
 
 	// Monitor progress from stderr
-	go l.monitorProgress(stderr)
+	go l.monitorProgress(stderr, debug, l.sizes)
 
 	// Forward rz stdout (handshake/ack frames) back to remote
-	go l.forwardRzStdoutToRemote()
+	go l.forwardRzStdoutToRemote(stdout, debug)
 
 	// Start watchdog timer
 	go l.watchdogTimer()
@@ -315,15 +458,46 @@ func (l *LrzszReceiver) startRz() error {
 	// Notify browser to show download UI
 	if l.client != nil {
 		l.client.sendJSON(Message{Type: "downloadStart", Message: "ZMODEM transfer starting..."})
+		l.client.emitEvent(eventTransfer, "download started")
 	}
 
 	return nil
 }
 
+// useEscapeControl decides whether rz runs with -e, from the board's
+// ZmodemEscape setting: "yes" always, "no" never, "auto" when telnet
+// BINARY was not negotiated both ways. Unset keeps -e off but warns when
+// the link is not binary, since control characters may then be mangled.
+func (l *LrzszReceiver) useEscapeControl() bool {
+	if l.client == nil {
+		return false
+	}
+	l.client.mu.Lock()
+	mode := strings.ToLower(l.client.board.ZmodemEscape)
+	binary := l.client.telnetBinaryTX && l.client.telnetBinaryRX
+	l.client.mu.Unlock()
+	switch mode {
+	case "yes":
+		return true
+	case "no":
+		return false
+	case "auto":
+		if !binary {
+			log.Printf("LRZSZ: telnet BINARY not negotiated; escaping control characters (-e)")
+		}
+		return !binary
+	}
+	if !binary {
+		log.Printf("LRZSZ: telnet BINARY not negotiated; transfer may corrupt (set ZmodemEscape for this board)")
+		l.client.sendJSON(Message{Type: "zmodemStatus", Message: "Warning: board did not enable binary mode; transfer may fail"})
+	}
+	return false
+}
+
 // requestTelnetBinary sends telnet commands to enable binary mode.
 // This ensures 8-bit clean data path for Zmodem transfers.
 func (l *LrzszReceiver) requestTelnetBinary() {
-	if l.client == nil || l.client.telnet == nil {
+	if l.client == nil {
 		return
 	}
 
@@ -338,22 +512,13 @@ func (l *LrzszReceiver) requestTelnetBinary() {
 		IAC, WILL, BINARY, // We will transmit binary
 	}
 
-	l.client.mu.Lock()
-	conn := l.client.telnet
-	l.client.mu.Unlock()
-
-	if conn != nil {
-		if _, err := conn.Write(binaryRequest); err != nil {
-			// Error requesting binary mode
-		} else {
-			// Requested telnet binary mode
-		}
-	}
+	l.client.traceNegotiationBytes("sent", binaryRequest)
+	l.client.writeTelnetCommand(binaryRequest)
 }
 
 // monitorProgress reads and reports transfer progress from rz's stderr output.
 // It sends progress updates to the browser client via WebSocket messages.
-func (l *LrzszReceiver) monitorProgress(stderr io.ReadCloser) {
+func (l *LrzszReceiver) monitorProgress(stderr io.ReadCloser, debug *rzDebug, sizes *rzSizeTracker) {
 	defer stderr.Close()
 
 	buf := make([]byte, 1024)
@@ -370,8 +535,10 @@ func (l *LrzszReceiver) monitorProgress(stderr io.ReadCloser) {
 		}
 
 		if n > 0 {
+			debug.addStderr(buf[:n])
 			// rz outputs progress info to stderr
 			progressText := string(buf[:n])
+			sizes.feed(progressText)
 
 			// Parse filename lines like: "Receiving: <name>"
 			if strings.Contains(progressText, "Receiving:") && l.client != nil {
@@ -412,63 +579,117 @@ func (l *LrzszReceiver) monitorProgress(stderr io.ReadCloser) {
 
 // monitorRz waits for the rz process to complete and triggers cleanup.
 // This goroutine runs for the lifetime of the transfer.
-func (l *LrzszReceiver) monitorRz() {
+func (l *LrzszReceiver) monitorRz(cmd *exec.Cmd) {
 	// Wait for rz to complete
-	err := l.rzCmd.Wait()
+	err := cmd.Wait()
+	l.debugMu.Lock()
+	l.debug.exited(err)
+	l.debugMu.Unlock()
 	if err != nil {
-		log.Printf("rz exited with error: %v", err)
+		log.Printf("rz exited with error: %v (exit code %d)", err, rzExitCode(err))
 	} else {
 		// rz completed successfully
 	}
 
+	// A quick failure with nothing received usually means the link is
+	// not 8-bit clean; try once more with -e before giving up
+	if err != nil && l.Active() && l.shouldRetryEscaped() {
+		l.retryEscaped()
+		return
+	}
+
 	// Trigger completion
-	if l.active {
+	if l.Active() {
 		l.completeTransfer()
 	}
 }
 
+// shouldRetryEscaped reports whether a failed rz qualifies for the escaped
+// retry: it failed within zmodemFastFailure, without -e, without having
+// retried, with no data received, and the board does not forbid -e.
+func (l *LrzszReceiver) shouldRetryEscaped() bool {
+	l.rzMu.Lock()
+	started, tempDir := l.startTime, l.tempDir
+	l.rzMu.Unlock()
+	if l.retried || l.escaped || time.Since(started) > zmodemFastFailure || l.client == nil {
+		return false
+	}
+	l.client.mu.Lock()
+	mode := strings.ToLower(l.client.board.ZmodemEscape)
+	l.client.mu.Unlock()
+	if mode == "no" {
+		return false
+	}
+	files, _ := os.ReadDir(tempDir)
+	for _, f := range files {
+		if info, err := f.Info(); err == nil && info.Size() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// retryEscaped restarts rz with -e (startRz re-requests telnet BINARY too)
+// in a fresh temp directory, keeping the transfer active. ProcessData drops
+// board data until the new rz is in place.
+func (l *LrzszReceiver) retryEscaped() {
+	l.retried = true
+	l.rzMu.Lock()
+	started := l.startTime
+	stdin, tempDir := l.rzStdin, l.tempDir
+	l.rzStdin, l.tempDir = nil, ""
+	l.rzMu.Unlock()
+	log.Printf("LRZSZ: rz failed after %v with nothing received; retrying with -e", time.Since(started).Round(time.Millisecond))
+	l.client.sendJSON(Message{Type: "zmodemStatus", Message: "Transfer failed quickly; retrying with control characters escaped..."})
+	if stdin != nil {
+		stdin.Close()
+	}
+	if tempDir != "" {
+		os.RemoveAll(tempDir)
+	}
+	l.forceEscape = true
+	err := l.startRz()
+	l.forceEscape = false
+	if err != nil {
+		log.Printf("LRZSZ: escaped retry failed to start: %v", err)
+		l.completeTransfer()
+		return
+	}
+	l.rzMu.Lock()
+	l.startTime = time.Now()
+	l.lastActivity = l.startTime
+	l.rzMu.Unlock()
+}
+
 // forwardRzStdoutToRemote bridges rz's protocol responses back to the remote BBS.
 // This creates the bidirectional communication needed for Zmodem handshaking.
 // IAC bytes (0xFF) must be escaped when sending through telnet.
-func (l *LrzszReceiver) forwardRzStdoutToRemote() {
-	if l.rzStdout == nil || l.client == nil {
+func (l *LrzszReceiver) forwardRzStdoutToRemote(stdout io.ReadCloser, debug *rzDebug) {
+	if stdout == nil || l.client == nil {
 		return
 	}
-	defer l.rzStdout.Close()
+	defer stdout.Close()
 
 	buf := make([]byte, 4096)
 	totalBytes := 0
 	for {
-		n, err := l.rzStdout.Read(buf)
+		n, err := stdout.Read(buf)
 		if n > 0 {
+			debug.addStdout(buf[:n])
 			totalBytes += n
 			// Forwarding from rz to remote
 
-			// Telnet connection
-			l.client.mu.Lock()
-			conn := l.client.telnet
-			l.client.mu.Unlock()
-
-			if conn != nil {
-				// Always escape IAC when sending through Telnet (RFC 854)
-				escaped := make([]byte, 0, n*2)
-				for _, b := range buf[:n] {
-					escaped = append(escaped, b)
-					if b == 255 { // IAC byte
-						escaped = append(escaped, 255) // Double it to escape
-					}
-				}
-				dataToSend := escaped
-				if len(escaped) > n {
-					// Escaped IAC bytes
-				}
-
-				if _, writeErr := conn.Write(dataToSend); writeErr != nil {
+			// writeTelnetData escapes IAC (RFC 854). A write racing
+			// disconnect's Close fails cleanly; stop then
+			if writeErr := l.client.writeTelnetData(buf[:n]); writeErr != nil {
+				if errors.Is(writeErr, errTelnetClosed) {
+					log.Printf("LRZSZ: Remote closed; dropping rz output and stopping forwarder")
+				} else {
 					log.Printf("Error writing to telnet: %v", writeErr)
-					return
 				}
-				log.Printf("LRZSZ: Successfully forwarded %d bytes to remote", len(dataToSend))
+				return
 			}
+			log.Printf("LRZSZ: Successfully forwarded %d bytes to remote", n)
 		}
 		if err != nil {
 			if err != io.EOF {
@@ -483,40 +704,46 @@ func (l *LrzszReceiver) forwardRzStdoutToRemote() {
 // It processes any received files, sends them to the browser client,
 // and cleans up all resources.
 func (l *LrzszReceiver) completeTransfer() {
+	l.rzMu.Lock()
 	l.active = false
 	l.buffer = make([]byte, 0)
+	stdin := l.rzStdin
+	l.rzStdin = nil
+	l.rzMu.Unlock()
 
 	// Close rz stdin
-	if l.rzStdin != nil {
-		l.rzStdin.Close()
-		l.rzStdin = nil
+	if stdin != nil {
+		stdin.Close()
 	}
 
 	// Give rz a moment to finish writing
 	time.Sleep(500 * time.Millisecond)
 
+	l.rzMu.Lock()
+	cmd, tempDir := l.rzCmd, l.tempDir
+	l.rzCmd, l.tempDir = nil, ""
+	l.rzMu.Unlock()
+
 	// Check for received files in temp directory
-	if l.tempDir != "" {
-		files, err := os.ReadDir(l.tempDir)
+	if tempDir != "" {
+		files, err := os.ReadDir(tempDir)
 		if err != nil {
 			log.Printf("LRZSZ: Error reading temp dir: %v", err)
 		} else {
 			for _, file := range files {
 				if !file.IsDir() {
-					l.sendFileToClient(filepath.Join(l.tempDir, file.Name()), file.Name())
+					l.sendFileToClient(filepath.Join(tempDir, file.Name()), file.Name())
 				}
 			}
 		}
 
 		// Clean up temp directory
-		os.RemoveAll(l.tempDir)
-		l.tempDir = ""
+		os.RemoveAll(tempDir)
 	}
 
 	// Kill rz if still running
-	if l.rzCmd != nil && l.rzCmd.Process != nil {
-		l.rzCmd.Process.Kill()
-		l.rzCmd = nil
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
 	}
 }
 
@@ -528,11 +755,14 @@ func (l *LrzszReceiver) watchdogTimer() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if !l.active {
+		l.rzMu.Lock()
+		active, started, last := l.active, l.startTime, l.lastActivity
+		l.rzMu.Unlock()
+		if !active {
 			return // Transfer completed
 		}
 
-		elapsed := time.Since(l.startTime)
+		elapsed := time.Since(started)
 		if elapsed > maxDuration {
 			log.Printf("LRZSZ: Transfer exceeded maximum duration of %v", maxDuration)
 			l.Cancel()
@@ -540,7 +770,7 @@ func (l *LrzszReceiver) watchdogTimer() {
 		}
 
 		// Check if we're making progress
-		timeSinceLastActivity := time.Since(l.lastActivity)
+		timeSinceLastActivity := time.Since(last)
 		if timeSinceLastActivity > 90*time.Second {
 			log.Printf("LRZSZ: No activity for %v, canceling transfer", timeSinceLastActivity)
 			l.Cancel()
@@ -552,18 +782,124 @@ func (l *LrzszReceiver) watchdogTimer() {
 // sendFileToClient reads a received file and sends it to the browser for download.
 // The file data is base64-encoded and sent via WebSocket message.
 func (l *LrzszReceiver) sendFileToClient(filePath, fileName string) {
+	if ok, reason := downloadAllowed(fileName); !ok {
+		log.Printf("LRZSZ: Blocked download of %s: %s", fileName, reason)
+		l.client.sendJSON(Message{Type: "downloadBlocked", Name: fileName, Message: reason})
+		return
+	}
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		log.Printf("LRZSZ: Error reading file %s: %v", fileName, err)
 		return
 	}
 
+	declared, known := l.sizes.declaredSize(fileName)
+	partial := known && int64(len(data)) < declared
+	if partial {
+		log.Printf("LRZSZ: %s is incomplete: %d of %d bytes", fileName, len(data), declared)
+		if partialFilesPolicy() == partialFilesRefuse {
+			reason := fmt.Sprintf("incomplete: received %d of %d bytes", len(data), declared)
+			l.client.sendJSON(Message{Type: "downloadBlocked", Name: fileName, Message: reason})
+			l.client.emitEvent(eventTransfer, fmt.Sprintf("download failed: %s (%s)", fileName, reason))
+			return
+		}
+		l.client.emitEvent(eventTransfer, fmt.Sprintf("download incomplete: %s (%d of %d bytes)", fileName, len(data), declared))
+	} else {
+		declared = 0
+		l.client.emitEvent(eventTransfer, fmt.Sprintf("download completed: %s (%d bytes)", fileName, len(data)))
+	}
 	log.Printf("LRZSZ: Sending file to browser: %s (%d bytes)", fileName, len(data))
 
-	// Send file to browser for download
+	// Send file to browser for download; large files are split so no
+	// single frame risks the write deadline on a slow client
+	if base64.StdEncoding.EncodedLen(len(data)) > downloadMessageLimit() {
+		l.sendFileChunked(fileName, data, declared)
+		return
+	}
 	l.client.sendJSON(Message{
-		Type:    "fileDownload",
-		Message: fileName,
-		Data:    base64.StdEncoding.EncodeToString(data),
+		Type:     "fileDownload",
+		Message:  fileName,
+		Data:     base64.StdEncoding.EncodeToString(data),
+		Partial:  partial,
+		Declared: declared,
 	})
 }
+
+// sendFileChunked delivers a file as fileDownloadStart, numbered
+// fileDownloadChunk messages (base64, each decodable on its own) and
+// fileDownloadEnd carrying the SHA-256 for verification. A non-zero
+// declared size marks the file as partial.
+func (l *LrzszReceiver) sendFileChunked(fileName string, data []byte, declared int64) {
+	// Raw chunk size: a multiple of 3 so chunks encode without padding
+	chunk := downloadMessageLimit() / 4 * 3
+	if chunk < 3 {
+		chunk = 3
+	}
+	sum := sha256.Sum256(data)
+	partial := declared > 0
+	l.client.sendJSON(Message{Type: "fileDownloadStart", Message: fileName, Name: fileName, Size: int64(len(data)), Partial: partial, Declared: declared})
+	seq := 0
+	for off := 0; off < len(data); off += chunk {
+		end := off + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		l.client.sendJSON(Message{
+			Type: "fileDownloadChunk",
+			Name: fileName,
+			Seq:  seq,
+			Data: base64.StdEncoding.EncodeToString(data[off:end]),
+		})
+		seq++
+	}
+	l.client.sendJSON(Message{Type: "fileDownloadEnd", Message: fileName, Name: fileName, SHA256: hex.EncodeToString(sum[:]), Partial: partial, Declared: declared})
+	log.Printf("LRZSZ: Sent %s in %d chunks", fileName, seq)
+}
+
+// downloadAllowed checks a received file's extension against config
+// transfer.denyExtensions and transfer.allowExtensions. Deny wins; an empty
+// allow list permits everything else.
+func downloadAllowed(fileName string) (bool, string) {
+	cfg := LoadAppConfig()
+	if cfg == nil {
+		return true, ""
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, d := range cfg.Transfer.DenyExtensions {
+		if ext != "" && ext == normalizeExtension(d) {
+			return false, fmt.Sprintf("%s files are not allowed through this gateway", ext)
+		}
+	}
+	allow := cfg.Transfer.AllowExtensions
+	if len(allow) == 0 {
+		return true, ""
+	}
+	for _, a := range allow {
+		if ext == normalizeExtension(a) {
+			return true, ""
+		}
+	}
+	if ext == "" {
+		return false, "files without an extension are not allowed through this gateway"
+	}
+	return false, fmt.Sprintf("%s files are not allowed through this gateway", ext)
+}
+
+// normalizeExtension lowercases a configured extension and adds the dot.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// downloadMessageLimit is the largest base64 payload sent as a single
+// fileDownload message (config transfer.maxMessageBytes, default 1MB).
+func downloadMessageLimit() int {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Transfer.MaxMessageBytes > 0 {
+		return cfg.Transfer.MaxMessageBytes
+	}
+	return 1 << 20
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// closableRemote is a RemoteConn whose writes fail once it is closed.
+type closableRemote struct {
+	scriptedRemote
+	cmu    sync.Mutex
+	closed bool
+}
+
+func (r *closableRemote) Write(p []byte) (int, error) {
+	r.cmu.Lock()
+	defer r.cmu.Unlock()
+	if r.closed {
+		return 0, net.ErrClosed
+	}
+	return r.scriptedRemote.Write(p)
+}
+
+func (r *closableRemote) Close() error {
+	r.cmu.Lock()
+	r.closed = true
+	r.cmu.Unlock()
+	return nil
+}
+
+func TestRzForwarderStopsOnDisconnect(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		remote := &closableRemote{}
+		c := &Client{done: make(chan bool), telnet: remote}
+		stdoutR, stdoutW := io.Pipe()
+		stdinR, stdinW := io.Pipe()
+		r := &LrzszReceiver{client: c, active: true, rzStdin: stdinW}
+		c.zmodemReceiver = r
+
+		// rz keeps producing output until its stdout is closed
+		go func() {
+			chunk := bytes.Repeat([]byte{0x2A, 0xFF}, 256)
+			for {
+				if _, err := stdoutW.Write(chunk); err != nil {
+					return
+				}
+			}
+		}()
+		go io.Copy(io.Discard, stdinR)
+		forwarded := make(chan struct{})
+		go func() {
+			r.forwardRzStdoutToRemote(stdoutR, nil)
+			close(forwarded)
+		}()
+
+		time.Sleep(time.Millisecond)
+		tornDown := make(chan struct{})
+		go func() {
+			c.disconnect()
+			close(tornDown)
+		}()
+		for name, ch := range map[string]chan struct{}{"disconnect": tornDown, "forwarder": forwarded} {
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("run %d: %s did not return", i, name)
+			}
+		}
+		if r.Active() {
+			t.Errorf("run %d: transfer still active after disconnect", i)
+		}
+		stdoutW.Close()
+		stdinR.Close()
+	}
+}
+
+func TestRzForwarderEscapesIAC(t *testing.T) {
+	remote := &closableRemote{}
+	c := &Client{telnet: remote}
+	stdoutR, stdoutW := io.Pipe()
+	r := &LrzszReceiver{client: c, active: true}
+	go func() {
+		stdoutW.Write([]byte{'a', 0xFF, 'b'})
+		stdoutW.Close()
+	}()
+	r.forwardRzStdoutToRemote(stdoutR, nil)
+	if got := remote.written; !bytes.Equal(got, []byte{'a', 0xFF, 0xFF, 'b'}) {
+		t.Errorf("board got %q", got)
+	}
+}
+
+func TestZmodemHeaderAtTrimBoundary(t *testing.T) {
+	// With rz missing from PATH, a detected header shows up as a recorded
+	// (failed) rz start, without any transfer goroutines running
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("ZMODEM_DEBUG", "true")
+	header := "**\x18B00000000000000\r\n"
+	for split := 1; split < 6; split++ {
+		c := &Client{sink: func(Message) {}}
+		r := NewLrzszReceiver(c)
+
+		// Chatty output that pushes the buffer past its bound in the same
+		// read that carries the start of the header
+		chatter := bytes.Repeat([]byte("menu "), (zmodemBufferMax-split)/5+1)
+		first := append(chatter, header[:split]...)
+		if _, consumed := r.ProcessData(first); consumed || r.debug != nil {
+			t.Fatalf("split %d: partial header detected", split)
+		}
+		if len(r.buffer) > zmodemBufferKeep {
+			t.Fatalf("split %d: buffer not trimmed (%d bytes)", split, len(r.buffer))
+		}
+		r.ProcessData([]byte(header[split:]))
+		if r.debug == nil {
+			t.Errorf("split %d: header straddling the trim not detected", split)
+		}
+	}
+}
+
+func TestZmodemDetectionBufferBounded(t *testing.T) {
+	r := NewLrzszReceiver(&Client{sink: func(Message) {}})
+	for i := 0; i < 100; i++ {
+		r.ProcessData(bytes.Repeat([]byte("no transfer here "), 20))
+		if len(r.buffer) > zmodemBufferMax {
+			t.Fatalf("buffer grew to %d bytes", len(r.buffer))
+		}
+	}
+}
+
+// TestOutputResumesAfterCancel cancels a running download (no rz) and
+// checks that the board's trailing frames are dropped while its next
+// normal output reaches the terminal again.
+func TestOutputResumesAfterCancel(t *testing.T) {
+	c, remote, data := pipelineClient("UTF-8", ANSIOptions{},
+		"**\x18B00000000000000\r\n",
+		"\x18\x18\x18\x18\x18",
+		"Main menu\r\n",
+	)
+	var types []string
+	sink := c.sink
+	c.sink = func(msg Message) {
+		types = append(types, msg.Type)
+		sink(msg)
+	}
+	r := &LrzszReceiver{client: c, active: true}
+	c.zmodemReceiver = r
+	// Suppression left over from the transfer's start
+	c.preZmodem.observe([]byte("**\x18B00"), time.Now(), time.Minute)
+
+	r.Cancel()
+	if r.Active() {
+		t.Fatal("receiver still active after Cancel")
+	}
+	if !bytes.Equal(remote.written, zmodemAbort) {
+		t.Errorf("sent to board %q, want the abort sequence", remote.written)
+	}
+	if !slices.Contains(types, "downloadCancelled") {
+		t.Errorf("messages %v, want downloadCancelled", types)
+	}
+
+	c.readTelnet(remote)
+
+	want := []string{"\x1bc", "Main menu\r\n"}
+	if !slices.Equal(*data, want) {
+		t.Errorf("terminal got %q, want %q", *data, want)
+	}
+	if r.Active() {
+		t.Error("trailing frames restarted the transfer")
+	}
+}
+
+// TestRzEscapedRetry runs a stand-in rz that fails at once unless given -e,
+// and keeps board data flowing through ProcessData while monitorRz restarts
+// it (run with -race). The retried rz saves the first line it reads.
+func TestRzEscapedRetry(t *testing.T) {
+	// Several Ps so the two sides really overlap, even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(max(4, runtime.GOMAXPROCS(0))))
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"case \"$*\" in *-e*) IFS= read -r line; printf '%s\\n' \"$line\" > received.txt; exit 0 ;; esac\n" +
+		"exit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "rz"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var mu sync.Mutex
+	var statuses []string
+	received := make(chan string, 1)
+	c := &Client{sink: func(msg Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch msg.Type {
+		case "zmodemStatus":
+			statuses = append(statuses, msg.Message)
+		case "fileDownload":
+			data, _ := base64.StdEncoding.DecodeString(msg.Data)
+			received <- string(data)
+		}
+	}}
+	r := NewLrzszReceiver(c)
+	if _, consumed := r.ProcessData([]byte("**\x18B00000000000000\r\n")); !consumed {
+		t.Fatal("transfer not started")
+	}
+
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case got := <-received:
+			if got != "payload\n" {
+				t.Errorf("retried rz received %q", got)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.ContainsFunc(statuses, func(s string) bool { return strings.Contains(s, "retrying") }) {
+				t.Errorf("statuses %q, want the retry notice", statuses)
+			}
+			return
+		case <-deadline:
+			r.stop()
+			t.Fatal("no file from the retried rz")
+		case <-time.After(10 * time.Millisecond):
+			r.ProcessData([]byte("payload\n"))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+// Partial download detection. rz -v reports each file's name and
+// "Bytes received: N/TOTAL" on stderr, TOTAL being the size the sender
+// declared in its ZFILE header. A failed transfer can leave a truncated
+// file in rz's directory; comparing it with the declared size lets
+// completeTransfer flag it (or withhold it) instead of delivering it as if
+// complete.
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Policies for transfer.partialFiles.
+const (
+	partialFilesMark   = "mark"   // deliver with "partial": true (default)
+	partialFilesRefuse = "refuse" // withhold, reported as downloadBlocked
+)
+
+// partialFilesPolicy returns how truncated downloads are handled.
+func partialFilesPolicy() string {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Transfer.PartialFiles != "" {
+		return cfg.Transfer.PartialFiles
+	}
+	return partialFilesMark
+}
+
+var rzBytesReceivedRe = regexp.MustCompile(`Bytes received:\s*(\d+)\s*/\s*(\d+)`)
+
+// rzSizeTracker collects declared file sizes from rz's stderr. Output is
+// split into lines on CR or LF, since progress lines are CR-terminated and
+// reads may end mid-line.
+type rzSizeTracker struct {
+	mu       sync.Mutex
+	line     string           // incomplete line carried to the next feed
+	current  string           // file named by the last "Receiving:" line
+	declared map[string]int64 // base name -> declared size (0 = unknown)
+}
+
+// feed parses a chunk of rz stderr output.
+func (t *rzSizeTracker) feed(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	text = t.line + text
+	for {
+		i := strings.IndexAny(text, "\r\n")
+		if i < 0 {
+			break
+		}
+		t.parseLine(text[:i])
+		text = text[i+1:]
+	}
+	t.line = text
+}
+
+// parseLine handles one complete stderr line (t.mu held).
+func (t *rzSizeTracker) parseLine(line string) {
+	if i := strings.Index(line, "Receiving:"); i >= 0 {
+		t.current = filepath.Base(strings.TrimSpace(line[i+len("Receiving:"):]))
+		return
+	}
+	m := rzBytesReceivedRe.FindStringSubmatch(line)
+	if m == nil || t.current == "" {
+		return
+	}
+	total, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return
+	}
+	if t.declared == nil {
+		t.declared = make(map[string]int64)
+	}
+	t.declared[t.current] = total
+}
+
+// declaredSize returns the size the sender announced for name, if known.
+func (t *rzSizeTracker) declaredSize(name string) (int64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	size, ok := t.declared[name]
+	return size, ok && size > 0
+}
@@ -0,0 +1,107 @@
+package main
+
+// Pre-transfer screen suppression. Between the first ZMODEM signature in
+// the board's output and the receiver taking over, output is kept off the
+// screen so the start of a transfer does not render as junk. The typed
+// "rz\r" that precedes most transfers is also a common false positive, so
+// suppression started by it alone ends as soon as output without a ZMODEM
+// header follows.
+
+import (
+	"bytes"
+	"time"
+)
+
+// zmodemConfirmDelay is how long suppression started by "rz\r" alone keeps
+// waiting for a header that may be split across reads.
+const zmodemConfirmDelay = 500 * time.Millisecond
+
+// zmodemSuppressWindow returns the longest pre-transfer suppression
+// (config transfer.zmodemSuppressMillis, default 2s; negative disables).
+func zmodemSuppressWindow() time.Duration {
+	cfg := LoadAppConfig()
+	if cfg == nil || cfg.Transfer.ZmodemSuppressMillis == 0 {
+		return 2 * time.Second
+	}
+	if cfg.Transfer.ZmodemSuppressMillis < 0 {
+		return 0
+	}
+	return time.Duration(cfg.Transfer.ZmodemSuppressMillis) * time.Millisecond
+}
+
+// hasZmodemHeader reports whether data carries a binary ZMODEM header.
+func hasZmodemHeader(data []byte) bool {
+	for _, p := range zmodemHeaderPatterns {
+		if bytes.Contains(data, p) {
+			return true
+		}
+	}
+	return bytes.Contains(data, []byte{0x2A, 0x18, 0x43}) // *\x18C
+}
+
+// zmodemSuppress is the suppression state (telnet read goroutine only).
+type zmodemSuppress struct {
+	active    bool
+	confirmed bool      // a binary header was seen, not just "rz\r"
+	until     time.Time // hard end of the window
+	confirmBy time.Time // unconfirmed suppression ends after this
+	tail      []byte    // end of the previous chunk, for split headers
+}
+
+// zmodemHeaderTail is how much of a chunk is kept to find a header split
+// across reads (one less than the longest pattern).
+const zmodemHeaderTail = 5
+
+// observe updates the state for a chunk of raw board output arriving at
+// now and reports whether suppression just started.
+func (s *zmodemSuppress) observe(data []byte, now time.Time, window time.Duration) bool {
+	if window <= 0 {
+		*s = zmodemSuppress{}
+		return false
+	}
+	if s.active && now.After(s.until) {
+		*s = zmodemSuppress{}
+	}
+	header := hasZmodemHeader(append(s.tail, data...))
+	defer s.keepTail(data)
+	switch {
+	case !s.active:
+		if !header && !bytes.Contains(data, []byte("rz\r")) {
+			return false
+		}
+		*s = zmodemSuppress{
+			active:    true,
+			confirmed: header,
+			until:     now.Add(window),
+			confirmBy: now.Add(zmodemConfirmDelay),
+		}
+		return true
+	case s.confirmed:
+	case header:
+		s.confirmed = true
+	case now.Before(s.confirmBy) && bytes.IndexByte(data, 0x18) >= 0:
+		// Possibly the rest of a header split across reads
+	default:
+		// Plain output after "rz\r": not a transfer
+		*s = zmodemSuppress{}
+	}
+	return false
+}
+
+// keepTail remembers the end of data for the next observe.
+func (s *zmodemSuppress) keepTail(data []byte) {
+	if len(data) > zmodemHeaderTail {
+		data = data[len(data)-zmodemHeaderTail:]
+	}
+	s.tail = append(s.tail[:0], data...)
+}
+
+// suppressing reports whether output is currently kept off the screen.
+func (s *zmodemSuppress) suppressing(now time.Time) bool {
+	return s.active && !now.After(s.until)
+}
+
+// release ends suppression, e.g. once the receiver is active.
+func (s *zmodemSuppress) release() {
+	*s = zmodemSuppress{}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestZmodemSuppressWindowConfig(t *testing.T) {
+	tests := []struct {
+		millis int
+		want   time.Duration
+	}{
+		{0, 2 * time.Second},
+		{500, 500 * time.Millisecond},
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		cfg.Transfer.ZmodemSuppressMillis = tt.millis
+		useConfig(t, cfg)
+		if got := zmodemSuppressWindow(); got != tt.want {
+			t.Errorf("zmodemSuppressMillis %d: window %v, want %v", tt.millis, got, tt.want)
+		}
+	}
+	useConfig(t, nil)
+	if got := zmodemSuppressWindow(); got != 2*time.Second {
+		t.Errorf("no config: window %v, want 2s", got)
+	}
+}
+
+func TestZmodemSuppressLifecycle(t *testing.T) {
+	const window = 2 * time.Second
+	zrqinit := "**\x18B00000000000000\r\n"
+	type step struct {
+		after time.Duration // since the first chunk
+		data  string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []bool // suppressing after each step
+	}{
+		{"plain output", []step{{0, "Welcome\r\n"}}, []bool{false}},
+		{"header starts", []step{{0, zrqinit}, {time.Second, "more\r\n"}}, []bool{true, true}},
+		{"header window expires", []step{{0, zrqinit}, {3 * time.Second, "menu\r\n"}}, []bool{true, false}},
+		{"rz alone then output", []step{{0, "rz\r"}, {100 * time.Millisecond, "Menu\r\n"}}, []bool{true, false}},
+		{"rz then header", []step{{0, "rz\r"}, {100 * time.Millisecond, zrqinit}, {time.Second, "x"}}, []bool{true, true, true}},
+		{"rz then split header", []step{{0, "rz\r"}, {100 * time.Millisecond, "**\x18"}, {200 * time.Millisecond, "B00"}}, []bool{true, true, true}},
+		{"header split at start", []step{{0, "menu **\x18"}, {10 * time.Millisecond, "B00000"}}, []bool{false, true}},
+		{"CAN after confirm delay", []step{{0, "rz\r"}, {time.Second, "\x18"}}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		var s zmodemSuppress
+		start := time.Now()
+		var got []bool
+		for _, st := range tt.steps {
+			now := start.Add(st.after)
+			s.observe([]byte(st.data), now, window)
+			got = append(got, s.suppressing(now))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: suppressing %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestZmodemSuppressStartAndRelease(t *testing.T) {
+	var s zmodemSuppress
+	now := time.Now()
+	if !s.observe([]byte("**\x18B00"), now, time.Second) {
+		t.Error("first header did not report a start")
+	}
+	if s.observe([]byte("**\x18B00"), now, time.Second) {
+		t.Error("second header reported a new start")
+	}
+	s.release()
+	if s.suppressing(now) {
+		t.Error("still suppressing after release")
+	}
+}
+
+func TestZmodemSuppressDisabled(t *testing.T) {
+	var s zmodemSuppress
+	now := time.Now()
+	if s.observe([]byte("**\x18B00"), now, 0) || s.suppressing(now) {
+		t.Error("suppressed with the window disabled")
+	}
+	// Disabling mid-window also ends it
+	s.observe([]byte("**\x18B00"), now, time.Second)
+	s.observe([]byte("menu"), now, -1)
+	if s.suppressing(now) {
+		t.Error("still suppressing after the window was disabled")
+	}
+}
+
+// TestZmodemSuppressFalsePositiveThroughReadTelnet runs a board's echoed
+// "rz\r" followed by its menu through the read loop: the menu must show.
+func TestZmodemSuppressFalsePositiveThroughReadTelnet(t *testing.T) {
+	useConfig(t, nil)
+	c, remote, data := pipelineClient("UTF-8", ANSIOptions{}, "rz\r", "Menu\r\n")
+	c.readTelnet(remote)
+	if !slices.Contains(*data, "Menu\r\n") {
+		t.Errorf("terminal got %q, want the menu after a false rz", *data)
+	}
+}
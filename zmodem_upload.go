@@ -0,0 +1,386 @@
+package main
+
+// Browser-to-board uploads. The browser streams a file to the server in
+// numbered chunks (uploadStart / uploadChunk / uploadEnd); once the
+// assembled file matches the announced size and SHA-256 it is sent to the
+// board with the external 'sz' command, bridged over the telnet connection
+// the same way rz is for downloads.
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// uploadMaxPending bounds out-of-order chunks held while waiting for a gap
+	uploadMaxPending = 64
+	// uploadIdleTimeout abandons an upload the browser stopped feeding
+	uploadIdleTimeout = 2 * time.Minute
+)
+
+// uploadSession assembles one browser upload into a temp file. Chunks are
+// written strictly in sequence; early chunks wait in pending and
+// duplicates are dropped. Pending chunks may not add up to more than the
+// part of the file still missing.
+type uploadSession struct {
+	name         string
+	size         int64
+	sha256       string // expected hex digest, lower case
+	dir          string
+	file         *os.File
+	hash         hash.Hash
+	written      int64
+	next         int            // next sequence number to write
+	pending      map[int][]byte // chunks that arrived ahead of next
+	pendingBytes int64          // total size of pending
+	lastSeen     time.Time
+}
+
+// uploadMaxBytes returns the largest accepted upload (default 50MB).
+func uploadMaxBytes() int64 {
+	cfg := LoadAppConfig()
+	if cfg != nil && cfg.Transfer.MaxUploadBytes > 0 {
+		return cfg.Transfer.MaxUploadBytes
+	}
+	return 50 << 20
+}
+
+// startUpload begins assembling a browser upload, replacing any upload
+// still in progress.
+func (c *Client) startUpload(name string, size int64, digest string) {
+	c.abortUpload("")
+	name = filepath.Base(strings.TrimSpace(name))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		c.sendMessage("uploadError", "Upload needs a file name")
+		return
+	}
+	if size <= 0 || size > uploadMaxBytes() {
+		c.sendMessage("uploadError", fmt.Sprintf("Upload size must be between 1 and %d bytes", uploadMaxBytes()))
+		return
+	}
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+		c.sendMessage("uploadError", "Upload needs a valid SHA-256 digest")
+		return
+	}
+	c.mu.Lock()
+	connected := c.telnet != nil
+	c.mu.Unlock()
+	if !connected {
+		c.sendMessage("uploadError", "Uploads require an active telnet connection")
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "zmodem_up_*")
+	if err != nil {
+		c.sendMessage("uploadError", "Could not create upload directory")
+		return
+	}
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		os.RemoveAll(dir)
+		c.sendMessage("uploadError", "Could not create upload file")
+		return
+	}
+	c.upload = &uploadSession{
+		name:     name,
+		size:     size,
+		sha256:   digest,
+		dir:      dir,
+		file:     f,
+		hash:     sha256.New(),
+		pending:  make(map[int][]byte),
+		lastSeen: time.Now(),
+	}
+	log.Printf("Upload started: %s (%d bytes)", name, size)
+	c.sendJSON(Message{Type: "uploadReady", Name: name})
+}
+
+// uploadChunk stores one base64 chunk. Sequence numbers start at 0.
+func (c *Client) uploadChunk(seq int, data string) {
+	u := c.upload
+	if u == nil {
+		c.sendMessage("uploadError", "No upload in progress")
+		return
+	}
+	if time.Since(u.lastSeen) > uploadIdleTimeout {
+		c.abortUpload("Upload timed out")
+		return
+	}
+	u.lastSeen = time.Now()
+	if seq < u.next {
+		return // duplicate of a chunk already written
+	}
+	if _, dup := u.pending[seq]; dup {
+		return
+	}
+	chunk, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		c.abortUpload("Upload chunk is not valid base64")
+		return
+	}
+	if seq > u.next {
+		if len(u.pending) >= uploadMaxPending {
+			c.abortUpload("Too many out-of-order upload chunks")
+			return
+		}
+		if u.pendingBytes+int64(len(chunk)) > u.size-u.written {
+			c.abortUpload("Out-of-order upload chunks exceed the announced size")
+			return
+		}
+		u.pending[seq] = chunk
+		u.pendingBytes += int64(len(chunk))
+		return
+	}
+	for {
+		if u.written+int64(len(chunk)) > u.size {
+			c.abortUpload("Upload is larger than announced")
+			return
+		}
+		if _, err := u.file.Write(chunk); err != nil {
+			c.abortUpload("Could not write upload file")
+			return
+		}
+		u.hash.Write(chunk)
+		u.written += int64(len(chunk))
+		u.next++
+		next, ok := u.pending[u.next]
+		if !ok {
+			break
+		}
+		delete(u.pending, u.next)
+		u.pendingBytes -= int64(len(next))
+		chunk = next
+	}
+	c.sendJSON(Message{Type: "uploadProgress", Message: fmt.Sprintf("%d", u.written*100/u.size)})
+}
+
+// finishUpload verifies the assembled file and hands it to sz.
+func (c *Client) finishUpload() {
+	u := c.upload
+	if u == nil {
+		c.sendMessage("uploadError", "No upload in progress")
+		return
+	}
+	if len(u.pending) > 0 || u.written != u.size {
+		c.abortUpload(fmt.Sprintf("Upload incomplete: received %d of %d bytes", u.written, u.size))
+		return
+	}
+	if got := hex.EncodeToString(u.hash.Sum(nil)); got != u.sha256 {
+		c.abortUpload("Upload checksum mismatch")
+		return
+	}
+	if err := u.file.Close(); err != nil {
+		c.abortUpload("Could not write upload file")
+		return
+	}
+	c.upload = nil
+	path := filepath.Join(u.dir, u.name)
+	log.Printf("Upload verified: %s (%d bytes); starting sz", u.name, u.size)
+	sender := NewLrzszSender(c, path, u.dir)
+	if err := sender.Start(); err != nil {
+		os.RemoveAll(u.dir)
+		c.sendMessage("uploadError", err.Error())
+		return
+	}
+	c.mu.Lock()
+	c.zmodemSender = sender
+	c.mu.Unlock()
+	c.emitEvent(eventTransfer, "upload started: "+u.name)
+}
+
+// abortUpload discards any partial upload; a non-empty reason is reported
+// to the browser.
+func (c *Client) abortUpload(reason string) {
+	if u := c.upload; u != nil {
+		u.file.Close()
+		os.RemoveAll(u.dir)
+		c.upload = nil
+		log.Printf("Upload of %s discarded: %s", u.name, reason)
+	}
+	if reason != "" {
+		c.sendMessage("uploadError", reason)
+	}
+}
+
+// activeSender returns the running upload sender, if any.
+func (c *Client) activeSender() *LrzszSender {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zmodemSender != nil && c.zmodemSender.Active() {
+		return c.zmodemSender
+	}
+	return nil
+}
+
+// LrzszSender sends one file to the board with the external 'sz' command.
+// While active it owns the telnet stream: board bytes go to sz's stdin and
+// sz's stdout is written back to the board.
+type LrzszSender struct {
+	client  *Client
+	path    string
+	tempDir string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+
+	mu     sync.Mutex
+	active bool
+}
+
+// NewLrzszSender prepares a sender for path; tempDir is removed when the
+// transfer ends.
+func NewLrzszSender(client *Client, path, tempDir string) *LrzszSender {
+	return &LrzszSender{client: client, path: path, tempDir: tempDir}
+}
+
+// Start spawns sz and begins bridging.
+func (s *LrzszSender) Start() error {
+	// -b: binary, -e: escape control characters for telnet-safe transfer
+	s.cmd = exec.Command("sz", "-v", "-b", "-e", filepath.Base(s.path))
+	s.cmd.Dir = filepath.Dir(s.path)
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get sz stdin: %w", err)
+	}
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get sz stdout: %w", err)
+	}
+	stderr, err := s.cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get sz stderr: %w", err)
+	}
+	s.stdin, s.stdout = stdin, stdout
+	if err := s.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start sz: %w", err)
+	}
+	s.mu.Lock()
+	s.active = true
+	s.mu.Unlock()
+
+	s.client.sendJSON(Message{Type: "zmodemStatus", Message: "Sending file to board (using sz)..."})
+	go s.forwardToRemote()
+	go s.monitorProgress(stderr)
+	go s.wait()
+	return nil
+}
+
+// Active reports whether sz is still running.
+func (s *LrzszSender) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// ProcessData feeds board output (telnet negotiation stripped) to sz.
+func (s *LrzszSender) ProcessData(data []byte) {
+	clean := s.client.processTelnetData(data)
+	if len(clean) == 0 || s.stdin == nil {
+		return
+	}
+	if _, err := s.stdin.Write(clean); err != nil {
+		s.Cancel()
+	}
+}
+
+// Cancel aborts the upload and sends CAN to the board.
+func (s *LrzszSender) Cancel() {
+	if s.stop() {
+		s.client.writeTelnetData(zmodemAbort)
+	}
+}
+
+// stop terminates sz without touching the connection (safe while the
+// client lock is held). Reports whether the sender was active.
+func (s *LrzszSender) stop() bool {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return false
+	}
+	s.active = false
+	s.mu.Unlock()
+	if s.stdin != nil {
+		s.stdin.Close()
+	}
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	return true
+}
+
+// forwardToRemote writes sz's protocol output to the board (IAC escaped).
+func (s *LrzszSender) forwardToRemote() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.stdout.Read(buf)
+		if n > 0 {
+			s.client.writeTelnetData(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// monitorProgress relays sz's percentage output as uploadProgress.
+func (s *LrzszSender) monitorProgress(stderr io.ReadCloser) {
+	defer stderr.Close()
+	percentRe := regexp.MustCompile(`(\d{1,3})%`)
+	buf := make([]byte, 1024)
+	for {
+		n, err := stderr.Read(buf)
+		if n > 0 {
+			if m := percentRe.FindStringSubmatch(string(buf[:n])); len(m) == 2 {
+				s.client.sendJSON(Message{Type: "zmodemProgress", Message: m[1] + "%"})
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait reaps sz, reports the outcome and cleans up the temp file.
+func (s *LrzszSender) wait() {
+	err := s.cmd.Wait()
+	s.mu.Lock()
+	cancelled := !s.active
+	s.active = false
+	s.mu.Unlock()
+	os.RemoveAll(s.tempDir)
+
+	name := filepath.Base(s.path)
+	var exitErr *exec.ExitError
+	switch {
+	case cancelled:
+		s.client.sendMessage("uploadCancelled", name)
+		s.client.emitEvent(eventTransfer, "upload cancelled: "+name)
+	case err == nil:
+		log.Printf("sz finished sending %s", name)
+		s.client.sendMessage("uploadComplete", name)
+		s.client.emitEvent(eventTransfer, "upload completed: "+name)
+	case errors.As(err, &exitErr):
+		log.Printf("sz exited with error: %v", err)
+		s.client.sendMessage("uploadError", "Board did not accept "+name)
+		s.client.emitEvent(eventTransfer, "upload failed: "+name)
+	default:
+		log.Printf("sz failed: %v", err)
+		s.client.sendMessage("uploadError", "Upload failed")
+		s.client.emitEvent(eventTransfer, "upload failed: "+name)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// uploadClient returns a connected session whose browser messages are
+// collected in msgs.
+func uploadClient(msgs *[]Message) *Client {
+	return &Client{telnet: &scriptedRemote{}, sink: func(m Message) { *msgs = append(*msgs, m) }}
+}
+
+func lastUploadError(msgs []Message) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Type == "uploadError" {
+			return msgs[i].Message
+		}
+	}
+	return ""
+}
+
+func TestUploadChunksOutOfOrderAndDuplicate(t *testing.T) {
+	var msgs []Message
+	c := uploadClient(&msgs)
+	file := []byte("first second third")
+	sum := sha256.Sum256(file)
+	c.startUpload("notes.txt", int64(len(file)), hex.EncodeToString(sum[:]))
+	if c.upload == nil {
+		t.Fatalf("upload not started: %+v", msgs)
+	}
+	dir := c.upload.dir
+	defer os.RemoveAll(dir)
+	chunk := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	c.uploadChunk(2, chunk("third"))
+	c.uploadChunk(1, chunk("second "))
+	c.uploadChunk(1, chunk("second ")) // duplicate while pending
+	c.uploadChunk(0, chunk("first "))
+	c.uploadChunk(0, chunk("first ")) // duplicate of a written chunk
+	if e := lastUploadError(msgs); e != "" {
+		t.Fatalf("unexpected error %q", e)
+	}
+	if c.upload.written != int64(len(file)) || len(c.upload.pending) != 0 || c.upload.pendingBytes != 0 {
+		t.Errorf("written %d, pending %d (%d bytes)", c.upload.written, len(c.upload.pending), c.upload.pendingBytes)
+	}
+	if got := hex.EncodeToString(c.upload.hash.Sum(nil)); got != c.upload.sha256 {
+		t.Error("assembled file hash differs")
+	}
+	c.abortUpload("")
+}
+
+func TestUploadPendingBoundedBySize(t *testing.T) {
+	var msgs []Message
+	c := uploadClient(&msgs)
+	c.startUpload("small.bin", 100, strings.Repeat("0", 64))
+	if c.upload == nil {
+		t.Fatalf("upload not started: %+v", msgs)
+	}
+	dir := c.upload.dir
+	big := base64.StdEncoding.EncodeToString(make([]byte, 60))
+	c.uploadChunk(1, big)
+	if c.upload == nil {
+		t.Fatal("first early chunk rejected")
+	}
+	// 120 bytes pending for a 100-byte file
+	c.uploadChunk(2, big)
+	if c.upload != nil {
+		t.Fatal("pending chunks beyond the announced size were kept")
+	}
+	if e := lastUploadError(msgs); !strings.Contains(e, "exceed the announced size") {
+		t.Errorf("error = %q", e)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("upload directory not removed")
+	}
+}